@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	decoder "github.com/next-exp/decoder_go/pkg"
+)
+
+// List of files to decode, read from JSON, YAML or TOML. Paths are
+// relative to the working directory.
+//
+//	config: base.yaml        # Configuration shared by all the runs
+//	jobs: 4                  # Runs decoded at the same time
+//	output_dir: /data/h5     # Used for the runs without file_out
+//	runs:
+//	  - run: 14711
+//	    file_in: /data/rd/run_14711.rd
+//	    overrides:
+//	      max_events: 100
+type Manifest struct {
+	Config    string        `json:"config"`
+	Jobs      int           `json:"jobs"`
+	OutputDir string        `json:"output_dir"`
+	Runs      []ManifestRun `json:"runs"`
+}
+
+type ManifestRun struct {
+	Run      int    `json:"run"`
+	FileIn   string `json:"file_in"`
+	FileOut  string `json:"file_out"`
+	FileOut2 string `json:"file_out2"`
+	// Configuration keys for this run only
+	Overrides map[string]interface{} `json:"overrides"`
+}
+
+// Written next to the output when a run is decoded, a run is complete if
+// the marker matches the input file
+type completionMarker struct {
+	FileIn     string    `json:"file_in"`
+	InputSize  int64     `json:"input_size"`
+	Outputs    []string  `json:"outputs"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+type RunStatus string
+
+const (
+	RUN_DONE    RunStatus = "done"
+	RUN_SKIPPED RunStatus = "skipped"
+	RUN_FAILED  RunStatus = "failed"
+)
+
+type RunReport struct {
+	Run      int       `json:"run"`
+	FileIn   string    `json:"file_in"`
+	FileOut  string    `json:"file_out"`
+	Status   RunStatus `json:"status"`
+	Error    string    `json:"error,omitempty"`
+	Log      string    `json:"log,omitempty"`
+	Duration float64   `json:"duration_s"`
+}
+
+type batchJob struct {
+	index  int
+	run    ManifestRun
+	config decoder.Configuration
+}
+
+// Decodes the runs listed in a manifest, each one in its own decoder
+// process. Exits with 1 if any run failed.
+//
+//	decoder batch [-jobs N] [-force] [-report report.json] manifest.yaml
+func runBatch(args []string) int {
+	flags := flag.NewFlagSet("batch", flag.ExitOnError)
+	jobs := flags.Int("jobs", 0, "Runs decoded at the same time, overrides the manifest")
+	force := flags.Bool("force", false, "Decode the runs even if their output is complete")
+	reportFilename := flags.String("report", "", "Write the summary report as JSON to this file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s batch [options] manifest\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	manifest, err := readManifest(flags.Arg(0))
+	if err != nil {
+		logger.Error("Error reading manifest", "error", err)
+		return 2
+	}
+	if *jobs > 0 {
+		manifest.Jobs = *jobs
+	}
+	if manifest.Jobs < 1 {
+		manifest.Jobs = 1
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		logger.Error("Error finding the decoder executable", "error", err)
+		return 2
+	}
+
+	reports := make([]RunReport, len(manifest.Runs))
+	queue := make(chan batchJob)
+	var wg sync.WaitGroup
+	for w := 0; w < manifest.Jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				reports[job.index] = decodeRun(executable, manifest, job)
+				decoder.ModuleLogger("batch").Info("Run finished", "run", job.run.Run,
+					"status", reports[job.index].Status, "file", job.run.FileIn)
+			}
+		}()
+	}
+
+	for i, run := range manifest.Runs {
+		report := RunReport{Run: run.Run, FileIn: run.FileIn, FileOut: run.FileOut}
+		config, err := runConfiguration(manifest, run)
+		if err != nil {
+			report.Status = RUN_FAILED
+			report.Error = err.Error()
+			reports[i] = report
+			continue
+		}
+		report.FileOut = config.FileOut
+		if !*force && runComplete(config) {
+			report.Status = RUN_SKIPPED
+			reports[i] = report
+			continue
+		}
+		queue <- batchJob{index: i, run: run, config: config}
+	}
+	close(queue)
+	wg.Wait()
+
+	printBatchReport(reports)
+	if *reportFilename != "" {
+		data, err := json.MarshalIndent(reports, "", "  ")
+		if err == nil {
+			err = os.WriteFile(*reportFilename, append(data, '\n'), 0644)
+		}
+		if err != nil {
+			logger.Error("Error writing report", "error", err)
+			return 1
+		}
+	}
+	for _, report := range reports {
+		if report.Status == RUN_FAILED {
+			return 1
+		}
+	}
+	return 0
+}
+
+func readManifest(filename string) (Manifest, error) {
+	var manifest Manifest
+	data, err := decoder.ReadFileAsJSON(filename)
+	if err != nil {
+		return manifest, err
+	}
+	jsonDecoder := json.NewDecoder(bytes.NewReader(data))
+	jsonDecoder.DisallowUnknownFields()
+	// Keeps large integers in the overrides as they are written
+	jsonDecoder.UseNumber()
+	if err := jsonDecoder.Decode(&manifest); err != nil {
+		return manifest, err
+	}
+	if len(manifest.Runs) == 0 {
+		return manifest, errors.New("no runs in the manifest")
+	}
+	return manifest, nil
+}
+
+// Effective configuration of a run, validated before anything is started
+func runConfiguration(manifest Manifest, run ManifestRun) (decoder.Configuration, error) {
+	config, err := LoadConfiguration(manifest.Config)
+	if err != nil {
+		return config, err
+	}
+	if err := decoder.ApplyEnvironment(&config); err != nil {
+		return config, err
+	}
+	for _, key := range sortedKeys(run.Overrides) {
+		if err := decoder.SetConfigurationValue(&config, key, overrideText(run.Overrides[key])); err != nil {
+			return config, err
+		}
+	}
+	if run.FileIn == "" {
+		return config, errors.New("run without file_in")
+	}
+	config.FileIn = run.FileIn
+	config.FileOut = run.FileOut
+	if config.FileOut == "" {
+		extension, err := decoder.OutputExtension(config)
+		if err != nil {
+			return config, err
+		}
+		name := strings.TrimSuffix(filepath.Base(run.FileIn), filepath.Ext(run.FileIn)) + extension
+		config.FileOut = filepath.Join(manifest.OutputDir, name)
+	}
+	if run.FileOut2 != "" {
+		config.FileOut2 = run.FileOut2
+	}
+	return config, config.Validate()
+}
+
+func sortedKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Value of an override as given in a flag. Lists and tables, like routes,
+// are written as JSON.
+func overrideText(value interface{}) string {
+	switch value.(type) {
+	case []interface{}, map[string]interface{}:
+		data, err := json.Marshal(value)
+		if err == nil {
+			return string(data)
+		}
+	}
+	return fmt.Sprint(value)
+}
+
+func markerFilename(config decoder.Configuration) string {
+	return config.FileOut + ".done"
+}
+
+func runOutputs(config decoder.Configuration) []string {
+	outputs := make([]string, 0)
+	for _, filename := range config.OutputRoutes().Filenames(config.FileOut) {
+		// An unknown format makes the decoder fail before writing anything
+		files, err := decoder.OutputFilenames(filename, config)
+		if err != nil {
+			files = []string{filename}
+		}
+		outputs = append(outputs, files...)
+	}
+	return outputs
+}
+
+// The outputs exist and were written from the same input file
+func runComplete(config decoder.Configuration) bool {
+	data, err := os.ReadFile(markerFilename(config))
+	if err != nil {
+		return false
+	}
+	var marker completionMarker
+	if err := json.Unmarshal(data, &marker); err != nil {
+		return false
+	}
+	input, err := os.Stat(config.FileIn)
+	if err != nil || marker.FileIn != config.FileIn || marker.InputSize != input.Size() {
+		return false
+	}
+	for _, output := range marker.Outputs {
+		if _, err := os.Stat(output); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func writeCompletionMarker(config decoder.Configuration, outputs []string) error {
+	input, err := os.Stat(config.FileIn)
+	if err != nil {
+		return err
+	}
+	marker := completionMarker{
+		FileIn:     config.FileIn,
+		InputSize:  input.Size(),
+		Outputs:    outputs,
+		FinishedAt: time.Now(),
+	}
+	data, err := json.MarshalIndent(marker, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(markerFilename(config), append(data, '\n'), 0644)
+}
+
+// Runs the decoder with the configuration of the run as flags. The output
+// of the decoder goes to a log file next to the output file.
+func decodeRun(executable string, manifest Manifest, job batchJob) (report RunReport) {
+	config := job.config
+	report = RunReport{Run: job.run.Run, FileIn: config.FileIn, FileOut: config.FileOut, Log: config.FileOut + ".log"}
+	start := time.Now()
+	// Named result, so that the duration is set on the returned report
+	defer func() {
+		report.Duration = time.Since(start).Seconds()
+	}()
+
+	fail := func(err error) RunReport {
+		report.Status = RUN_FAILED
+		report.Error = err.Error()
+		return report
+	}
+	// An old marker must not survive a failed run
+	os.Remove(markerFilename(config))
+
+	if err := os.MkdirAll(filepath.Dir(config.FileOut), 0755); err != nil {
+		return fail(err)
+	}
+	logFile, err := os.Create(report.Log)
+	if err != nil {
+		return fail(err)
+	}
+	defer logFile.Close()
+
+	args := make([]string, 0)
+	if manifest.Config != "" {
+		args = append(args, "-config", manifest.Config)
+	}
+	for _, key := range sortedKeys(job.run.Overrides) {
+		args = append(args, fmt.Sprintf("-%s=%s", strings.ReplaceAll(key, "_", "-"), overrideText(job.run.Overrides[key])))
+	}
+	args = append(args, "-file-in="+config.FileIn, "-file-out="+config.FileOut)
+	if config.FileOut2 != "" {
+		args = append(args, "-file-out2="+config.FileOut2)
+	}
+
+	cmd := exec.Command(executable, args...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Run(); err != nil {
+		return fail(fmt.Errorf("decoder failed: %w, see %s", err, report.Log))
+	}
+
+	if err := writeCompletionMarker(config, runOutputs(config)); err != nil {
+		return fail(err)
+	}
+	report.Status = RUN_DONE
+	return report
+}
+
+func printBatchReport(reports []RunReport) {
+	count := make(map[RunStatus]int)
+	fmt.Printf("%-8s %-10s %10s  %s\n", "Run", "Status", "Time (s)", "Input")
+	for _, report := range reports {
+		count[report.Status]++
+		fmt.Printf("%-8d %-10s %10.1f  %s\n", report.Run, report.Status, report.Duration, report.FileIn)
+		if report.Error != "" {
+			fmt.Printf("         %s\n", report.Error)
+		}
+	}
+	fmt.Printf("%d runs: %d done, %d skipped, %d failed\n",
+		len(reports), count[RUN_DONE], count[RUN_SKIPPED], count[RUN_FAILED])
+}
@@ -1,68 +1,85 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
-	"os"
-
 	decoder "github.com/next-exp/decoder_go/pkg"
 )
 
+// Without a file only the defaults are used
 func LoadConfiguration(filename string) (decoder.Configuration, error) {
-	var config decoder.Configuration
-
-	// Set default values
-	config.MaxEvents = 1000000000
-	config.Verbosity = 0
-	config.ExtTrigger = 15
-	config.TrgCode1 = 1
-	config.TrgCode2 = 9
-	config.ReadPMTs = true
-	config.ReadSiPMs = true
-	config.ReadTrigger = true
-	config.SplitTrg = false
-	config.NoDB = false
-	config.Discard = true
-	config.Skip = 0
-	config.Host = "next.ific.uv.es"
-	config.User = "nextreader"
-	config.Passwd = "readonly"
-	config.DBName = "NEXT100"
-	config.NumWorkers = 1
-	config.WriteData = true
-	config.Parallel = false
-	config.UseBlosc = false
-	config.CompressionLevel = 4
+	config := decoder.DefaultConfiguration()
+	if filename == "" {
+		return config, nil
+	}
 
-	data, err := os.ReadFile(filename)
+	err := decoder.ReadConfigurationFile(filename, &config)
 	if err != nil {
 		return config, err
 	}
-	err = json.Unmarshal(data, &config)
+	return config, nil
+}
+
+// Effective configuration: the defaults overridden by the configuration
+// file, the environment variables and the flags, in this order
+func loadConfigurationLayers(filename string, configFlags *decoder.ConfigurationFlags) (decoder.Configuration, error) {
+	config, err := LoadConfiguration(filename)
 	if err != nil {
 		return config, err
 	}
+	if err := decoder.ApplyEnvironment(&config); err != nil {
+		return config, err
+	}
+	if err := configFlags.Apply(&config); err != nil {
+		return config, err
+	}
 	return config, nil
 }
 
-func printConfiguration(config decoder.Configuration, logger Logger) {
-	logger.Info(fmt.Sprintf("File in: %s", config.FileIn), "config")
-	logger.Info(fmt.Sprintf("File out: %s", config.FileOut), "config")
-	logger.Info(fmt.Sprintf("File out2: %s", config.FileOut2), "config")
-	logger.Info(fmt.Sprintf("No DB: %t", config.NoDB), "config")
-	logger.Info(fmt.Sprintf("Host: %s", config.Host), "config")
-	logger.Info(fmt.Sprintf("DB name: %s", config.DBName), "config")
-	logger.Info(fmt.Sprintf("Read PMTs: %t", config.ReadPMTs), "config")
-	logger.Info(fmt.Sprintf("Read SiPMs: %t", config.ReadSiPMs), "config")
-	logger.Info(fmt.Sprintf("Read trigger: %t", config.ReadTrigger), "config")
-	logger.Info(fmt.Sprintf("Skip: %d", config.Skip), "config")
-	logger.Info(fmt.Sprintf("Max events: %d", config.MaxEvents), "config")
-	logger.Info(fmt.Sprintf("Verbosity: %d", config.Verbosity), "config")
-	logger.Info(fmt.Sprintf("Split trigger: %t", config.SplitTrg), "config")
-	logger.Info(fmt.Sprintf("Trigger code 1: %d", config.TrgCode1), "config")
-	logger.Info(fmt.Sprintf("Trigger code 2: %d", config.TrgCode2), "config")
-	logger.Info(fmt.Sprintf("Discard: %t", config.Discard), "config")
-	logger.Info(fmt.Sprintf("Write data: %t", config.WriteData), "config")
-	logger.Info(fmt.Sprintf("Number of workers: %d", config.NumWorkers), "config")
-	logger.Info(fmt.Sprintf("Parallel: %t", config.Parallel), "config")
+func printConfiguration(config decoder.Configuration) {
+	decoder.ModuleLogger("config").Debug("Configuration",
+		"file_in", config.FileIn,
+		"file_out", config.FileOut,
+		"file_out2", config.FileOut2,
+		"output_format", config.OutputFormat,
+		"arrow_compression", config.ArrowCompression,
+		"no_db", config.NoDB,
+		"host", config.Host,
+		"dbname", config.DBName,
+		"read_pmts", config.ReadPMTs,
+		"read_sipms", config.ReadSiPMs,
+		"read_trigger", config.ReadTrigger,
+		"skip", config.Skip,
+		"max_events", config.MaxEvents,
+		"verbosity", config.Verbosity,
+		"log_level", decoder.LogLevelName(config.Level()),
+		"log_modules", config.LogModules,
+		"log_format", config.LogFormat,
+		"split_trg", config.SplitTrg,
+		"trg_code1", config.TrgCode1,
+		"trg_code2", config.TrgCode2,
+		"routes", config.Routes.String(),
+		"discard", config.Discard,
+		"keep_partial", config.KeepPartial,
+		"check_fec_sync", config.CheckFecSync,
+		"discard_desync", config.DiscardDesync,
+		"check_word_count", config.CheckWordCount,
+		"write_data", config.WriteData,
+		"num_workers", config.NumWorkers,
+		"parallel", config.Parallel)
+}
+
+// Events that match no route are discarded, tables that do not take all of
+// them are reported before decoding
+func warnUnroutedEvents(config decoder.Configuration) {
+	if !config.WriteData {
+		return
+	}
+	for _, events := range config.UnroutedEvents() {
+		decoder.ModuleLogger("main").Warn("No route takes some events, they will be discarded", "events", events)
+	}
+}
+
+func reportUnroutedEvents() {
+	if discarded := decoder.Metrics.EventsDiscarded.Value("no_route"); discarded > 0 {
+		decoder.ModuleLogger("main").Warn("Events discarded, no route took them", "events", discarded)
+	}
 }
@@ -7,73 +7,155 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"os"
 	"strings"
 	"sync"
+
+	decoder "github.com/next-exp/decoder_go/pkg"
 )
 
-type Logger struct {
-	InfoLog  *slog.Logger
-	ErrorLog *slog.Logger
+// Logger of the configuration. Below warning the records go to stdout,
+// in the format of Handler or as JSON, and warnings and errors go to
+// stderr as JSON.
+func NewLogger(config decoder.Configuration, stdout io.Writer, stderr io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level:       decoder.LevelTrace,
+		ReplaceAttr: replaceLevelName,
+	}
+	var out slog.Handler = NewHandler(stdout, opts)
+	if config.LogFormat == "json" {
+		out = slog.NewJSONHandler(stdout, opts)
+	}
+	handler := &splitHandler{out: out, err: slog.NewJSONHandler(stderr, opts)}
+	// Already checked validating the configuration
+	modules, _ := decoder.ParseModuleLevels(config.LogModules)
+	return slog.New(decoder.NewLevelHandler(handler, config.Level(), modules))
+}
+
+// Uses the logger of the configuration, here and in pkg
+func setLogger(config decoder.Configuration) {
+	logger = NewLogger(config, os.Stdout, os.Stderr)
+	decoder.SetLogger(logger)
+}
+
+func replaceLevelName(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.LevelKey {
+		if level, ok := a.Value.Any().(slog.Level); ok {
+			a.Value = slog.StringValue(decoder.LogLevelName(level))
+		}
+	}
+	return a
+}
+
+// Sends warnings and errors to err and the rest to out
+type splitHandler struct {
+	out slog.Handler
+	err slog.Handler
+}
+
+func (h *splitHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if level >= slog.LevelWarn {
+		return h.err.Enabled(ctx, level)
+	}
+	return h.out.Enabled(ctx, level)
+}
+
+func (h *splitHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelWarn {
+		return h.err.Handle(ctx, r)
+	}
+	return h.out.Handle(ctx, r)
 }
 
-func (l Logger) Info(message string, module string) {
-	l.InfoLog.Info(message, "module", module)
+func (h *splitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &splitHandler{out: h.out.WithAttrs(attrs), err: h.err.WithAttrs(attrs)}
 }
 
-func (l Logger) Error(message string) {
-	l.ErrorLog.Error(message)
+func (h *splitHandler) WithGroup(name string) slog.Handler {
+	return &splitHandler{out: h.out.WithGroup(name), err: h.err.WithGroup(name)}
 }
 
 ////////////
 
+// Writes "[time] [module] message key=value..."
 type Handler struct {
-	h   slog.Handler
-	mu  *sync.Mutex
-	out io.Writer
+	level slog.Leveler
+	attrs []slog.Attr
+	group string
+	mu    *sync.Mutex
+	out   io.Writer
 }
 
 func NewHandler(o io.Writer, opts *slog.HandlerOptions) *Handler {
 	if opts == nil {
 		opts = &slog.HandlerOptions{}
 	}
+	level := opts.Level
+	if level == nil {
+		level = slog.LevelInfo
+	}
 	return &Handler{
-		out: o,
-		h: slog.NewTextHandler(o, &slog.HandlerOptions{
-			Level:       opts.Level,
-			AddSource:   opts.AddSource,
-			ReplaceAttr: nil,
-		}),
-		mu: &sync.Mutex{},
+		out:   o,
+		level: level,
+		mu:    &sync.Mutex{},
 	}
 }
 
 func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
-	return h.h.Enabled(ctx, level)
+	return level >= h.level.Level()
 }
 
 func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	return &Handler{h: h.h.WithAttrs(attrs), out: h.out, mu: h.mu}
+	withAttrs := *h
+	withAttrs.attrs = append(append([]slog.Attr{}, h.attrs...), h.qualify(attrs)...)
+	return &withAttrs
 }
 
 func (h *Handler) WithGroup(name string) slog.Handler {
-	return &Handler{h: h.h.WithGroup(name), out: h.out, mu: h.mu}
+	withGroup := *h
+	withGroup.group = h.group + name + "."
+	return &withGroup
+}
+
+func (h *Handler) qualify(attrs []slog.Attr) []slog.Attr {
+	if h.group == "" {
+		return attrs
+	}
+	qualified := make([]slog.Attr, 0, len(attrs))
+	for _, attr := range attrs {
+		qualified = append(qualified, slog.Attr{Key: h.group + attr.Key, Value: attr.Value})
+	}
+	return qualified
 }
 
 func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
 
 	formattedTime := r.Time.Format("[2006/01/02 15:04:05]")
 
-	//add time and message to values
+	//add time, module and message to values
 	strs := []string{formattedTime}
-
-	if r.NumAttrs() != 0 {
-		r.Attrs(func(a slog.Attr) bool {
-			value := fmt.Sprintf("[%s]", a.Value.String())
-			strs = append(strs, value)
-			return true
-		})
+	values := make([]string, 0)
+	addAttr := func(a slog.Attr) bool {
+		if a.Key == "module" {
+			strs = append(strs, fmt.Sprintf("[%s]", a.Value.String()))
+		} else {
+			values = append(values, fmt.Sprintf("%s=%s", a.Key, a.Value.String()))
+		}
+		return true
+	}
+	for _, attr := range h.attrs {
+		addAttr(attr)
+	}
+	recordAttrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		recordAttrs = append(recordAttrs, a)
+		return true
+	})
+	for _, attr := range h.qualify(recordAttrs) {
+		addAttr(attr)
 	}
 	strs = append(strs, r.Message)
+	strs = append(strs, values...)
 	strs = append(strs, "\n")
 
 	result := strings.Join(strs, " ")
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	hdf5writer "github.com/next-exp/decoder_go/pkg/hdf5writer"
+)
+
+// Compares two output files and exits with 1 if they differ and with 2 if
+// they could not be read.
+//
+//	decoder diff [-tolerance N] [-max-diffs N] a.h5 b.h5
+func runDiff(args []string) int {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	tolerance := flags.Int("tolerance", 0, "Maximum difference allowed in waveforms and baselines (ADC counts)")
+	maxDiffs := flags.Int("max-diffs", 10, "Differences printed per dataset, 0 to print all of them")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s diff [options] a.h5 b.h5\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	outputs := make([]*hdf5writer.Output, 2)
+	for i, filename := range flags.Args() {
+		output, err := hdf5writer.ReadOutput(filename)
+		if err != nil {
+			logger.Error("Error reading output file", "error", err)
+			return 2
+		}
+		outputs[i] = output
+	}
+
+	// All the differences are needed for the summary, the limit only
+	// applies to the printed ones
+	diffs := hdf5writer.CompareOutputs(outputs[0], outputs[1], hdf5writer.CompareOptions{Tolerance: *tolerance})
+	count := make(map[string]int)
+	for _, diff := range diffs {
+		count[diff.Dataset]++
+		if *maxDiffs == 0 || count[diff.Dataset] <= *maxDiffs {
+			fmt.Println(diff.String())
+		}
+	}
+
+	common := 0
+	eventIDs := make(map[int32]bool)
+	for _, event := range outputs[0].Events {
+		eventIDs[event.EventID] = true
+	}
+	for _, event := range outputs[1].Events {
+		if eventIDs[event.EventID] {
+			common++
+		}
+	}
+
+	fmt.Println()
+	fmt.Printf("Events: %d in %s, %d in %s, %d in both\n",
+		len(outputs[0].Events), outputs[0].Filename, len(outputs[1].Events), outputs[1].Filename, common)
+	if len(diffs) == 0 {
+		fmt.Println("Files are identical")
+		return 0
+	}
+
+	datasets := make([]string, 0, len(count))
+	for dataset := range count {
+		datasets = append(datasets, dataset)
+	}
+	sort.Strings(datasets)
+	fmt.Printf("%d differences:\n", len(diffs))
+	for _, dataset := range datasets {
+		fmt.Printf("  %-24s %d\n", dataset, count[dataset])
+	}
+	return 1
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"bytes"
 	"encoding/binary"
-	"fmt"
 	"io"
 	"os"
 	"unsafe"
@@ -14,14 +13,34 @@ import (
 type FileReader struct {
 	File     *os.File
 	EvtCount int
+	// Reads the next event, from the file or from a stream
+	read func() (decoder.EventHeaderStruct, []byte, error)
 }
 
 func NewFileReader(file *os.File) *FileReader {
-	return &FileReader{File: file, EvtCount: -1}
+	read := func() (decoder.EventHeaderStruct, []byte, error) {
+		return decoder.ReadEventFromFile(file)
+	}
+	return &FileReader{File: file, EvtCount: -1, read: read}
+}
+
+// Events received from a socket instead of a file. The run number is only
+// known when the events arrive, the database is loaded when it changes.
+func NewStreamFileReader(stream *decoder.StreamReader) *FileReader {
+	runNumber := -1
+	read := func() (decoder.EventHeaderStruct, []byte, error) {
+		header, eventData, err := stream.ReadEvent()
+		if err == nil && int(header.EventRunNb) != runNumber {
+			runNumber = int(header.EventRunNb)
+			decoder.LoadDatabase(dbConn, runNumber)
+		}
+		return header, eventData, err
+	}
+	return &FileReader{EvtCount: -1, read: read}
 }
 
 func (f *FileReader) getNextEvent() (decoder.EventHeaderStruct, []byte, error) {
-	header, eventData, err := decoder.ReadEventFromFile(f.File)
+	header, eventData, err := f.read()
 	if err != nil {
 		return header, nil, err
 	}
@@ -30,62 +49,64 @@ func (f *FileReader) getNextEvent() (decoder.EventHeaderStruct, []byte, error) {
 	}
 	f.EvtCount++
 	if f.EvtCount >= configuration.MaxEvents {
-		if VerbosityLevel > 0 {
-			logger.Info("Max events reached", "fileReader")
-		}
+		decoder.ModuleLogger("fileReader").Info("Max events reached", "events", f.EvtCount)
 		return header, nil, io.EOF
 	}
 	if f.EvtCount < configuration.Skip {
-		if VerbosityLevel > 0 {
-			message := fmt.Sprintf("Skipping event %d with ID %d", f.EvtCount, decoder.EventIdGetNbInRun(header.EventId))
-			logger.Info(message, "fileReader")
-		}
+		decoder.ModuleLogger("fileReader").Debug("Skipping event",
+			"count", f.EvtCount, "run", header.EventRunNb, "event", decoder.EventIdGetNbInRun(header.EventId))
 		return f.getNextEvent()
 	}
-	if VerbosityLevel > 0 {
-		message := fmt.Sprintf("Reading event %d with ID %d", f.EvtCount, decoder.EventIdGetNbInRun(header.EventId))
-		logger.Info(message, "fileReader")
-	}
+	decoder.ModuleLogger("fileReader").Debug("Reading event",
+		"count", f.EvtCount, "run", header.EventRunNb, "event", decoder.EventIdGetNbInRun(header.EventId))
+	decoder.Metrics.EventsRead.Inc()
+	decoder.Metrics.BytesRead.Add(float64(header.EventSize))
 	return header, eventData, nil
 }
 
+// Reads the DATE header of the next event, leaving the file at the start of
+// its payload
+func readEventHeader(file *os.File) (decoder.EventHeaderStruct, error) {
+	var header decoder.EventHeaderStruct
+	headerSize := unsafe.Sizeof(header)
+	headerBinary := make([]byte, headerSize)
+	if _, err := io.ReadFull(file, headerBinary); err != nil {
+		return header, err
+	}
+	headerReader := bytes.NewReader(headerBinary)
+	binary.Read(headerReader, binary.LittleEndian, &header)
+	if uint32(header.EventSize) < uint32(headerSize) {
+		return header, &decoder.ErrEventSize{Size: uint32(header.EventSize), HeaderSize: int(headerSize)}
+	}
+	return header, nil
+}
+
+// Size of the event after the DATE header
+func payloadSize(header decoder.EventHeaderStruct) int64 {
+	return int64(header.EventSize) - int64(unsafe.Sizeof(header))
+}
+
 func countEvents(file *os.File) (int, int) {
 	evtCount := 0
 	runNumber := 0
 	for {
-		var header decoder.EventHeaderStruct
-		headerSize := unsafe.Sizeof(header)
-		headerBinary := make([]byte, headerSize)
-		nRead, err := file.Read(headerBinary)
+		header, err := readEventHeader(file)
 		if err != nil {
 			if err != io.EOF {
-				errMessage := fmt.Errorf("error reading header counting events: %w", err)
-				logger.Error(errMessage.Error())
-			}
-			break
-		}
-		if nRead == 0 {
-			if VerbosityLevel > 1 {
-				logger.Info("End of file", "evtCounter")
+				logger.Error("Error reading header counting events", "error", err)
+			} else {
+				decoder.ModuleLogger("evtCounter").Debug("End of file")
 			}
 			break
 		}
-
-		headerReader := bytes.NewReader(headerBinary)
-		binary.Read(headerReader, binary.LittleEndian, &header)
-		if VerbosityLevel > 1 {
-			message := fmt.Sprintf("Evt id: %d. GDC %d", decoder.EventIdGetNbInRun(header.EventId), header.EventGdcId)
-			logger.Info(message, "evtCounter")
-		}
+		decoder.ModuleLogger("evtCounter").Debug("Event header",
+			"run", header.EventRunNb, "event", decoder.EventIdGetNbInRun(header.EventId), "gdc", header.EventGdcId)
 		runNumber = int(header.EventRunNb)
-		payloadSize := uint32(header.EventSize) - uint32(headerSize)
-		file.Seek(int64(payloadSize), 1)
+		file.Seek(payloadSize(header), io.SeekCurrent)
 
 		if !decoder.ValidEvent(header) {
-			if VerbosityLevel > 1 {
-				message := fmt.Sprintf("Skipping invalid event: %d", decoder.EventIdGetNbInRun(header.EventId))
-				logger.Info(message, "evtCounter")
-			}
+			decoder.ModuleLogger("evtCounter").Debug("Skipping invalid event",
+				"run", header.EventRunNb, "event", decoder.EventIdGetNbInRun(header.EventId))
 			continue
 		}
 		evtCount++
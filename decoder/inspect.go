@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	decoder "github.com/next-exp/decoder_go/pkg"
+)
+
+// Decoded content of an event, without the waveforms
+type EventSummary struct {
+	TriggerType  uint16
+	Timestamp    uint64
+	PmtChannels  int
+	BlrChannels  int
+	SipmChannels int
+	PmtSamples   int
+	SipmSamples  int
+	Error        bool
+	Desync       bool
+	Errors       []string
+}
+
+// Words of the flipped payload of a FEC
+type PayloadDump struct {
+	FecID  uint16
+	Offset int
+	Words  []uint16
+}
+
+type InspectOutput struct {
+	Structure decoder.EventStructure
+	Trigger   decoder.TriggerData
+	Summary   EventSummary
+	Dumps     []PayloadDump `json:",omitempty"`
+}
+
+// Prints the headers of an event in a raw file.
+//
+//	decoder inspect -event N [-json] [-hex-offset O] file.rd
+func runInspect(args []string) int {
+	flags := flag.NewFlagSet("inspect", flag.ExitOnError)
+	eventID := flags.Int("event", -1, "Event number, the first event if not given")
+	configFilename := flags.String("config", "", "Configuration file, needed for the database (compressed data and sensor IDs)")
+	jsonOutput := flags.Bool("json", false, "Print the output as JSON")
+	hexOffset := flags.Int("hex-offset", -1, "Dump the flipped payload of each FEC around this word offset")
+	hexWords := flags.Int("hex-words", 64, "Number of words dumped")
+	fecID := flags.Int("fec", -1, "Only dump the payload of this FEC")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s inspect [options] file.rd\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	var err error
+	if *configFilename != "" {
+		configuration, err = LoadConfiguration(*configFilename)
+		if err != nil {
+			logger.Error("Error reading configuration file", "error", err)
+			return 2
+		}
+	} else {
+		configuration = decoder.DefaultConfiguration()
+		configuration.NoDB = true
+	}
+	decoder.SetConfiguration(configuration)
+	setLogger(configuration)
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		logger.Error("Error opening file", "error", err)
+		return 2
+	}
+	defer file.Close()
+
+	header, eventData, err := findEvent(file, *eventID)
+	if err != nil {
+		logger.Error("Error finding event", "error", err)
+		return 2
+	}
+
+	if !configuration.NoDB {
+		dbConn, err := decoder.ConnectToDatabase(configuration.User, configuration.Passwd, configuration.Host, configuration.DBName)
+		if err != nil {
+			logger.Error("Error connection to database", "error", err)
+			return 2
+		}
+		defer dbConn.Close()
+		decoder.LoadDatabase(dbConn, int(header.EventRunNb))
+	}
+
+	output := InspectOutput{}
+	output.Structure, err = decoder.ReadEventStructure(eventData, header)
+	if err != nil {
+		logger.Error("Error reading event structure", "error", err)
+	}
+	event, err := decoder.ReadGDC(eventData, header)
+	output.Trigger = event.TriggerConfig
+	output.Summary = summarizeEvent(event, err)
+
+	if *hexOffset >= 0 {
+		for _, ldc := range output.Structure.Ldcs {
+			for _, equipment := range ldc.Equipments {
+				if *fecID >= 0 && int(equipment.Format.FecID) != *fecID {
+					continue
+				}
+				output.Dumps = append(output.Dumps, dumpPayload(equipment, *hexOffset, *hexWords))
+			}
+		}
+	}
+
+	if *jsonOutput {
+		data, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			logger.Error("Error encoding event", "error", err)
+			return 2
+		}
+		fmt.Println(string(data))
+		return 0
+	}
+	printInspectOutput(output)
+	return 0
+}
+
+// Reads events until the one with the given number, or the first valid
+// event if eventID is negative
+func findEvent(file *os.File, eventID int) (decoder.EventHeaderStruct, []byte, error) {
+	for {
+		header, eventData, err := decoder.ReadEventFromFile(file)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return header, nil, fmt.Errorf("event %d not found", eventID)
+			}
+			return header, nil, fmt.Errorf("error reading event: %w", err)
+		}
+		if !decoder.ValidEvent(header) {
+			continue
+		}
+		if eventID < 0 || decoder.EventIdGetNbInRun(header.EventId) == uint32(eventID) {
+			return header, eventData, nil
+		}
+	}
+}
+
+func summarizeEvent(event decoder.EventType, err error) EventSummary {
+	summary := EventSummary{
+		TriggerType:  event.TriggerType,
+		Timestamp:    event.Timestamp,
+		PmtChannels:  len(event.PmtWaveforms),
+		BlrChannels:  len(event.BlrWaveforms),
+		SipmChannels: len(event.SipmWaveforms),
+		PmtSamples:   waveformLength(event.PmtWaveforms),
+		SipmSamples:  waveformLength(event.SipmWaveforms),
+		Error:        event.Error,
+		Desync:       event.Desync,
+		Errors:       make([]string, 0),
+	}
+	if err != nil {
+		summary.Errors = append(summary.Errors, err.Error())
+	}
+	for _, errs := range [][]error{event.SyncErrors, event.DecodeErrors} {
+		for _, err := range errs {
+			summary.Errors = append(summary.Errors, err.Error())
+		}
+	}
+	return summary
+}
+
+func waveformLength(waveforms map[uint16][]int16) int {
+	for _, waveform := range waveforms {
+		return len(waveform)
+	}
+	return 0
+}
+
+// Words around offset, aligned to 8 words
+func dumpPayload(equipment decoder.EquipmentStructure, offset int, nWords int) PayloadDump {
+	start := offset - nWords/2
+	start -= start % 8
+	if start < 0 {
+		start = 0
+	}
+	end := start + nWords
+	if end > len(equipment.Payload) {
+		end = len(equipment.Payload)
+	}
+	if start > end {
+		start = end
+	}
+	return PayloadDump{FecID: equipment.Format.FecID, Offset: start, Words: equipment.Payload[start:end]}
+}
+
+func fecTypeName(fecType uint16) string {
+	switch fecType {
+	case 0:
+		return "PMT"
+	case 1:
+		return "SiPM"
+	case 2:
+		return "trigger"
+	}
+	return "unknown"
+}
+
+func printInspectOutput(output InspectOutput) {
+	header := output.Structure.Header
+	fmt.Printf("Event %d, run %d, type %d, size %d, timestamp %d.%06d\n",
+		decoder.EventIdGetNbInRun(header.EventId), header.EventRunNb, header.EventType, header.EventSize,
+		header.EventTimestampSec, header.EventTimestampUsec)
+	fmt.Printf("  GDC %d, version 0x%x, attributes %v\n", header.EventGdcId, header.EventVersion, header.EventTypeAttribute)
+
+	for i, ldc := range output.Structure.Ldcs {
+		fmt.Printf("  LDC %d: id %d, size %d, header size %d, %d equipments\n",
+			i, ldc.Header.EventLdcId, ldc.Header.EventSize, ldc.Header.EventHeadSize, len(ldc.Equipments))
+		for _, equipment := range ldc.Equipments {
+			eq := equipment.Header
+			fmt.Printf("    Equipment %d: type %d, size %d, %d payload words, %d sequence counters\n",
+				eq.EquipmentId, eq.EquipmentType, eq.EquipmentSize, len(equipment.Payload), len(equipment.SeqCounters))
+			if equipment.FormatError != "" {
+				fmt.Printf("      Error reading common header: %s\n", equipment.FormatError)
+				continue
+			}
+			printEventFormat(equipment.Format)
+		}
+	}
+
+	fmt.Printf("Trigger configuration: %+v\n", output.Trigger)
+
+	summary := output.Summary
+	fmt.Printf("Summary: trigger type %d, timestamp %d\n", summary.TriggerType, summary.Timestamp)
+	fmt.Printf("  PMTs: %d channels, %d BLR channels, %d samples\n", summary.PmtChannels, summary.BlrChannels, summary.PmtSamples)
+	fmt.Printf("  SiPMs: %d channels, %d samples\n", summary.SipmChannels, summary.SipmSamples)
+	fmt.Printf("  Error: %t, desync: %t\n", summary.Error, summary.Desync)
+	for _, err := range summary.Errors {
+		fmt.Printf("  %s\n", err)
+	}
+
+	sort.SliceStable(output.Dumps, func(i, j int) bool { return output.Dumps[i].FecID < output.Dumps[j].FecID })
+	for _, dump := range output.Dumps {
+		fmt.Printf("FEC 0x%02x payload from word %d:\n", dump.FecID, dump.Offset)
+		printHexDump(dump)
+	}
+}
+
+// Readout modes of a FEC. PMT FECs flag compressed data with the zero
+// suppression bit (see ReadPmtFEC).
+func formatModes(format decoder.EventFormat) []string {
+	modes := make([]string, 0)
+	for _, mode := range []struct {
+		name string
+		set  bool
+	}{{"ZS", format.ZeroSuppression && format.FecType != 0},
+		{"compressed", format.CompressedData || (format.ZeroSuppression && format.FecType == 0)},
+		{"baseline", format.Baseline}, {"dual", format.DualModeBit}, {"error bit", format.ErrorBit}} {
+		if mode.set {
+			modes = append(modes, mode.name)
+		}
+	}
+	if len(modes) == 0 {
+		modes = append(modes, "raw")
+	}
+	return modes
+}
+
+func printEventFormat(format decoder.EventFormat) {
+	modes := formatModes(format)
+	fmt.Printf("      FEC 0x%02x (%s), FW %d, %s, %d channels, mask 0x%04x\n",
+		format.FecID, fecTypeName(format.FecType), format.FWVersion, strings.Join(modes, ", "),
+		format.NumberOfChannels, format.ChannelMask)
+	fmt.Printf("      Word count %d, header size %d, trigger type %d, trigger counter %d\n",
+		format.WordCount, format.HeaderSize, format.TriggerType, format.TriggerCounter)
+	fmt.Printf("      Buffer %d, pretrigger %d, buffer2 %d, pretrigger2 %d\n",
+		format.BufferSamples, format.PreTrigger, format.BufferSamples2, format.PreTrigger2)
+	fmt.Printf("      Timestamp %d, FT %d, FT bit %d\n", format.Timestamp, format.TriggerFT, format.FTBit)
+	if format.Baseline {
+		fmt.Printf("      Baselines %v\n", format.Baselines)
+	}
+}
+
+func printHexDump(dump PayloadDump) {
+	for i := 0; i < len(dump.Words); i += 8 {
+		end := i + 8
+		if end > len(dump.Words) {
+			end = len(dump.Words)
+		}
+		words := make([]string, 0, 8)
+		for _, word := range dump.Words[i:end] {
+			words = append(words, fmt.Sprintf("%04x", word))
+		}
+		fmt.Printf("  %06d: %s\n", dump.Offset+i, strings.Join(words, " "))
+	}
+}
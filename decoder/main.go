@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
@@ -10,103 +11,143 @@ import (
 
 	sqlx "github.com/jmoiron/sqlx"
 	decoder "github.com/next-exp/decoder_go/pkg"
+	// Register the output formats
+	_ "github.com/next-exp/decoder_go/pkg/arrowwriter"
+	_ "github.com/next-exp/decoder_go/pkg/hdf5writer"
 )
 
 var dbConn *sqlx.DB
 var configuration decoder.Configuration
 
-var (
-	logger         Logger
-	VerbosityLevel int
-	DiscardErrors  bool
-)
+var logger *slog.Logger
 
 func init() {
-	opts := &slog.HandlerOptions{
-		Level: slog.LevelDebug,
-	}
-	handlerStdOut := NewHandler(os.Stdout, opts)
-	handlerStdErr := slog.NewJSONHandler(os.Stderr, opts)
-	logger = Logger{
-		InfoLog:  slog.New(handlerStdOut),
-		ErrorLog: slog.New(handlerStdErr),
-	}
+	setLogger(decoder.DefaultConfiguration())
 }
 
 func main() {
-	configFilename := flag.String("config", "", "Configuration file path")
+	// Subcommands, decoding is the default
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "diff":
+			os.Exit(runDiff(os.Args[2:]))
+		case "inspect":
+			os.Exit(runInspect(os.Args[2:]))
+		case "scan":
+			os.Exit(runScan(os.Args[2:]))
+		case "batch":
+			os.Exit(runBatch(os.Args[2:]))
+		case "watch":
+			os.Exit(runWatch(os.Args[2:]))
+		case "replay":
+			os.Exit(runReplay(os.Args[2:]))
+		case "serve":
+			os.Exit(runServe(os.Args[2:]))
+		}
+	}
+
+	os.Exit(runDecode())
+}
+
+// Decodes the file given in the configuration. Returns the exit code, 1 if
+// the file could not be decoded.
+func runDecode() int {
+	configFilename := flag.String("config", "", "Configuration file path (.json, .yaml, .yml or .toml)")
+	printConfig := flag.Bool("print-config", false, "Print the effective configuration as JSON and exit")
+	metricsAddress := flag.String("metrics", "", "Serve Prometheus metrics on this address, e.g. :9100")
+	progressMode := flag.String("progress", "auto", "Progress report: auto, bar, log or off")
+	progressInterval := flag.Duration("progress-interval", 30*time.Second, "Time between progress lines in the log")
+	configFlags := decoder.NewConfigurationFlags(flag.CommandLine)
 	flag.Parse()
 
 	var err error
-	configuration, err = LoadConfiguration(*configFilename)
+	configuration, err = loadConfigurationLayers(*configFilename, configFlags)
 	if err != nil {
-		message := fmt.Errorf("Error reading configuration file: %w", err)
-		logger.Error(message.Error())
-		return
+		logger.Error("Error reading configuration", "error", err)
+		return 1
+	}
+	// Before opening any file or connecting to the database
+	if err := configuration.Validate(); err != nil {
+		logger.Error("Invalid configuration", "error", err)
+		return 1
+	}
+	if *printConfig {
+		data, err := json.MarshalIndent(configuration.Redacted(), "", "  ")
+		if err != nil {
+			logger.Error("Error encoding configuration", "error", err)
+			return 1
+		}
+		fmt.Println(string(data))
+		return 0
 	}
 	decoder.SetConfiguration(configuration)
-	decoder.SetLogger(logger)
+	setLogger(configuration)
 
-	VerbosityLevel = configuration.Verbosity
-	DiscardErrors = configuration.Discard
-	if VerbosityLevel > 0 {
-		message := fmt.Sprintf("Reading configuration file: %s", *configFilename)
-		logger.Info(message, "main")
-	}
-	if VerbosityLevel > 0 {
-		printConfiguration(configuration, logger)
+	decoder.ModuleLogger("main").Debug("Reading configuration file", "file", *configFilename)
+	printConfiguration(configuration)
+	warnUnroutedEvents(configuration)
+	if *metricsAddress != "" {
+		startMetricsServer(*metricsAddress)
 	}
 
 	dbConn, err = decoder.ConnectToDatabase(configuration.User, configuration.Passwd, configuration.Host, configuration.DBName)
 	if err != nil {
-		message := fmt.Errorf("Error connection to database: %w", err)
-		logger.Error(message.Error())
-		return
+		logger.Error("Error connection to database", "error", err)
+		return 1
 	}
 	defer dbConn.Close()
 
-	file, err := os.Open(configuration.FileIn)
-	if err != nil {
-		message := fmt.Errorf("Error opening file: %w", err)
-		logger.Error(message.Error())
-		return
-	}
-	defer file.Close()
-
-	// Create writers
-	var writer, writer2 *decoder.Writer
-	writer, err = decoder.NewWriter(configuration.FileOut)
-	if err != nil {
-		message := fmt.Errorf("Error creating writer for output file: %w", err)
-		logger.Error(message.Error())
-		return
-	}
-	if configuration.SplitTrg {
-		writer2, err = decoder.NewWriter(configuration.FileOut2)
+	var fileReader *FileReader
+	var evtsToRead int
+	if network, address, isStream := decoder.ParseStreamAddress(configuration.FileIn); isStream {
+		stream := decoder.NewStreamReader(network, address)
+		defer stream.Close()
+		fileReader = NewStreamFileReader(stream)
+	} else {
+		file, err := os.Open(configuration.FileIn)
 		if err != nil {
-			message := fmt.Errorf("Error creating writer for second output file: %w", err)
-			logger.Error(message.Error())
-			return
+			logger.Error("Error opening file", "error", err)
+			return 1
 		}
-		defer writer2.Close()
-	}
-	defer writer.Close()
+		defer file.Close()
 
-	evtCount, runNumber := countEvents(file)
-	evtsToRead := numberOfEventsToProcess(evtCount, configuration.Skip, configuration.MaxEvents)
-	if VerbosityLevel > 0 {
-		message := fmt.Sprintf("Number of events: %d", evtCount)
-		logger.Info(message, "main")
+		evtCount, runNumber := countEvents(file)
+		evtsToRead = numberOfEventsToProcess(evtCount, configuration.Skip, configuration.MaxEvents)
+		decoder.ModuleLogger("main").Info("Number of events", "events", evtCount, "run", runNumber)
+
+		decoder.LoadDatabase(dbConn, runNumber)
+
+		fileReader = NewFileReader(file)
 	}
 
-	decoder.LoadDatabase(dbConn, runNumber)
+	// Create the writers of the routes
+	router, err := decoder.OpenRouter(configuration.OutputRoutes(), configuration.FileOut)
+	if err != nil {
+		logger.Error("Error creating writers for output files", "error", err)
+		return 1
+	}
+	defer router.Close()
 
-	fileReader := NewFileReader(file)
+	progress, err := NewProgress(*progressMode, evtsToRead, *progressInterval)
+	if err != nil {
+		logger.Error("Invalid progress report", "error", err)
+		return 1
+	}
 
+	// A file that cannot be read to the end is a failure, the events read
+	// are still written
+	exitCode := 0
 	start := time.Now()
+	progress.Start()
 	if configuration.Parallel {
 		jobs := make(chan WorkerData, configuration.NumWorkers)
 		results := make(chan decoder.EventType, configuration.NumWorkers)
+		decoder.Metrics.Registry.NewGaugeFunc("decoder_pool_jobs", "Events waiting for a worker",
+			func() float64 { return float64(len(jobs)) })
+		decoder.Metrics.Registry.NewGaugeFunc("decoder_pool_results", "Decoded events waiting to be written",
+			func() float64 { return float64(len(results)) })
+		decoder.Metrics.Registry.NewGaugeFunc("decoder_pool_capacity", "Capacity of the worker queues",
+			func() float64 { return float64(configuration.NumWorkers) })
 
 		for w := 1; w <= configuration.NumWorkers; w++ {
 			go worker(w, jobs, results)
@@ -114,8 +155,8 @@ func main() {
 		go sendEventsToWorkers(fileReader, jobs)
 
 		if evtsToRead > 0 {
-			// TODO: This should be modified to write in parallel trigger1 and trigger2
-			processWorkerResults(results, writer, writer2, evtsToRead)
+			// TODO: This should be modified to write the outputs of the routes in parallel
+			processWorkerResults(results, router, evtsToRead)
 		}
 		close(results)
 	} else {
@@ -123,41 +164,37 @@ func main() {
 			header, eventData, err := fileReader.getNextEvent()
 			if err != nil {
 				if err != io.EOF {
-					message := fmt.Errorf("error reading event: %w", err)
-					logger.Error(message.Error())
+					logger.Error("Error reading event", "error", err)
+					exitCode = 1
 				}
 				break
 			}
-			processEvent(eventData, header, writer, writer2)
+			processEvent(eventData, header, router)
 		}
 	}
+	progress.Stop()
+	reportUnroutedEvents()
 	duration := time.Since(start)
 	fmt.Printf("Total time: %d ms\n", duration.Milliseconds())
+	return exitCode
 }
 
-func processEvent(eventData []byte, header decoder.EventHeaderStruct, writer *decoder.Writer, writer2 *decoder.Writer) {
+func processEvent(eventData []byte, header decoder.EventHeaderStruct, router *decoder.Router) {
 	defer func() {
 		if r := recover(); r != nil {
-			eventID := decoder.EventIdGetNbInRun(header.EventId)
-			errMessage := fmt.Errorf("decoder recovered from panic on event %d: %v", eventID, r)
-			logger.Error(errMessage.Error())
-			message := fmt.Sprintf("discarding event %d", eventID)
-			logger.Error(message)
+			logger.Error("Decoder recovered from panic, discarding event",
+				"event", decoder.EventIdGetNbInRun(header.EventId), "panic", r)
+			decoder.Metrics.EventsDiscarded.Inc("panic")
 		}
 	}()
 
 	event, err := decoder.ReadGDC(eventData, header)
 	if err != nil {
-		message := fmt.Errorf("error reading GDC data: %w", err)
-		logger.Error(message.Error())
-		return
-	}
-	if event.Error && DiscardErrors {
-		message := fmt.Sprintf("discarding event %d", event.EventID)
-		logger.Error(message)
+		logger.Error("Error reading GDC data", "error", err)
+		decoder.Metrics.EventsDiscarded.Inc("read_error")
 		return
 	}
-	decoder.ProcessDecodedEvent(event, configuration, writer, writer2)
+	decoder.ProcessDecodedEvent(event, configuration, router)
 }
 
 func numberOfEventsToProcess(fileEvtCount int, skipEvts int, maxEvtCount int) int {
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"net/http"
+
+	decoder "github.com/next-exp/decoder_go/pkg"
+)
+
+// Serves the decoder metrics on /metrics in the Prometheus text format. The
+// server runs until the decoder exits.
+func startMetricsServer(address string) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", decoder.Metrics.Registry)
+	go func() {
+		if err := http.ListenAndServe(address, mux); err != nil {
+			logger.Error("Error serving metrics", "error", err)
+		}
+	}()
+	decoder.ModuleLogger("main").Info("Serving metrics", "url", "http://"+address+"/metrics")
+}
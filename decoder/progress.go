@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	decoder "github.com/next-exp/decoder_go/pkg"
+)
+
+// Reports the events done so far, written or discarded, from the decoder
+// metrics. Events read are not counted, with parallel workers reading goes
+// well ahead of writing. On a terminal it draws a progress bar, otherwise it
+// logs a line every interval, which is what ends up in the batch system logs.
+type Progress struct {
+	total      int
+	interval   time.Duration
+	bar        bool
+	out        io.Writer
+	start      time.Time
+	startEvts  float64
+	startBytes float64
+	done       chan struct{}
+	stopped    chan struct{}
+}
+
+// mode is auto, bar, log or off. total is 0 when the number of events is
+// not known, reading from a stream.
+func NewProgress(mode string, total int, interval time.Duration) (*Progress, error) {
+	progress := &Progress{total: total, interval: interval, out: os.Stderr}
+	switch mode {
+	case "off":
+		return nil, nil
+	case "auto":
+		progress.bar = isTerminal(os.Stderr)
+	case "bar":
+		progress.bar = true
+	case "log":
+	default:
+		return nil, fmt.Errorf("invalid progress mode %q, use auto, bar, log or off", mode)
+	}
+	if progress.bar {
+		progress.interval = 200 * time.Millisecond
+	} else if interval <= 0 {
+		return nil, fmt.Errorf("invalid progress interval %s, it must be positive", interval)
+	}
+	return progress, nil
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (p *Progress) Start() {
+	if p == nil {
+		return
+	}
+	p.start = time.Now()
+	p.startEvts = eventsDone()
+	p.startBytes = decoder.Metrics.BytesRead.Value()
+	p.done = make(chan struct{})
+	p.stopped = make(chan struct{})
+	go func() {
+		defer close(p.stopped)
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+				p.report(false)
+			}
+		}
+	}()
+}
+
+// Reports the final numbers
+func (p *Progress) Stop() {
+	if p == nil {
+		return
+	}
+	close(p.done)
+	<-p.stopped
+	p.report(true)
+}
+
+func (p *Progress) report(final bool) {
+	elapsed := time.Since(p.start)
+	events := int(eventsDone() - p.startEvts)
+	bytes := decoder.Metrics.BytesRead.Value() - p.startBytes
+	if p.bar {
+		end := ""
+		if final {
+			end = "\n"
+		}
+		fmt.Fprintf(p.out, "\r%s%s", progressBar(events, p.total, elapsed, bytes), end)
+		return
+	}
+	decoder.ModuleLogger("progress").Info(progressLine(events, p.total, elapsed, bytes))
+}
+
+func eventsDone() float64 {
+	return decoder.Metrics.EventsWritten.Value() + decoder.Metrics.EventsDiscarded.Total()
+}
+
+func progressLine(events int, total int, elapsed time.Duration, bytes float64) string {
+	seconds := elapsed.Seconds()
+	if seconds == 0 {
+		seconds = 1
+	}
+	rate := float64(events) / seconds
+	line := fmt.Sprintf("%d events", events)
+	if total > 0 {
+		line = fmt.Sprintf("%d/%d events (%.1f%%)", events, total, 100*float64(events)/float64(total))
+	}
+	line += fmt.Sprintf(", %.1f events/s, %.1f MB/s", rate, bytes/1e6/seconds)
+	if total > 0 && rate > 0 && events < total {
+		eta := time.Duration(float64(total-events) / rate * float64(time.Second))
+		line += fmt.Sprintf(", ETA %s", eta.Round(time.Second))
+	}
+	return line
+}
+
+func progressBar(events int, total int, elapsed time.Duration, bytes float64) string {
+	const width = 30
+	if total <= 0 {
+		return progressLine(events, total, elapsed, bytes)
+	}
+	filled := width * events / total
+	if filled > width {
+		filled = width
+	}
+	return fmt.Sprintf("[%s%s] %s", strings.Repeat("=", filled), strings.Repeat(" ", width-filled),
+		progressLine(events, total, elapsed, bytes))
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	decoder "github.com/next-exp/decoder_go/pkg"
+)
+
+type replayOptions struct {
+	filename string
+	// Events per second, 0 for as fast as possible
+	hz float64
+	// Follow the DATE timestamps of the events
+	realtime bool
+	speed    float64
+	loop     bool
+}
+
+// Serves the events of a raw file over TCP, a Unix socket or HTTP, as the
+// DATE event builder does. Every client gets the file from the beginning.
+//
+//	decoder replay [-listen tcp://:5000] [-rate max|realtime|HZ] [-loop] file.rd
+func runReplay(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	listen := flags.String("listen", "tcp://:5000", "Address to serve the events: tcp://host:port, unix:///path or http://host:port")
+	rate := flags.String("rate", "max", "Events per second, realtime to follow the event timestamps or max for as fast as possible")
+	speed := flags.Float64("speed", 1, "Speed factor for realtime")
+	loop := flags.Bool("loop", false, "Start again at the end of the file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s replay [options] file.rd\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	options := replayOptions{filename: flags.Arg(0), speed: *speed, loop: *loop}
+	switch *rate {
+	case "max":
+	case "realtime":
+		options.realtime = true
+		if options.speed <= 0 {
+			logger.Error("Invalid speed", "speed", options.speed)
+			return 2
+		}
+	default:
+		hz, err := strconv.ParseFloat(*rate, 64)
+		if err != nil || hz <= 0 {
+			logger.Error("Invalid rate, use max, realtime or a number of events per second", "rate", *rate)
+			return 2
+		}
+		options.hz = hz
+	}
+	configuration = decoder.DefaultConfiguration()
+	decoder.SetConfiguration(configuration)
+	setLogger(configuration)
+
+	file, err := os.Open(options.filename)
+	if err != nil {
+		logger.Error("Error opening file", "error", err)
+		return 2
+	}
+	file.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if strings.HasPrefix(*listen, "http://") {
+		err = serveReplayHTTP(ctx, strings.TrimPrefix(*listen, "http://"), options)
+	} else if network, address, ok := decoder.ParseStreamAddress(*listen); ok {
+		err = serveReplayStream(ctx, network, address, options)
+	} else {
+		logger.Error("Invalid address", "address", *listen)
+		return 1
+	}
+	if err != nil {
+		logger.Error("Replay failed", "error", err)
+		return 1
+	}
+	return 0
+}
+
+func serveReplayStream(ctx context.Context, network string, address string, options replayOptions) error {
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+	decoder.ModuleLogger("replay").Info("Serving", "file", options.filename, "network", network,
+		"address", listener.Addr().String())
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			client := conn.RemoteAddr().String()
+			decoder.ModuleLogger("replay").Info("Client connected", "client", client)
+			nEvents, err := replayEvents(ctx, conn, nil, options)
+			logReplayEnd(client, nEvents, err)
+		}()
+	}
+}
+
+// GET /events streams the events in the body of the response
+func serveReplayHTTP(ctx context.Context, address string, options replayOptions) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		flush := func() {}
+		if flusher, ok := w.(http.Flusher); ok {
+			flush = flusher.Flush
+		}
+		decoder.ModuleLogger("replay").Info("Client connected", "client", r.RemoteAddr)
+		nEvents, err := replayEvents(r.Context(), w, flush, options)
+		logReplayEnd(r.RemoteAddr, nEvents, err)
+	})
+	server := &http.Server{Addr: address, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	decoder.ModuleLogger("replay").Info("Serving", "file", options.filename, "url", "http://"+address+"/events")
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func logReplayEnd(client string, nEvents int, err error) {
+	if err != nil {
+		logger.Error("Replay to client failed", "client", client, "error", err, "events", nEvents)
+		return
+	}
+	decoder.ModuleLogger("replay").Info("Client done", "client", client, "events", nEvents)
+}
+
+// Writes the events of the file at the requested rate. flush, if given, is
+// called after every event.
+func replayEvents(ctx context.Context, w io.Writer, flush func(), options replayOptions) (int, error) {
+	file, err := os.Open(options.filename)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	nEvents := 0
+	pace := newReplayPacer(options)
+	for ctx.Err() == nil {
+		header, eventData, err := decoder.ReadEventFromFile(file)
+		if err == io.EOF && options.loop && pace.count > 0 {
+			if _, err := file.Seek(0, io.SeekStart); err != nil {
+				return nEvents, err
+			}
+			pace = newReplayPacer(options)
+			continue
+		}
+		if err == io.EOF {
+			return nEvents, nil
+		}
+		if err != nil {
+			return nEvents, err
+		}
+
+		if err := pace.wait(ctx, header); err != nil {
+			return nEvents, nil
+		}
+		buffer := new(bytes.Buffer)
+		binary.Write(buffer, binary.LittleEndian, header)
+		buffer.Write(eventData)
+		if _, err := w.Write(buffer.Bytes()); err != nil {
+			return nEvents, err
+		}
+		if flush != nil {
+			flush()
+		}
+		nEvents++
+	}
+	return nEvents, nil
+}
+
+// Time at which each event is sent, from the start of the replay
+type replayPacer struct {
+	options   replayOptions
+	start     time.Time
+	count     int
+	firstTime float64
+}
+
+func newReplayPacer(options replayOptions) *replayPacer {
+	return &replayPacer{options: options, start: time.Now()}
+}
+
+func (p *replayPacer) wait(ctx context.Context, header decoder.EventHeaderStruct) error {
+	var offset time.Duration
+	switch {
+	case p.options.realtime:
+		eventTime := float64(header.EventTimestampSec) + float64(header.EventTimestampUsec)/1e6
+		if p.count == 0 {
+			p.firstTime = eventTime
+		}
+		offset = time.Duration((eventTime - p.firstTime) / p.options.speed * float64(time.Second))
+	case p.options.hz > 0:
+		offset = time.Duration(float64(p.count) / p.options.hz * float64(time.Second))
+	}
+	p.count++
+
+	delay := time.Until(p.start.Add(offset))
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
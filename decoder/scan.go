@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	decoder "github.com/next-exp/decoder_go/pkg"
+)
+
+var dateEventTypes = map[decoder.EventTypeType]string{
+	decoder.START_OF_RUN:                    "START_OF_RUN",
+	decoder.END_OF_RUN:                      "END_OF_RUN",
+	decoder.START_OF_RUN_FILES:              "START_OF_RUN_FILES",
+	decoder.END_OF_RUN_FILES:                "END_OF_RUN_FILES",
+	decoder.START_OF_BURST:                  "START_OF_BURST",
+	decoder.END_OF_BURST:                    "END_OF_BURST",
+	decoder.PHYSICS_EVENT:                   "PHYSICS_EVENT",
+	decoder.CALIBRATION_EVENT:               "CALIBRATION_EVENT",
+	decoder.EVENT_FORMAT_ERROR:              "EVENT_FORMAT_ERROR",
+	decoder.START_OF_DATA:                   "START_OF_DATA",
+	decoder.END_OF_DATA:                     "END_OF_DATA",
+	decoder.SYSTEM_SOFTWARE_TRIGGER_EVENT:   "SYSTEM_SOFTWARE_TRIGGER_EVENT",
+	decoder.DETECTOR_SOFTWARE_TRIGGER_EVENT: "DETECTOR_SOFTWARE_TRIGGER_EVENT",
+	decoder.SYNC_EVENT:                      "SYNC_EVENT",
+}
+
+func dateEventTypeName(eventType decoder.EventTypeType) string {
+	if name, found := dateEventTypes[eventType]; found {
+		return name
+	}
+	return fmt.Sprintf("UNKNOWN_%d", eventType)
+}
+
+// Configuration of a FEC as found in its common headers
+type FecSummary struct {
+	FecID         uint16
+	Type          string
+	FWVersion     uint16
+	Modes         []string
+	BufferSamples uint32
+	PreTrigger    uint32
+	Events        int
+	// Events where the configuration differs from the first one
+	Changes int
+}
+
+type ScanSummary struct {
+	Filename   string
+	RunNumber  int
+	Events     int
+	EventTypes map[string]int
+	// Physics and calibration events by trigger type
+	TriggerTypes map[uint16]int
+	Fecs         []FecSummary
+	FirstEvent   uint32
+	LastEvent    uint32
+	// Timestamps of the FECs, in ms
+	FirstTimestamp uint64
+	LastTimestamp  uint64
+	// Events per second, 0 if it cannot be computed
+	Rate float64
+	// Events with a different set of FECs than the first event
+	MissingFecs  int
+	HeaderErrors int
+	// Error that stopped the scan, empty if the whole file was read
+	ReadError string `json:",omitempty"`
+}
+
+// Summarizes a raw file reading only the headers.
+//
+//	decoder scan [-json] file.rd
+func runScan(args []string) int {
+	flags := flag.NewFlagSet("scan", flag.ExitOnError)
+	jsonOutput := flags.Bool("json", false, "Print the summary as JSON")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s scan [options] file.rd\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	configuration = decoder.DefaultConfiguration()
+	decoder.SetConfiguration(configuration)
+	setLogger(configuration)
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		logger.Error("Error opening file", "error", err)
+		return 2
+	}
+	defer file.Close()
+
+	summary := scanFile(file)
+	summary.Filename = flags.Arg(0)
+
+	if *jsonOutput {
+		data, err := json.MarshalIndent(summary, "", "  ")
+		if err != nil {
+			logger.Error("Error encoding summary", "error", err)
+			return 2
+		}
+		fmt.Println(string(data))
+	} else {
+		printScanSummary(summary)
+	}
+	if summary.ReadError != "" {
+		return 1
+	}
+	return 0
+}
+
+func scanFile(file *os.File) ScanSummary {
+	summary := ScanSummary{
+		EventTypes:   make(map[string]int),
+		TriggerTypes: make(map[uint16]int),
+		Fecs:         make([]FecSummary, 0),
+	}
+	fecs := make(map[uint16]*FecSummary)
+	var firstFecIDs []uint16
+	nRead := 0
+	var fileSize int64
+	if info, err := file.Stat(); err == nil {
+		fileSize = info.Size()
+	}
+
+	// As counting the events, only the headers are read and the payloads
+	// are skipped
+	for {
+		header, err := readEventHeader(file)
+		if err == nil {
+			// Seeking does not fail at the end of the file
+			position, _ := file.Seek(0, io.SeekCurrent)
+			if position+payloadSize(header) > fileSize {
+				err = io.ErrUnexpectedEOF
+			}
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				summary.ReadError = fmt.Sprintf("error reading entry %d of the file: %v", nRead, err)
+			}
+			break
+		}
+		nRead++
+		summary.RunNumber = int(header.EventRunNb)
+		summary.EventTypes[dateEventTypeName(header.EventType)]++
+		if !decoder.ValidEvent(header) {
+			file.Seek(payloadSize(header), io.SeekCurrent)
+			continue
+		}
+
+		eventID := decoder.EventIdGetNbInRun(header.EventId)
+		if summary.Events == 0 {
+			summary.FirstEvent = eventID
+		}
+		summary.LastEvent = eventID
+		summary.Events++
+
+		structure, err := decoder.ReadEventHeaders(file, header)
+		if err != nil {
+			summary.HeaderErrors++
+		}
+		fecIDs := make([]uint16, 0)
+		timestampRead := false
+		for _, ldc := range structure.Ldcs {
+			for _, equipment := range ldc.Equipments {
+				if equipment.FormatError != "" {
+					summary.HeaderErrors++
+					continue
+				}
+				format := equipment.Format
+				fecIDs = append(fecIDs, format.FecID)
+				if !timestampRead {
+					timestampRead = true
+					summary.TriggerTypes[format.TriggerType]++
+					if summary.Events == 1 || format.Timestamp < summary.FirstTimestamp {
+						summary.FirstTimestamp = format.Timestamp
+					}
+					if format.Timestamp > summary.LastTimestamp {
+						summary.LastTimestamp = format.Timestamp
+					}
+				}
+				addFec(fecs, format)
+			}
+		}
+
+		slices.Sort(fecIDs)
+		if firstFecIDs == nil {
+			firstFecIDs = fecIDs
+		} else if !slices.Equal(fecIDs, firstFecIDs) {
+			summary.MissingFecs++
+		}
+	}
+
+	for _, fec := range fecs {
+		summary.Fecs = append(summary.Fecs, *fec)
+	}
+	sort.Slice(summary.Fecs, func(i, j int) bool { return summary.Fecs[i].FecID < summary.Fecs[j].FecID })
+	if summary.Events > 1 && summary.LastTimestamp > summary.FirstTimestamp {
+		summary.Rate = float64(summary.Events-1) / (float64(summary.LastTimestamp-summary.FirstTimestamp) / 1000)
+	}
+	return summary
+}
+
+func addFec(fecs map[uint16]*FecSummary, format decoder.EventFormat) {
+	fec, found := fecs[format.FecID]
+	if !found {
+		fec = &FecSummary{
+			FecID:         format.FecID,
+			Type:          fecTypeName(format.FecType),
+			FWVersion:     format.FWVersion,
+			Modes:         formatModes(format),
+			BufferSamples: format.BufferSamples,
+			PreTrigger:    format.PreTrigger,
+		}
+		fecs[format.FecID] = fec
+	} else if fec.FWVersion != format.FWVersion || fec.BufferSamples != format.BufferSamples ||
+		fec.PreTrigger != format.PreTrigger || !slices.Equal(fec.Modes, formatModes(format)) {
+		fec.Changes++
+	}
+	fec.Events++
+}
+
+func printScanSummary(summary ScanSummary) {
+	fmt.Printf("File: %s\n", summary.Filename)
+	fmt.Printf("Run number: %d\n", summary.RunNumber)
+	fmt.Printf("Events: %d (%d to %d)\n", summary.Events, summary.FirstEvent, summary.LastEvent)
+
+	fmt.Println("DATE event types:")
+	names := make([]string, 0, len(summary.EventTypes))
+	for name := range summary.EventTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  %-32s %d\n", name, summary.EventTypes[name])
+	}
+
+	fmt.Println("Trigger types:")
+	triggerTypes := make([]uint16, 0, len(summary.TriggerTypes))
+	for triggerType := range summary.TriggerTypes {
+		triggerTypes = append(triggerTypes, triggerType)
+	}
+	slices.Sort(triggerTypes)
+	for _, triggerType := range triggerTypes {
+		fmt.Printf("  %-32d %d\n", triggerType, summary.TriggerTypes[triggerType])
+	}
+
+	fmt.Println("FECs:")
+	for _, fec := range summary.Fecs {
+		fmt.Printf("  0x%02x %-8s FW %d, %s, buffer %d, pretrigger %d, %d events",
+			fec.FecID, fec.Type, fec.FWVersion, strings.Join(fec.Modes, ", "),
+			fec.BufferSamples, fec.PreTrigger, fec.Events)
+		if fec.Changes > 0 {
+			fmt.Printf(", configuration changes in %d events", fec.Changes)
+		}
+		fmt.Println()
+	}
+
+	fmt.Printf("Timestamps: %d to %d ms\n", summary.FirstTimestamp, summary.LastTimestamp)
+	if summary.Rate > 0 {
+		fmt.Printf("Event rate: %.2f Hz\n", summary.Rate)
+	} else {
+		fmt.Println("Event rate: unknown")
+	}
+	if summary.MissingFecs > 0 {
+		fmt.Printf("Events with a different set of FECs: %d\n", summary.MissingFecs)
+	}
+	if summary.HeaderErrors > 0 {
+		fmt.Printf("Header errors: %d\n", summary.HeaderErrors)
+	}
+	if summary.ReadError != "" {
+		fmt.Printf("File could not be read to the end: %s\n", summary.ReadError)
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	decoder "github.com/next-exp/decoder_go/pkg"
+)
+
+//go:embed serve.html
+var servePage []byte
+
+// An event of the source, its position in the file or its data when it
+// comes from a stream
+type servedEvent struct {
+	offset int64
+	header decoder.EventHeaderStruct
+	data   []byte
+}
+
+type ServeInfo struct {
+	Source    string
+	Online    bool
+	Events    int
+	First     uint32
+	Last      uint32
+	RunNumber uint32
+}
+
+// Events that can be requested by number. Files are indexed in the
+// background, streams keep the last events received.
+type serveSource struct {
+	name   string
+	online bool
+	file   *os.File
+	keep   int
+
+	mu     sync.Mutex
+	events map[uint32]servedEvent
+	order  []uint32
+	latest servedEvent
+	count  int
+
+	// Decoding uses the configuration and the database of the package
+	decodeMu  sync.Mutex
+	runNumber int
+}
+
+// Serves the decoded events of a raw file or a stream as JSON, with a
+// minimal event display.
+//
+//	decoder serve [-http :8080] [-follow] [-config file] file.rd|tcp://host:port
+func runServe(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	address := flags.String("http", ":8080", "Address of the HTTP server")
+	configFilename := flags.String("config", "", "Configuration file, needed for the database (compressed data and sensor IDs)")
+	follow := flags.Bool("follow", false, "Follow a file still being written")
+	poll := flags.Duration("poll", time.Second, "Time between checks for new data with -follow")
+	keep := flags.Int("keep", 100, "Number of events kept from a stream")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s serve [options] file.rd|tcp://host:port|unix:///path\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	var err error
+	if *configFilename != "" {
+		configuration, err = LoadConfiguration(*configFilename)
+		if err != nil {
+			logger.Error("Error reading configuration file", "error", err)
+			return 2
+		}
+	} else {
+		configuration = decoder.DefaultConfiguration()
+		configuration.NoDB = true
+	}
+	decoder.SetConfiguration(configuration)
+	setLogger(configuration)
+
+	if !configuration.NoDB {
+		dbConn, err = decoder.ConnectToDatabase(configuration.User, configuration.Passwd, configuration.Host, configuration.DBName)
+		if err != nil {
+			logger.Error("Error connection to database", "error", err)
+			return 2
+		}
+		defer dbConn.Close()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	source := &serveSource{name: flags.Arg(0), keep: *keep, events: make(map[uint32]servedEvent), runNumber: -1}
+	if network, streamAddress, ok := decoder.ParseStreamAddress(source.name); ok {
+		source.online = true
+		stream := decoder.NewStreamReader(network, streamAddress)
+		go func() {
+			<-ctx.Done()
+			stream.Close()
+		}()
+		go source.read(ctx, stream.ReadEvent, nil)
+	} else {
+		source.file, err = os.Open(source.name)
+		if err != nil {
+			logger.Error("Error opening file", "error", err)
+			return 2
+		}
+		defer source.file.Close()
+		source.online = *follow
+		// Only the offsets are kept, the events are read again when requested
+		indexFile, err := os.Open(source.name)
+		if err != nil {
+			logger.Error("Error opening file", "error", err)
+			return 2
+		}
+		defer indexFile.Close()
+		finished := func() bool { return !*follow || ctx.Err() != nil }
+		reader := decoder.NewFollowReader(indexFile, *poll, finished)
+		go source.read(ctx, reader.ReadEvent, reader.Offset)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(servePage)
+	})
+	mux.HandleFunc("GET /api/info", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, source.info())
+	})
+	mux.HandleFunc("GET /api/events", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, source.eventNumbers())
+	})
+	mux.HandleFunc("GET /api/events/{event}", func(w http.ResponseWriter, r *http.Request) {
+		event, ok := source.latestEvent()
+		if r.PathValue("event") != "latest" {
+			eventID, err := strconv.ParseUint(r.PathValue("event"), 10, 32)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid event number"})
+				return
+			}
+			event, ok = source.event(uint32(eventID))
+		}
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "event not found"})
+			return
+		}
+		view, err := source.decode(event)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, view)
+	})
+
+	server := &http.Server{Addr: *address, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	decoder.ModuleLogger("serve").Info("Serving", "file", source.name, "url", "http://"+*address)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("Error serving", "error", err)
+		return 1
+	}
+	return 0
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		logger.Error("Error writing response", "error", err)
+	}
+}
+
+// Reads the events of the source until the end or until stopped. offset is
+// nil for streams, their events are kept in memory.
+func (s *serveSource) read(ctx context.Context, readEvent func() (decoder.EventHeaderStruct, []byte, error), offset func() int64) {
+	for ctx.Err() == nil {
+		var position int64
+		if offset != nil {
+			position = offset()
+		}
+		header, eventData, err := readEvent()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				logger.Error("Error reading event", "error", err)
+			}
+			break
+		}
+		if !decoder.ValidEvent(header) {
+			continue
+		}
+		event := servedEvent{offset: position, header: header}
+		if offset == nil {
+			event.data = eventData
+		}
+		s.add(event)
+	}
+	decoder.ModuleLogger("serve").Info("Finished reading", "file", s.name, "events", s.count)
+}
+
+func (s *serveSource) add(event servedEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	eventID := decoder.EventIdGetNbInRun(event.header.EventId)
+	if _, ok := s.events[eventID]; !ok {
+		s.order = append(s.order, eventID)
+	}
+	s.events[eventID] = event
+	s.latest = event
+	s.count++
+	if event.data != nil && len(s.order) > s.keep {
+		delete(s.events, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+func (s *serveSource) info() ServeInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := ServeInfo{Source: s.name, Online: s.online, Events: len(s.events), RunNumber: uint32(s.latest.header.EventRunNb)}
+	if len(s.order) > 0 {
+		info.First = s.order[0]
+		info.Last = s.order[len(s.order)-1]
+	}
+	return info
+}
+
+func (s *serveSource) eventNumbers() []uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	numbers := make([]uint32, 0, len(s.events))
+	for eventID := range s.events {
+		numbers = append(numbers, eventID)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	return numbers
+}
+
+func (s *serveSource) event(eventID uint32) (servedEvent, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	event, ok := s.events[eventID]
+	return event, ok
+}
+
+func (s *serveSource) latestEvent() (servedEvent, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.latest, s.count > 0
+}
+
+func (s *serveSource) decode(event servedEvent) (view decoder.EventView, err error) {
+	s.decodeMu.Lock()
+	defer s.decodeMu.Unlock()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("decoder recovered from panic: %v", r)
+		}
+	}()
+
+	header, eventData := event.header, event.data
+	if eventData == nil {
+		section := io.NewSectionReader(s.file, event.offset, math.MaxInt64-event.offset)
+		header, eventData, err = decoder.ReadEventFromFile(section)
+		if err != nil {
+			return view, fmt.Errorf("error reading event: %w", err)
+		}
+	}
+	if !configuration.NoDB && int(header.EventRunNb) != s.runNumber {
+		if err := decoder.LoadDatabase(dbConn, int(header.EventRunNb)); err != nil {
+			return view, err
+		}
+		s.runNumber = int(header.EventRunNb)
+	}
+
+	decoded, err := decoder.ReadGDC(eventData, header)
+	view = decoder.NewEventView(decoded)
+	if err != nil {
+		view.Errors = append(view.Errors, err.Error())
+	}
+	return view, nil
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	decoder "github.com/next-exp/decoder_go/pkg"
+)
+
+type watchOptions struct {
+	dir        string
+	pattern    string
+	outDir     string
+	rollEvents int
+	poll       time.Duration
+	idle       time.Duration
+	// Of the output files, given by the output format
+	extension string
+}
+
+// Decodes the raw files written to a directory as they appear. A file is
+// followed while the DAQ writes it, until a newer file appears, it does not
+// grow for -idle or the decoder is stopped.
+//
+//	decoder watch [-out-dir DIR] [-roll-events N] [options] dir
+func runWatch(args []string) int {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	configFilename := flags.String("config", "", "Configuration file path (.json, .yaml, .yml or .toml)")
+	options := watchOptions{}
+	flags.StringVar(&options.pattern, "pattern", "*.rd", "Raw files to decode")
+	flags.StringVar(&options.outDir, "out-dir", ".", "Directory of the output files")
+	flags.IntVar(&options.rollEvents, "roll-events", 0, "Start a new output file every N events, 0 for one output per raw file")
+	flags.DurationVar(&options.poll, "poll", time.Second, "Time between checks for new data")
+	flags.DurationVar(&options.idle, "idle", 5*time.Minute, "A file that does not grow for this time is finished")
+	metricsAddress := flags.String("metrics", "", "Serve Prometheus metrics on this address, e.g. :9100")
+	configFlags := decoder.NewConfigurationFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s watch [options] dir\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	options.dir = flags.Arg(0)
+
+	var err error
+	configuration, err = loadConfigurationLayers(*configFilename, configFlags)
+	if err != nil {
+		logger.Error("Error reading configuration", "error", err)
+		return 2
+	}
+	// Input and output files are set for each raw file
+	configuration.FileIn = options.dir
+	configuration.FileOut = filepath.Join(options.outDir, "output.h5")
+	configuration.FileOut2 = filepath.Join(options.outDir, "output_trg2.h5")
+	if err := configuration.Validate(); err != nil {
+		logger.Error("Invalid configuration", "error", err)
+		return 2
+	}
+	options.extension, err = decoder.OutputExtension(configuration)
+	if err != nil {
+		logger.Error("Invalid configuration", "error", err)
+		return 2
+	}
+	for _, route := range watchRoutes(configuration) {
+		if route.File != "" {
+			logger.Error("routes cannot have a file with watch, the outputs are named after each raw file, use suffix")
+			return 2
+		}
+	}
+	decoder.SetConfiguration(configuration)
+	setLogger(configuration)
+	warnUnroutedEvents(configuration)
+	if *metricsAddress != "" {
+		startMetricsServer(*metricsAddress)
+	}
+
+	if err := os.MkdirAll(options.outDir, 0755); err != nil {
+		logger.Error("Error creating output directory", "error", err)
+		return 2
+	}
+	dbConn, err = decoder.ConnectToDatabase(configuration.User, configuration.Passwd, configuration.Host, configuration.DBName)
+	if err != nil {
+		logger.Error("Error connection to database", "error", err)
+		return 2
+	}
+	defer dbConn.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	processed := make(map[string]bool)
+	for ctx.Err() == nil {
+		files, err := listRawFiles(options)
+		if err != nil {
+			logger.Error("Error listing raw files", "error", err)
+		}
+		for i, filename := range files {
+			if processed[filename] {
+				continue
+			}
+			processed[filename] = true
+			config := watchFileConfiguration(options, filename)
+			if runComplete(config) {
+				continue
+			}
+			// Files listed after this one are newer, the DAQ is done with it
+			newer := i+1 < len(files)
+			watchFile(ctx, options, config, newer)
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(options.poll):
+		}
+	}
+	reportUnroutedEvents()
+	decoder.ModuleLogger("watch").Info("Watch stopped")
+	return 0
+}
+
+// Raw files in the directory, the oldest first
+func listRawFiles(options watchOptions) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(options.dir, options.pattern))
+	if err != nil {
+		return nil, err
+	}
+	modTimes := make(map[string]time.Time)
+	for _, filename := range files {
+		info, err := os.Stat(filename)
+		if err == nil {
+			modTimes[filename] = info.ModTime()
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		ti, tj := modTimes[files[i]], modTimes[files[j]]
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return files[i] < files[j]
+	})
+	return files, nil
+}
+
+func watchFileConfiguration(options watchOptions, filename string) decoder.Configuration {
+	config := configuration
+	base := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	config.FileIn = filename
+	config.FileOut = filepath.Join(options.outDir, base+options.extension)
+	config.FileOut2 = filepath.Join(options.outDir, base+"_trg2"+options.extension)
+	return config
+}
+
+// Output file of a part of a raw file, rolling every rollEvents events. The
+// routes add their suffixes to it.
+func partFilename(options watchOptions, config decoder.Configuration, part int) string {
+	if options.rollEvents == 0 {
+		return config.FileOut
+	}
+	base := strings.TrimSuffix(config.FileOut, options.extension)
+	return fmt.Sprintf("%s_%04d%s", base, part, options.extension)
+}
+
+// Routes of the watched files. The outputs change with each raw file and
+// part, so split_trg sends the second trigger code to the _trg2 suffix
+// instead of to file_out2.
+func watchRoutes(config decoder.Configuration) decoder.Routes {
+	if len(config.Routes) == 0 && config.SplitTrg {
+		return decoder.Routes{
+			{TriggerTypes: []int{config.TrgCode1}},
+			{TriggerTypes: []int{config.TrgCode2}, Suffix: "_trg2"},
+		}
+	}
+	return config.OutputRoutes()
+}
+
+// Decodes a raw file while it is written
+func watchFile(ctx context.Context, options watchOptions, config decoder.Configuration, newer bool) {
+	decoder.ModuleLogger("watch").Info("Decoding", "file", config.FileIn)
+	file, err := os.Open(config.FileIn)
+	if err != nil {
+		logger.Error("Error opening file", "error", err)
+		return
+	}
+	defer file.Close()
+
+	var lastSize int64 = -1
+	lastGrowth := time.Now()
+	finished := func() bool {
+		if newer || ctx.Err() != nil {
+			return true
+		}
+		if files, err := listRawFiles(options); err == nil && len(files) > 0 && files[len(files)-1] != config.FileIn {
+			return true
+		}
+		if info, err := file.Stat(); err == nil && info.Size() != lastSize {
+			lastSize = info.Size()
+			lastGrowth = time.Now()
+		}
+		return time.Since(lastGrowth) > options.idle
+	}
+	reader := decoder.NewFollowReader(file, options.poll, finished)
+
+	var router *decoder.Router
+	routes := watchRoutes(config)
+	outputs := make([]string, 0)
+	closeWriters := func() {
+		if router != nil {
+			if err := router.Close(); err != nil {
+				logger.Error("Error closing output files", "error", err)
+			}
+		}
+		router = nil
+	}
+	defer closeWriters()
+
+	part := 0
+	eventsInPart := 0
+	runNumber := -1
+	for {
+		header, eventData, err := reader.ReadEvent()
+		if err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				logger.Error("File ends with a partial event", "file", config.FileIn)
+			} else if err != io.EOF {
+				logger.Error("Error reading event", "error", err)
+			}
+			break
+		}
+		if !decoder.ValidEvent(header) {
+			continue
+		}
+		decoder.Metrics.EventsRead.Inc()
+		decoder.Metrics.BytesRead.Add(float64(header.EventSize))
+		if int(header.EventRunNb) != runNumber {
+			runNumber = int(header.EventRunNb)
+			decoder.LoadDatabase(dbConn, runNumber)
+		}
+
+		if router == nil {
+			filename := partFilename(options, config, part)
+			router, err = decoder.OpenRouter(routes, filename)
+			if err != nil {
+				logger.Error("Error creating writers for output files", "error", err)
+				return
+			}
+			for _, routeFile := range routes.Filenames(filename) {
+				files, _ := decoder.OutputFilenames(routeFile, config)
+				outputs = append(outputs, files...)
+			}
+		}
+
+		processEvent(eventData, header, router)
+		eventsInPart++
+		if options.rollEvents > 0 && eventsInPart >= options.rollEvents {
+			closeWriters()
+			part++
+			eventsInPart = 0
+		}
+	}
+	closeWriters()
+
+	// Stopped before the DAQ finished the file, it is decoded again later
+	if ctx.Err() != nil && !newer {
+		return
+	}
+	if err := writeCompletionMarker(config, outputs); err != nil {
+		logger.Error("Error writing completion marker", "error", err)
+	}
+	decoder.ModuleLogger("watch").Info("Finished", "file", config.FileIn, "outputs", len(outputs))
+}
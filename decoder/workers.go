@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fmt"
 	"io"
 	"time"
 
@@ -14,57 +13,61 @@ type WorkerData struct {
 }
 
 func worker(id int, jobs <-chan WorkerData, results chan<- decoder.EventType) {
+	log := decoder.ModuleLogger("workers")
+	for event := range jobs {
+		log.Debug("Processing event", "worker", id, "event", decoder.EventIdGetNbInRun(event.Header.EventId))
+		results <- decodeWorkerData(id, event)
+	}
+}
+
+// Decoding errors are kept in the event. Recovering here is only a last
+// resort, so a single event cannot stop the worker.
+func decodeWorkerData(id int, data WorkerData) (event decoder.EventType) {
 	defer func() {
 		if r := recover(); r != nil {
-			fmt.Printf("Worker %d recovered from panic: %v\n", id, r)
-			results <- decoder.EventType{Error: true}
+			decoder.ModuleLogger("workers").Error("Worker recovered from panic", "worker", id,
+				"event", decoder.EventIdGetNbInRun(data.Header.EventId), "panic", r)
+			decoder.Metrics.EventsDiscarded.Inc("panic")
+			event = decoder.EventType{
+				EventID: decoder.EventIdGetNbInRun(data.Header.EventId),
+				Error:   true,
+			}
 		}
 	}()
 
-	for event := range jobs {
-		fmt.Printf("Worker %d processing event %d\n", id, event.Header.EventId)
-		//fmt.Println("Data size:", len(event.Data), "Header: ", event.Header)
-		event, _ := decoder.ReadGDC(event.Data, event.Header)
-		results <- event
+	event, err := decoder.ReadGDC(data.Data, data.Header)
+	if err != nil {
+		decoder.ModuleLogger("workers").Error("Error reading GDC data", "worker", id,
+			"event", decoder.EventIdGetNbInRun(data.Header.EventId), "error", err)
 	}
+	return event
 }
 
 func sendEventsToWorkers(fileReader *FileReader, jobs chan<- WorkerData) {
+	log := decoder.ModuleLogger("workers")
 	for {
 		header, eventData, err := fileReader.getNextEvent()
-		fmt.Printf("Reading event %d\n", decoder.EventIdGetNbInRun(header.EventId))
 		if err != nil {
-			fmt.Println("Error reading event:", err)
-			break
-		}
-		if err == io.EOF {
+			if err != io.EOF {
+				log.Error("Error reading event", "error", err)
+			}
 			break
 		}
+		log.Debug("Reading event", "event", decoder.EventIdGetNbInRun(header.EventId))
 		jobs <- WorkerData{Data: eventData, Header: header}
 	}
 	close(jobs)
 }
 
-func processWorkerResults(results chan decoder.EventType, writer *decoder.Writer,
-	writer2 *decoder.Writer, evtsToRead int) {
+func processWorkerResults(results chan decoder.EventType, router *decoder.Router, evtsToRead int) {
+	log := decoder.ModuleLogger("workers")
 	evtsProcessed := 0
 	var totalTime int64 = 0
-	fmt.Println("Waiting for events")
+	log.Debug("Waiting for events")
 	for event := range results {
-		fmt.Println("Processed event: ", evtsProcessed, event.EventID)
+		log.Debug("Processed event", "count", evtsProcessed, "event", event.EventID)
 		start := time.Now()
-		if configuration.WriteData && !event.Error {
-			if configuration.SplitTrg {
-				switch int(event.TriggerType) {
-				case configuration.TrgCode1:
-					writer.WriteEvent(&event)
-				case configuration.TrgCode2:
-					writer2.WriteEvent(&event)
-				}
-			} else {
-				writer.WriteEvent(&event)
-			}
-		}
+		decoder.ProcessDecodedEvent(event, configuration, router)
 
 		evtsProcessed++
 		if evtsProcessed >= evtsToRead {
@@ -74,5 +77,5 @@ func processWorkerResults(results chan decoder.EventType, writer *decoder.Writer
 		duration := time.Since(start)
 		totalTime += duration.Milliseconds()
 	}
-	fmt.Println("Total time writing: ", totalTime)
+	log.Debug("Total time writing", "ms", totalTime)
 }
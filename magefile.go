@@ -19,6 +19,7 @@ var Default = Build
 func Build() error {
 	mg.Deps(BuildDecoder)
 	mg.Deps(BuildMeasureAlgos)
+	mg.Deps(BuildRdgen)
 	fmt.Println("Compilation finished")
 	return nil
 }
@@ -50,3 +51,13 @@ func BuildMeasureAlgos() error {
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
+
+// rdgen only uses pkg, it does not need HDF5
+func BuildRdgen() error {
+	fmt.Println("Building rdgen executable...")
+	cmd := exec.Command("go", "build", "-o", "./bin/rdgen", "./rdgen")
+	cmd.Env = append(os.Environ(), "CGO_ENABLED=0")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -1,68 +1,43 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
-	"os"
-
 	decoder "github.com/next-exp/decoder_go/pkg"
 )
 
 func LoadConfiguration(filename string) (decoder.Configuration, error) {
-	var config decoder.Configuration
-
-	// Set default values
-	config.MaxEvents = 1000000000
-	config.Verbosity = 0
-	config.ExtTrigger = 15
-	config.TrgCode1 = 1
-	config.TrgCode2 = 9
-	config.ReadPMTs = true
-	config.ReadSiPMs = true
-	config.ReadTrigger = true
-	config.SplitTrg = false
-	config.NoDB = false
-	config.Discard = true
-	config.Skip = 0
-	config.Host = "next.ific.uv.es"
-	config.User = "nextreader"
-	config.Passwd = "readonly"
-	config.DBName = "NEXT100"
-	config.NumWorkers = 1
-	config.WriteData = true
-	config.Parallel = false
-	config.UseBlosc = false
-	config.CompressionLevel = 4
+	config := decoder.DefaultConfiguration()
 
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return config, err
-	}
-	err = json.Unmarshal(data, &config)
+	err := decoder.ReadConfigurationFile(filename, &config)
 	if err != nil {
 		return config, err
 	}
 	return config, nil
 }
 
-func printConfiguration(config decoder.Configuration, logger Logger) {
-	logger.Info(fmt.Sprintf("File in: %s", config.FileIn), "config")
-	logger.Info(fmt.Sprintf("File out: %s", config.FileOut), "config")
-	logger.Info(fmt.Sprintf("File out2: %s", config.FileOut2), "config")
-	logger.Info(fmt.Sprintf("No DB: %t", config.NoDB), "config")
-	logger.Info(fmt.Sprintf("Host: %s", config.Host), "config")
-	logger.Info(fmt.Sprintf("DB name: %s", config.DBName), "config")
-	logger.Info(fmt.Sprintf("Read PMTs: %t", config.ReadPMTs), "config")
-	logger.Info(fmt.Sprintf("Read SiPMs: %t", config.ReadSiPMs), "config")
-	logger.Info(fmt.Sprintf("Read trigger: %t", config.ReadTrigger), "config")
-	logger.Info(fmt.Sprintf("Skip: %d", config.Skip), "config")
-	logger.Info(fmt.Sprintf("Max events: %d", config.MaxEvents), "config")
-	logger.Info(fmt.Sprintf("Verbosity: %d", config.Verbosity), "config")
-	logger.Info(fmt.Sprintf("Split trigger: %t", config.SplitTrg), "config")
-	logger.Info(fmt.Sprintf("Trigger code 1: %d", config.TrgCode1), "config")
-	logger.Info(fmt.Sprintf("Trigger code 2: %d", config.TrgCode2), "config")
-	logger.Info(fmt.Sprintf("Discard: %t", config.Discard), "config")
-	logger.Info(fmt.Sprintf("Write data: %t", config.WriteData), "config")
-	logger.Info(fmt.Sprintf("Number of workers: %d", config.NumWorkers), "config")
-	logger.Info(fmt.Sprintf("Parallel: %t", config.Parallel), "config")
+func printConfiguration(config decoder.Configuration) {
+	decoder.ModuleLogger("config").Debug("Configuration",
+		"file_in", config.FileIn,
+		"file_out", config.FileOut,
+		"file_out2", config.FileOut2,
+		"no_db", config.NoDB,
+		"host", config.Host,
+		"dbname", config.DBName,
+		"read_pmts", config.ReadPMTs,
+		"read_sipms", config.ReadSiPMs,
+		"read_trigger", config.ReadTrigger,
+		"skip", config.Skip,
+		"max_events", config.MaxEvents,
+		"log_level", decoder.LogLevelName(config.Level()),
+		"log_modules", config.LogModules,
+		"split_trg", config.SplitTrg,
+		"trg_code1", config.TrgCode1,
+		"trg_code2", config.TrgCode2,
+		"discard", config.Discard,
+		"keep_partial", config.KeepPartial,
+		"check_fec_sync", config.CheckFecSync,
+		"discard_desync", config.DiscardDesync,
+		"check_word_count", config.CheckWordCount,
+		"write_data", config.WriteData,
+		"num_workers", config.NumWorkers,
+		"parallel", config.Parallel)
 }
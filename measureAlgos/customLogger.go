@@ -7,73 +7,112 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"os"
 	"strings"
 	"sync"
+
+	decoder "github.com/next-exp/decoder_go/pkg"
 )
 
-type Logger struct {
-	InfoLog  *slog.Logger
-	ErrorLog *slog.Logger
+// Logger of the configuration, here and in pkg. Below warning the records
+// go to stdout and warnings and errors go to stderr as JSON.
+func setLogger(config decoder.Configuration) {
+	opts := &slog.HandlerOptions{Level: decoder.LevelTrace}
+	handler := &splitHandler{out: NewHandler(os.Stdout, opts), err: slog.NewJSONHandler(os.Stderr, opts)}
+	// Already checked validating the configuration
+	modules, _ := decoder.ParseModuleLevels(config.LogModules)
+	logger = slog.New(decoder.NewLevelHandler(handler, config.Level(), modules))
+	decoder.SetLogger(logger)
+}
+
+// Sends warnings and errors to err and the rest to out
+type splitHandler struct {
+	out slog.Handler
+	err slog.Handler
+}
+
+func (h *splitHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if level >= slog.LevelWarn {
+		return h.err.Enabled(ctx, level)
+	}
+	return h.out.Enabled(ctx, level)
+}
+
+func (h *splitHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelWarn {
+		return h.err.Handle(ctx, r)
+	}
+	return h.out.Handle(ctx, r)
 }
 
-func (l Logger) Info(message string, module string) {
-	l.InfoLog.Info(message, "module", module)
+func (h *splitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &splitHandler{out: h.out.WithAttrs(attrs), err: h.err.WithAttrs(attrs)}
 }
 
-func (l Logger) Error(message string) {
-	l.ErrorLog.Error(message)
+func (h *splitHandler) WithGroup(name string) slog.Handler {
+	return &splitHandler{out: h.out.WithGroup(name), err: h.err.WithGroup(name)}
 }
 
 ////////////
 
+// Writes "[time] [module] message key=value..."
 type Handler struct {
-	h   slog.Handler
-	mu  *sync.Mutex
-	out io.Writer
+	level slog.Leveler
+	attrs []slog.Attr
+	mu    *sync.Mutex
+	out   io.Writer
 }
 
 func NewHandler(o io.Writer, opts *slog.HandlerOptions) *Handler {
 	if opts == nil {
 		opts = &slog.HandlerOptions{}
 	}
+	level := opts.Level
+	if level == nil {
+		level = slog.LevelInfo
+	}
 	return &Handler{
-		out: o,
-		h: slog.NewTextHandler(o, &slog.HandlerOptions{
-			Level:       opts.Level,
-			AddSource:   opts.AddSource,
-			ReplaceAttr: nil,
-		}),
-		mu: &sync.Mutex{},
+		out:   o,
+		level: level,
+		mu:    &sync.Mutex{},
 	}
 }
 
 func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
-	return h.h.Enabled(ctx, level)
+	return level >= h.level.Level()
 }
 
 func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	return &Handler{h: h.h.WithAttrs(attrs), out: h.out, mu: h.mu}
+	withAttrs := *h
+	withAttrs.attrs = append(append([]slog.Attr{}, h.attrs...), attrs...)
+	return &withAttrs
 }
 
 func (h *Handler) WithGroup(name string) slog.Handler {
-	return &Handler{h: h.h.WithGroup(name), out: h.out, mu: h.mu}
+	return h
 }
 
 func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
 
 	formattedTime := r.Time.Format("[2006/01/02 15:04:05]")
 
-	//add time and message to values
+	//add time, module and message to values
 	strs := []string{formattedTime}
-
-	if r.NumAttrs() != 0 {
-		r.Attrs(func(a slog.Attr) bool {
-			value := fmt.Sprintf("[%s]", a.Value.String())
-			strs = append(strs, value)
-			return true
-		})
+	values := make([]string, 0)
+	addAttr := func(a slog.Attr) bool {
+		if a.Key == "module" {
+			strs = append(strs, fmt.Sprintf("[%s]", a.Value.String()))
+		} else {
+			values = append(values, fmt.Sprintf("%s=%s", a.Key, a.Value.String()))
+		}
+		return true
+	}
+	for _, attr := range h.attrs {
+		addAttr(attr)
 	}
+	r.Attrs(addAttr)
 	strs = append(strs, r.Message)
+	strs = append(strs, values...)
 	strs = append(strs, "\n")
 
 	result := strings.Join(strs, " ")
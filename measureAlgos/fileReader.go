@@ -2,8 +2,8 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
-	"fmt"
 	"io"
 	"os"
 	"unsafe"
@@ -29,27 +29,21 @@ func (f *FileReader) getNextEvent() (decoder.EventHeaderStruct, []byte, error) {
 		return f.getNextEvent()
 	}
 	f.EvtCount++
+	log := decoder.ModuleLogger("fileReader")
 	if f.EvtCount >= configuration.MaxEvents {
-		if VerbosityLevel > 0 {
-			logger.Info("Max events reached", "fileReader")
-		}
+		log.Debug("Max events reached", "max_events", configuration.MaxEvents)
 		return header, nil, io.EOF
 	}
 	if f.EvtCount < configuration.Skip {
-		if VerbosityLevel > 0 {
-			message := fmt.Sprintf("Skipping event %d with ID %d", f.EvtCount, decoder.EventIdGetNbInRun(header.EventId))
-			logger.Info(message, "fileReader")
-		}
+		log.Debug("Skipping event", "count", f.EvtCount, "event", decoder.EventIdGetNbInRun(header.EventId))
 		return f.getNextEvent()
 	}
-	if VerbosityLevel > 0 {
-		message := fmt.Sprintf("Reading event %d with ID %d", f.EvtCount, decoder.EventIdGetNbInRun(header.EventId))
-		logger.Info(message, "fileReader")
-	}
+	log.Debug("Reading event", "count", f.EvtCount, "event", decoder.EventIdGetNbInRun(header.EventId))
 	return header, eventData, nil
 }
 
 func countEvents(file *os.File) (int, int) {
+	log := decoder.ModuleLogger("evtCounter")
 	evtCount := 0
 	runNumber := 0
 	for {
@@ -59,33 +53,26 @@ func countEvents(file *os.File) (int, int) {
 		nRead, err := file.Read(headerBinary)
 		if err != nil {
 			if err != io.EOF {
-				errMessage := fmt.Errorf("error reading header counting events: %w", err)
-				logger.Error(errMessage.Error())
+				log.Error("Error reading header counting events", "error", err)
 			}
 			break
 		}
 		if nRead == 0 {
-			if VerbosityLevel > 1 {
-				logger.Info("End of file", "evtCounter")
-			}
+			log.Log(context.Background(), decoder.LevelTrace, "End of file")
 			break
 		}
 
 		headerReader := bytes.NewReader(headerBinary)
 		binary.Read(headerReader, binary.LittleEndian, &header)
-		if VerbosityLevel > 1 {
-			message := fmt.Sprintf("Evt id: %d. GDC %d", decoder.EventIdGetNbInRun(header.EventId), header.EventGdcId)
-			logger.Info(message, "evtCounter")
-		}
+		log.Log(context.Background(), decoder.LevelTrace, "Event header",
+			"event", decoder.EventIdGetNbInRun(header.EventId), "gdc", header.EventGdcId)
 		runNumber = int(header.EventRunNb)
 		payloadSize := uint32(header.EventSize) - uint32(headerSize)
 		file.Seek(int64(payloadSize), 1)
 
 		if !decoder.ValidEvent(header) {
-			if VerbosityLevel > 1 {
-				message := fmt.Sprintf("Skipping invalid event: %d", decoder.EventIdGetNbInRun(header.EventId))
-				logger.Info(message, "evtCounter")
-			}
+			log.Log(context.Background(), decoder.LevelTrace, "Skipping invalid event",
+				"event", decoder.EventIdGetNbInRun(header.EventId))
 			continue
 		}
 		evtCount++
@@ -2,7 +2,6 @@ package main
 
 import (
 	"flag"
-	"fmt"
 	"log/slog"
 	"os"
 	"time"
@@ -10,32 +9,20 @@ import (
 	_ "github.com/ianlancetaylor/cgosymbolizer"
 	sqlx "github.com/jmoiron/sqlx"
 	decoder "github.com/next-exp/decoder_go/pkg"
-	"github.com/next-exp/hdf5-go"
+	hdf5writer "github.com/next-exp/decoder_go/pkg/hdf5writer"
 )
 
 var dbConn *sqlx.DB
 var configuration decoder.Configuration
 
-var (
-	logger         Logger
-	VerbosityLevel int
-	DiscardErrors  bool
-)
+var logger *slog.Logger
 
 func init() {
-	opts := &slog.HandlerOptions{
-		Level: slog.LevelDebug,
-	}
-	handlerStdOut := NewHandler(os.Stdout, opts)
-	handlerStdErr := slog.NewJSONHandler(os.Stderr, opts)
-	logger = Logger{
-		InfoLog:  slog.New(handlerStdOut),
-		ErrorLog: slog.New(handlerStdErr),
-	}
+	setLogger(decoder.DefaultConfiguration())
 }
 
 func main() {
-	configFilename := flag.String("config", "", "Configuration file path")
+	configFilename := flag.String("config", "", "Configuration file path (.json, .yaml, .yml or .toml)")
 	algorithm := flag.String("algorithm", "blosclz", "Blosc algorithm")
 	noBlosc := flag.Bool("no-blosc", false, "Do not use blosc")
 	flag.Parse()
@@ -43,51 +30,43 @@ func main() {
 	var err error
 	configuration, err = LoadConfiguration(*configFilename)
 	if err != nil {
-		message := fmt.Errorf("Error reading configuration file: %w", err)
-		logger.Error(message.Error())
+		logger.Error("Error reading configuration file", "error", err)
+		return
+	}
+	if err := configuration.Validate(); err != nil {
+		logger.Error("Invalid configuration", "error", err)
 		return
 	}
 	decoder.SetConfiguration(configuration)
-	decoder.SetLogger(logger)
+	setLogger(configuration)
+	log := decoder.ModuleLogger("main")
 
 	if *noBlosc {
 		configuration.UseBlosc = false
 	} else {
 		configuration.BloscAlgorithm = parseAlgorithm(*algorithm)
-		fmt.Println("Blosc algorithm: ", configuration.BloscAlgorithm)
+		log.Info("Blosc algorithm", "algorithm", configuration.BloscAlgorithm.Name)
 	}
 
-	VerbosityLevel = configuration.Verbosity
-	DiscardErrors = configuration.Discard
-	if VerbosityLevel > 0 {
-		message := fmt.Sprintf("Reading configuration file: %s", *configFilename)
-		logger.Info(message, "main")
-	}
-	if VerbosityLevel > 0 {
-		printConfiguration(configuration, logger)
-	}
+	log.Debug("Reading configuration file", "file", *configFilename)
+	printConfiguration(configuration)
 
 	dbConn, err = decoder.ConnectToDatabase(configuration.User, configuration.Passwd, configuration.Host, configuration.DBName)
 	if err != nil {
-		message := fmt.Errorf("Error connection to database: %w", err)
-		logger.Error(message.Error())
+		logger.Error("Error connection to database", "error", err)
 		return
 	}
 	defer dbConn.Close()
 
 	file, err := os.Open(configuration.FileIn)
 	if err != nil {
-		message := fmt.Errorf("Error opening file: %w", err)
-		logger.Error(message.Error())
+		logger.Error("Error opening file", "error", err)
 		return
 	}
 	defer file.Close()
 
 	evtCount, runNumber := countEvents(file)
-	if VerbosityLevel > 0 {
-		message := fmt.Sprintf("Number of events: %d", evtCount)
-		logger.Info(message, "main")
-	}
+	log.Debug("Number of events", "events", evtCount)
 
 	decoder.LoadDatabase(dbConn, runNumber)
 
@@ -109,22 +88,21 @@ func main() {
 			break
 		}
 	}
-	fmt.Println("Total events processed: ", len(decodedEvents))
+	log.Info("Total events processed", "events", len(decodedEvents))
 
 	// Create writers
 	for compressionLevel := 0; compressionLevel < 10; compressionLevel++ {
 		if configuration.UseBlosc {
 			for _, shuffle := range shuffles {
-				//for i := 0; i < 3; i++ {
-				fmt.Println("Algorithm: ", configuration.BloscAlgorithm.Name, "Compression level: ", compressionLevel, "Shuffle: ", shuffle.Name)
+				log.Info("Writing", "algorithm", configuration.BloscAlgorithm.Name,
+					"compression_level", compressionLevel, "shuffle", shuffle.Name)
 				configuration.BloscShuffle = shuffle
 				configuration.CompressionLevel = compressionLevel
 				decoder.SetConfiguration(configuration)
 				start := time.Now()
-				writer, err := decoder.NewWriter(configuration.FileOut)
+				writer, err := hdf5writer.NewWriter(configuration.FileOut)
 				if err != nil {
-					message := fmt.Errorf("Error creating writer for output file: %w", err)
-					logger.Error(message.Error())
+					logger.Error("Error creating writer for output file", "error", err)
 					return
 				}
 				processWorkerResults(decodedEvents, writer)
@@ -132,22 +110,21 @@ func main() {
 				duration := time.Since(start)
 				fileInfo, err := os.Stat(configuration.FileOut)
 				if err != nil {
-					logger.Error(fmt.Sprintf("Error getting file info: %v", err))
+					logger.Error("Error getting file info", "error", err)
 					continue
 				}
-				fmt.Printf("(%s, comp %d, %s) Time: %d ms, size %d bytes\n", configuration.BloscAlgorithm.Name, compressionLevel, shuffle.Name, duration.Milliseconds(), fileInfo.Size())
-				//	}
+				log.Info("Written", "algorithm", configuration.BloscAlgorithm.Name, "compression_level", compressionLevel,
+					"shuffle", shuffle.Name, "ms", duration.Milliseconds(), "bytes", fileInfo.Size())
 			}
 		} else {
 			for i := 0; i < 3; i++ {
-				fmt.Println("Algorithm: standard hdf5, Compression level: ", compressionLevel)
+				log.Info("Writing", "algorithm", "hdf5", "compression_level", compressionLevel)
 				configuration.CompressionLevel = compressionLevel
 				decoder.SetConfiguration(configuration)
 				start := time.Now()
-				writer, err := decoder.NewWriter(configuration.FileOut)
+				writer, err := hdf5writer.NewWriter(configuration.FileOut)
 				if err != nil {
-					message := fmt.Errorf("Error creating writer for output file: %w", err)
-					logger.Error(message.Error())
+					logger.Error("Error creating writer for output file", "error", err)
 					return
 				}
 				processWorkerResults(decodedEvents, writer)
@@ -155,42 +132,34 @@ func main() {
 				duration := time.Since(start)
 				fileInfo, err := os.Stat(configuration.FileOut)
 				if err != nil {
-					logger.Error(fmt.Sprintf("Error getting file info: %v", err))
+					logger.Error("Error getting file info", "error", err)
 					continue
 				}
-				fmt.Printf("(hdf5, comp %d) Time: %d ms, size %d bytes\n", compressionLevel, duration.Milliseconds(), fileInfo.Size())
+				log.Info("Written", "algorithm", "hdf5", "compression_level", compressionLevel,
+					"ms", duration.Milliseconds(), "bytes", fileInfo.Size())
 			}
 
 		}
 	}
 
 	duration := time.Since(start)
-	fmt.Printf("Total time: %d ms\n", duration.Milliseconds())
+	log.Info("Total time", "ms", duration.Milliseconds())
 }
 
-func processEvent(eventData []byte, header decoder.EventHeaderStruct, writer *decoder.Writer, writer2 *decoder.Writer) {
+func processEvent(eventData []byte, header decoder.EventHeaderStruct, router *decoder.Router) {
 	defer func() {
 		if r := recover(); r != nil {
-			eventID := decoder.EventIdGetNbInRun(header.EventId)
-			errMessage := fmt.Errorf("decoder recovered from panic on event %d: %v", eventID, r)
-			logger.Error(errMessage.Error())
-			message := fmt.Sprintf("discarding event %d", eventID)
-			logger.Error(message)
+			logger.Error("Decoder recovered from panic, discarding event",
+				"event", decoder.EventIdGetNbInRun(header.EventId), "panic", r)
 		}
 	}()
 
 	event, err := decoder.ReadGDC(eventData, header)
 	if err != nil {
-		message := fmt.Errorf("error reading GDC data: %w", err)
-		logger.Error(message.Error())
-		return
-	}
-	if event.Error && DiscardErrors {
-		message := fmt.Sprintf("discarding event %d", event.EventID)
-		logger.Error(message)
+		logger.Error("Error reading GDC data", "error", err)
 		return
 	}
-	decoder.ProcessDecodedEvent(event, configuration, writer, writer2)
+	decoder.ProcessDecodedEvent(event, configuration, router)
 }
 
 func parseAlgorithm(algorithm string) decoder.BloscAlgorithm {
@@ -199,13 +168,13 @@ func parseAlgorithm(algorithm string) decoder.BloscAlgorithm {
 	for i, v := range bloscAlgorithmStrings {
 		if v == algorithm {
 			b.Name = algorithm
-			b.Code = hdf5.BloscFilter(i)
+			b.Code = i
 			found = true
 			break
 		}
 	}
 	if !found {
-		fmt.Println("Unknown algorithm: ", algorithm)
+		logger.Error("Unknown algorithm", "algorithm", algorithm)
 		os.Exit(1)
 	}
 	return b
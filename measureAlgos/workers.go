@@ -1,11 +1,11 @@
 package main
 
 import (
-	"fmt"
 	"io"
 	"time"
 
 	decoder "github.com/next-exp/decoder_go/pkg"
+	hdf5writer "github.com/next-exp/decoder_go/pkg/hdf5writer"
 )
 
 type WorkerData struct {
@@ -14,43 +14,58 @@ type WorkerData struct {
 }
 
 func worker(id int, jobs <-chan WorkerData, results chan<- decoder.EventType) {
+	log := decoder.ModuleLogger("workers")
+	for event := range jobs {
+		log.Debug("Processing event", "worker", id, "event", decoder.EventIdGetNbInRun(event.Header.EventId))
+		results <- decodeWorkerData(id, event)
+	}
+}
+
+// Decoding errors are kept in the event. Recovering here is only a last
+// resort, so a single event cannot stop the worker.
+func decodeWorkerData(id int, data WorkerData) (event decoder.EventType) {
 	defer func() {
 		if r := recover(); r != nil {
-			fmt.Printf("Worker %d recovered from panic: %v\n", id, r)
-			results <- decoder.EventType{Error: true}
+			decoder.ModuleLogger("workers").Error("Worker recovered from panic", "worker", id,
+				"event", decoder.EventIdGetNbInRun(data.Header.EventId), "panic", r)
+			event = decoder.EventType{
+				EventID: decoder.EventIdGetNbInRun(data.Header.EventId),
+				Error:   true,
+			}
 		}
 	}()
 
-	for event := range jobs {
-		fmt.Printf("Worker %d processing event %d\n", id, event.Header.EventId)
-		//fmt.Println("Data size:", len(event.Data), "Header: ", event.Header)
-		event, _ := decoder.ReadGDC(event.Data, event.Header)
-		results <- event
+	event, err := decoder.ReadGDC(data.Data, data.Header)
+	if err != nil {
+		decoder.ModuleLogger("workers").Error("Error reading GDC data", "worker", id,
+			"event", decoder.EventIdGetNbInRun(data.Header.EventId), "error", err)
 	}
+	return event
 }
 
 func sendEventsToWorkers(fileReader *FileReader, jobs chan<- WorkerData) {
+	log := decoder.ModuleLogger("workers")
 	for {
 		header, eventData, err := fileReader.getNextEvent()
-		fmt.Printf("Reading event %d\n", decoder.EventIdGetNbInRun(header.EventId))
 		if err != nil {
-			fmt.Println("Error reading event:", err)
-			break
-		}
-		if err == io.EOF {
+			if err != io.EOF {
+				log.Error("Error reading event", "error", err)
+			}
 			break
 		}
+		log.Debug("Reading event", "event", decoder.EventIdGetNbInRun(header.EventId))
 		jobs <- WorkerData{Data: eventData, Header: header}
 	}
 	close(jobs)
 }
 
-func processWorkerResults(results []decoder.EventType, writer *decoder.Writer) {
+func processWorkerResults(results []decoder.EventType, writer *hdf5writer.Writer) {
+	log := decoder.ModuleLogger("workers")
 	evtsProcessed := 0
 	var totalTime int64 = 0
-	fmt.Println("Waiting for events")
+	log.Debug("Waiting for events")
 	for _, event := range results {
-		fmt.Println("Processed event: ", evtsProcessed, event.EventID)
+		log.Debug("Processed event", "count", evtsProcessed, "event", event.EventID)
 		start := time.Now()
 		if configuration.WriteData && !event.Error {
 			writer.WriteEvent(&event)
@@ -62,5 +77,5 @@ func processWorkerResults(results []decoder.EventType, writer *decoder.Writer) {
 		totalTime += duration.Milliseconds()
 		time.Sleep(100 * time.Millisecond)
 	}
-	fmt.Println("Total time writing: ", totalTime)
+	log.Debug("Total time writing", "ms", totalTime)
 }
@@ -0,0 +1,232 @@
+package arrowwriter
+
+import (
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	decoder "github.com/next-exp/decoder_go/pkg"
+)
+
+var (
+	int16List  = arrow.ListOf(arrow.PrimitiveTypes.Int16)
+	uint16List = arrow.ListOf(arrow.PrimitiveTypes.Uint16)
+	boolList   = arrow.ListOf(arrow.FixedWidthTypes.Boolean)
+	// One waveform per sensor
+	waveformList = arrow.ListOf(int16List)
+)
+
+// Columns of the events table, named as the HDF5 datasets. As in the HDF5
+// writer, the first event decides which waveforms are written. Later events
+// without them have nulls.
+func eventColumns(event *decoder.EventType, pmts []sensorMapping, sipms []sensorMapping,
+	config decoder.Configuration) []column {
+	columns := []column{
+		{arrow.Field{Name: "evt_number", Type: arrow.PrimitiveTypes.Int32},
+			func(b array.Builder, event *decoder.EventType) {
+				b.(*array.Int32Builder).Append(int32(event.EventID))
+			}},
+		{arrow.Field{Name: "timestamp", Type: arrow.PrimitiveTypes.Uint64},
+			func(b array.Builder, event *decoder.EventType) {
+				b.(*array.Uint64Builder).Append(event.Timestamp)
+			}},
+		{arrow.Field{Name: "trigger_type", Type: arrow.PrimitiveTypes.Int32},
+			func(b array.Builder, event *decoder.EventType) {
+				b.(*array.Int32Builder).Append(int32(event.TriggerType))
+			}},
+		{arrow.Field{Name: "trigger_lost1", Type: arrow.PrimitiveTypes.Int32},
+			func(b array.Builder, event *decoder.EventType) {
+				b.(*array.Int32Builder).Append(int32(event.TriggerConfig.TriggerLost1))
+			}},
+		{arrow.Field{Name: "trigger_lost2", Type: arrow.PrimitiveTypes.Int32},
+			func(b array.Builder, event *decoder.EventType) {
+				b.(*array.Int32Builder).Append(int32(event.TriggerConfig.TriggerLost2))
+			}},
+		// Channels (elecID) that made the trigger
+		{arrow.Field{Name: "trigger_channels", Type: uint16List},
+			func(b array.Builder, event *decoder.EventType) {
+				list := b.(*array.ListBuilder)
+				list.Append(true)
+				list.ValueBuilder().(*array.Uint16Builder).AppendValues(event.TriggerConfig.TrgChannels, nil)
+			}},
+	}
+	// Events whose FECs are out of sync are flagged, even when kept
+	if config.CheckFecSync {
+		columns = append(columns, flagColumn("desync", func(event *decoder.EventType) bool {
+			return event.Desync
+		}))
+	}
+	if event == nil {
+		return columns
+	}
+
+	if len(pmts) > 0 {
+		columns = append(columns,
+			waveformsColumn("pmtrwf", pmts, func(event *decoder.EventType) map[uint16][]int16 {
+				return event.PmtWaveforms
+			}),
+			baselinesColumn("pmt_baselines", pmts, func(event *decoder.EventType) map[uint16]uint16 {
+				return event.Baselines
+			}),
+		)
+	}
+	// Same channel order as the PMTs
+	if len(event.BlrWaveforms) > 0 {
+		columns = append(columns,
+			waveformsColumn("pmt_blr", pmts, func(event *decoder.EventType) map[uint16][]int16 {
+				return event.BlrWaveforms
+			}),
+			baselinesColumn("blr_baselines", pmts, func(event *decoder.EventType) map[uint16]uint16 {
+				return event.BlrBaselines
+			}),
+		)
+	}
+	if len(sipms) > 0 {
+		columns = append(columns,
+			waveformsColumn("sipmrwf", sipms, func(event *decoder.EventType) map[uint16][]int16 {
+				return event.SipmWaveforms
+			}),
+		)
+	}
+	if event.ExtTrgWaveform != nil {
+		columns = append(columns, singleWaveformColumn("ext_pmt", func(event *decoder.EventType) *[]int16 {
+			return event.ExtTrgWaveform
+		}))
+	}
+	if event.PmtSumWaveform != nil {
+		columns = append(columns,
+			singleWaveformColumn("pmt_sum", func(event *decoder.EventType) *[]int16 {
+				return event.PmtSumWaveform
+			}),
+			column{arrow.Field{Name: "pmt_sum_baseline", Type: arrow.PrimitiveTypes.Int16, Nullable: true},
+				func(b array.Builder, event *decoder.EventType) {
+					if event.PmtSumWaveform == nil {
+						b.AppendNull()
+						return
+					}
+					b.(*array.Int16Builder).Append(int16(event.PmtSumBaseline))
+				}},
+		)
+	}
+
+	// Channels coming from broken FECs are flagged when keeping partial events
+	if config.KeepPartial {
+		if len(pmts) > 0 {
+			columns = append(columns, validityColumn("pmt_valid", pmts,
+				func(event *decoder.EventType) (map[uint16][]int16, map[uint16]bool) {
+					return event.PmtWaveforms, event.InvalidChannels
+				}))
+		}
+		if len(event.BlrWaveforms) > 0 {
+			columns = append(columns, validityColumn("blr_valid", pmts,
+				func(event *decoder.EventType) (map[uint16][]int16, map[uint16]bool) {
+					return event.BlrWaveforms, event.InvalidBlrChannels
+				}))
+		}
+		if len(sipms) > 0 {
+			columns = append(columns, validityColumn("sipm_valid", sipms,
+				func(event *decoder.EventType) (map[uint16][]int16, map[uint16]bool) {
+					return event.SipmWaveforms, event.InvalidChannels
+				}))
+		}
+		if event.ExtTrgWaveform != nil {
+			columns = append(columns, flagColumn("ext_pmt_valid", func(event *decoder.EventType) bool {
+				return event.ExtTrgWaveform != nil && !event.InvalidExtTrg
+			}))
+		}
+		if event.PmtSumWaveform != nil {
+			columns = append(columns, flagColumn("pmt_sum_valid", func(event *decoder.EventType) bool {
+				return event.PmtSumWaveform != nil && !event.InvalidPmtSum
+			}))
+		}
+		if config.ReadTrigger {
+			columns = append(columns, flagColumn("trigger_valid", func(event *decoder.EventType) bool {
+				return !event.InvalidTrigger
+			}))
+		}
+	}
+	return columns
+}
+
+// A waveform per sensor, in the order of the mapping. Sensors without data
+// are filled with zeros, as in the HDF5 files.
+func waveformsColumn(name string, sensors []sensorMapping, waveforms func(*decoder.EventType) map[uint16][]int16) column {
+	return column{arrow.Field{Name: name, Type: waveformList, Nullable: true},
+		func(b array.Builder, event *decoder.EventType) {
+			list := b.(*array.ListBuilder)
+			data := waveforms(event)
+			if len(data) == 0 {
+				list.AppendNull()
+				return
+			}
+			samples := 0
+			for _, waveform := range data {
+				samples = len(waveform)
+				break
+			}
+			list.Append(true)
+			sensorList := list.ValueBuilder().(*array.ListBuilder)
+			values := sensorList.ValueBuilder().(*array.Int16Builder)
+			for _, sensor := range sensors {
+				sensorList.Append(true)
+				waveform, found := data[sensor.Channel]
+				if !found {
+					waveform = make([]int16, samples)
+				}
+				values.AppendValues(waveform, nil)
+			}
+		}}
+}
+
+func baselinesColumn(name string, sensors []sensorMapping, baselines func(*decoder.EventType) map[uint16]uint16) column {
+	return column{arrow.Field{Name: name, Type: int16List, Nullable: true},
+		func(b array.Builder, event *decoder.EventType) {
+			list := b.(*array.ListBuilder)
+			data := baselines(event)
+			if len(data) == 0 {
+				list.AppendNull()
+				return
+			}
+			list.Append(true)
+			values := list.ValueBuilder().(*array.Int16Builder)
+			for _, sensor := range sensors {
+				values.Append(int16(data[sensor.Channel]))
+			}
+		}}
+}
+
+func singleWaveformColumn(name string, waveform func(*decoder.EventType) *[]int16) column {
+	return column{arrow.Field{Name: name, Type: int16List, Nullable: true},
+		func(b array.Builder, event *decoder.EventType) {
+			list := b.(*array.ListBuilder)
+			data := waveform(event)
+			if data == nil {
+				list.AppendNull()
+				return
+			}
+			list.Append(true)
+			list.ValueBuilder().(*array.Int16Builder).AppendValues(*data, nil)
+		}}
+}
+
+// A channel is valid if it has data and it does not come from a broken FEC
+func validityColumn(name string, sensors []sensorMapping,
+	channels func(*decoder.EventType) (map[uint16][]int16, map[uint16]bool)) column {
+	return column{arrow.Field{Name: name, Type: boolList},
+		func(b array.Builder, event *decoder.EventType) {
+			list := b.(*array.ListBuilder)
+			waveforms, invalid := channels(event)
+			list.Append(true)
+			values := list.ValueBuilder().(*array.BooleanBuilder)
+			for _, sensor := range sensors {
+				_, found := waveforms[sensor.Channel]
+				values.Append(found && !invalid[sensor.Channel])
+			}
+		}}
+}
+
+// A flag per event
+func flagColumn(name string, flag func(*decoder.EventType) bool) column {
+	return column{arrow.Field{Name: name, Type: arrow.FixedWidthTypes.Boolean},
+		func(b array.Builder, event *decoder.EventType) {
+			b.(*array.BooleanBuilder).Append(flag(event))
+		}}
+}
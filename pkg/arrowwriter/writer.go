@@ -0,0 +1,292 @@
+package arrowwriter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	decoder "github.com/next-exp/decoder_go/pkg"
+)
+
+// Events kept in memory before writing them as a record batch, a row group
+// in Parquet. The SiPM waveforms of an event take a few MB.
+const EVENTS_PER_BATCH = 16
+
+func init() {
+	decoder.RegisterOutputFormat(decoder.OutputFormat{
+		Name:      "parquet",
+		Extension: ".parquet",
+		Open: func(filename string) (decoder.EventWriter, error) {
+			return openWriter(filename, PARQUET)
+		},
+	})
+	decoder.RegisterOutputFormat(decoder.OutputFormat{
+		Name:      "arrow",
+		Extension: ".arrow",
+		Open: func(filename string) (decoder.EventWriter, error) {
+			return openWriter(filename, ARROW)
+		},
+	})
+}
+
+func openWriter(filename string, format Format) (decoder.EventWriter, error) {
+	writer, err := NewWriter(filename, format)
+	if err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+type Format int
+
+const (
+	PARQUET Format = iota
+	// Arrow IPC file, also known as Feather v2
+	ARROW
+)
+
+// Writes the events as a table with one row per event. The waveforms are
+// list columns with the sensors in the order of the mappings, which are
+// kept in the metadata of the file together with the run number and the
+// trigger configuration.
+type Writer struct {
+	Filename string
+	format   Format
+	file     *os.File
+	// Created with the first event, that sets the columns
+	records  recordWriter
+	columns  []column
+	builder  *array.RecordBuilder
+	buffered int
+	// First error writing, reported by Close
+	err        error
+	EvtCounter int
+}
+
+type recordWriter interface {
+	Write(record arrow.Record) error
+	Close() error
+}
+
+type column struct {
+	field  arrow.Field
+	append func(builder array.Builder, event *decoder.EventType)
+}
+
+// Channel and sensor ID, -1 without database, in the order of the waveforms
+type sensorMapping struct {
+	Channel  uint16 `json:"channel"`
+	SensorID int32  `json:"sensorID"`
+}
+
+func NewWriter(filename string, format Format) (*Writer, error) {
+	config := decoder.GetConfiguration()
+	if _, err := parquetCodec(config.ArrowCompression); err != nil {
+		return nil, err
+	}
+	if format == ARROW {
+		if _, err := ipcCompression(config.ArrowCompression); err != nil {
+			return nil, err
+		}
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s: %w", filename, err)
+	}
+	return &Writer{Filename: filename, format: format, file: file}, nil
+}
+
+func parquetCodec(name string) (compress.Compression, error) {
+	switch name {
+	case "none":
+		return compress.Codecs.Uncompressed, nil
+	case "snappy":
+		return compress.Codecs.Snappy, nil
+	case "gzip":
+		return compress.Codecs.Gzip, nil
+	case "zstd":
+		return compress.Codecs.Zstd, nil
+	case "lz4":
+		return compress.Codecs.Lz4Raw, nil
+	}
+	return compress.Codecs.Uncompressed, fmt.Errorf("unknown compression %s", name)
+}
+
+// Arrow IPC files can only be compressed with LZ4 or zstd
+func ipcCompression(name string) ([]ipc.Option, error) {
+	switch name {
+	case "none":
+		return nil, nil
+	case "zstd":
+		return []ipc.Option{ipc.WithZstd()}, nil
+	case "lz4":
+		return []ipc.Option{ipc.WithLZ4()}, nil
+	}
+	return nil, fmt.Errorf("compression %s is not supported by the arrow format, use none, lz4 or zstd", name)
+}
+
+func (w *Writer) WriteEvent(event *decoder.EventType) {
+	if w.records == nil {
+		if err := w.start(event); err != nil {
+			w.fail(err)
+			return
+		}
+	}
+	for i, column := range w.columns {
+		column.append(w.builder.Field(i), event)
+	}
+	w.buffered++
+	w.EvtCounter++
+	if w.buffered >= EVENTS_PER_BATCH {
+		w.fail(w.flush())
+	}
+}
+
+// Keeps the first error and logs all of them
+func (w *Writer) fail(err error) {
+	if err == nil {
+		return
+	}
+	decoder.ModuleLogger("arrow").Error(err.Error(), "file", w.Filename, "event", w.EvtCounter)
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+// Chooses the columns and writes the schema. Without event, when nothing
+// was written, there are only the columns present in every event.
+func (w *Writer) start(event *decoder.EventType) error {
+	config := decoder.GetConfiguration()
+	pmts, sipms := []sensorMapping{}, []sensorMapping{}
+	var trigger decoder.TriggerData
+	var runNumber uint32
+	if event != nil {
+		pmts, sipms = sensorOrder(event, config.NoDB)
+		trigger = event.TriggerConfig
+		runNumber = event.RunNumber
+	}
+	w.columns = eventColumns(event, pmts, sipms, config)
+
+	fields := make([]arrow.Field, 0, len(w.columns))
+	for _, column := range w.columns {
+		fields = append(fields, column.field)
+	}
+	pmtJSON, _ := json.Marshal(pmts)
+	sipmJSON, _ := json.Marshal(sipms)
+	triggerJSON, _ := json.Marshal(triggerConfiguration(trigger))
+	metadata := arrow.NewMetadata(
+		[]string{"run_number", "sensors_pmt", "sensors_sipm", "trigger_configuration"},
+		[]string{strconv.Itoa(int(runNumber)), string(pmtJSON), string(sipmJSON), string(triggerJSON)},
+	)
+	schema := arrow.NewSchema(fields, &metadata)
+
+	var err error
+	switch w.format {
+	case PARQUET:
+		codec, _ := parquetCodec(config.ArrowCompression)
+		props := parquet.NewWriterProperties(
+			parquet.WithCompression(codec),
+			parquet.WithCompressionLevel(config.CompressionLevel),
+		)
+		w.records, err = pqarrow.NewFileWriter(schema, w.file, props, pqarrow.DefaultWriterProps())
+	case ARROW:
+		options, _ := ipcCompression(config.ArrowCompression)
+		options = append(options, ipc.WithSchema(schema))
+		w.records, err = ipc.NewFileWriter(w.file, options...)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing the schema of %s: %w", w.Filename, err)
+	}
+	w.builder = array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	return nil
+}
+
+func (w *Writer) flush() error {
+	if w.buffered == 0 {
+		return nil
+	}
+	record := w.builder.NewRecord()
+	defer record.Release()
+	w.buffered = 0
+	if err := w.records.Write(record); err != nil {
+		return fmt.Errorf("error writing events to %s: %w", w.Filename, err)
+	}
+	return nil
+}
+
+func (w *Writer) Close() error {
+	errs := []error{w.err}
+	if w.records == nil {
+		errs = append(errs, w.start(nil))
+	}
+	if w.records != nil {
+		errs = append(errs, w.flush())
+		if err := w.records.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("error closing %s: %w", w.Filename, err))
+		}
+		w.builder.Release()
+	}
+	// The Parquet writer closes the file itself
+	if err := w.file.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+		errs = append(errs, fmt.Errorf("error closing %s: %w", w.Filename, err))
+	}
+	return errors.Join(errs...)
+}
+
+// Sorted by sensor ID with the database and by channel without it, as in
+// the HDF5 files
+func sensorOrder(event *decoder.EventType, noDB bool) ([]sensorMapping, []sensorMapping) {
+	if noDB {
+		return sortByChannel(event.PmtWaveforms), sortByChannel(event.SipmWaveforms)
+	}
+	sensorsMap := decoder.GetSensorsMap()
+	return sortBySensorID(sensorsMap.Pmts.ToSensorID), sortBySensorID(sensorsMap.Sipms.ToSensorID)
+}
+
+func sortByChannel(waveforms map[uint16][]int16) []sensorMapping {
+	sensors := make([]sensorMapping, 0, len(waveforms))
+	for elecID := range waveforms {
+		sensors = append(sensors, sensorMapping{Channel: elecID, SensorID: -1})
+	}
+	sort.Slice(sensors, func(i, j int) bool {
+		return sensors[i].Channel < sensors[j].Channel
+	})
+	return sensors
+}
+
+func sortBySensorID(toSensorID map[uint16]uint16) []sensorMapping {
+	sensors := make([]sensorMapping, 0, len(toSensorID))
+	for elecID, sensorID := range toSensorID {
+		sensors = append(sensors, sensorMapping{Channel: elecID, SensorID: int32(sensorID)})
+	}
+	sort.Slice(sensors, func(i, j int) bool {
+		return sensors[i].SensorID < sensors[j].SensorID
+	})
+	return sensors
+}
+
+// Single-value parameters with the names of the HDF5 configuration table
+func triggerConfiguration(params decoder.TriggerData) map[string]uint32 {
+	values := make(map[string]uint32)
+	t := reflect.TypeOf(params)
+	v := reflect.ValueOf(params)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		switch f.Type.Kind() {
+		case reflect.Uint16, reflect.Uint32:
+			values[f.Tag.Get("hdf5")] = uint32(v.Field(i).Uint())
+		}
+	}
+	return values
+}
@@ -0,0 +1,219 @@
+package arrowwriter
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	decoder "github.com/next-exp/decoder_go/pkg"
+)
+
+func setupTestConfiguration(compression string) {
+	decoder.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	decoder.SetConfiguration(decoder.Configuration{
+		WriteData:        true,
+		NoDB:             true,
+		ExtTrigger:       15,
+		PmtSumCh:         -1,
+		ReadPMTs:         true,
+		ReadSiPMs:        true,
+		ReadTrigger:      true,
+		Discard:          true,
+		CompressionLevel: 4,
+		ArrowCompression: compression,
+		CheckFecSync:     true,
+		DiscardDesync:    true,
+		CheckWordCount:   true,
+	})
+	huffman := decoder.DefaultHuffmanTable().Tree()
+	decoder.SetHuffmanCodes(huffman, huffman)
+}
+
+// Writes the events of the generator and returns them decoded
+func writeEvents(t *testing.T, filename string, format Format, nEvents int) []decoder.EventType {
+	t.Helper()
+	writer, err := NewWriter(filename, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generator, err := decoder.NewGenerator(decoder.DefaultGeneratorConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make([]decoder.EventType, 0, nEvents)
+	for i := 0; i < nEvents; i++ {
+		header, eventData, err := decoder.ReadEvent(generator.NextEvent().Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		event, err := decoder.ReadGDC(eventData, header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer.WriteEvent(&event)
+		events = append(events, event)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+// Compares the rows with the events, the PMT waveforms follow the order of
+// the mapping in the metadata
+func checkTable(t *testing.T, table arrow.Table, metadata arrow.Metadata, events []decoder.EventType) {
+	t.Helper()
+	if int(table.NumRows()) != len(events) {
+		t.Fatalf("got %d rows, expected %d", table.NumRows(), len(events))
+	}
+	var pmts []sensorMapping
+	index := metadata.FindKey("sensors_pmt")
+	if index < 0 {
+		t.Fatal("PMT mapping not found in the metadata")
+	}
+	if err := json.Unmarshal([]byte(metadata.Values()[index]), &pmts); err != nil {
+		t.Fatal(err)
+	}
+	if len(pmts) == 0 {
+		t.Fatal("no PMTs in the mapping")
+	}
+
+	schema := table.Schema()
+	eventIDs := table.Column(schema.FieldIndices("evt_number")[0]).Data()
+	waveforms := table.Column(schema.FieldIndices("pmtrwf")[0]).Data()
+	if len(schema.FieldIndices("desync")) == 0 {
+		t.Fatal("desync column not found")
+	}
+	desyncs := table.Column(schema.FieldIndices("desync")[0]).Data()
+	row := 0
+	for chunk := 0; chunk < len(eventIDs.Chunks()); chunk++ {
+		ids := eventIDs.Chunk(chunk).(*array.Int32)
+		sensorLists := waveforms.Chunk(chunk).(*array.List)
+		desync := desyncs.Chunk(chunk).(*array.Boolean)
+		for i := 0; i < ids.Len(); i++ {
+			event := events[row]
+			if ids.Value(i) != int32(event.EventID) {
+				t.Fatalf("row %d: event %d, expected %d", row, ids.Value(i), event.EventID)
+			}
+			if desync.Value(i) != event.Desync {
+				t.Fatalf("row %d: desync %t, expected %t", row, desync.Value(i), event.Desync)
+			}
+			start, end := sensorLists.ValueOffsets(i)
+			if int(end-start) != len(pmts) {
+				t.Fatalf("row %d: %d PMTs, expected %d", row, end-start, len(pmts))
+			}
+			samples := sensorLists.ListValues().(*array.List)
+			values := samples.ListValues().(*array.Int16)
+			for j, pmt := range pmts {
+				first, last := samples.ValueOffsets(int(start) + j)
+				if !slices.Equal(values.Int16Values()[first:last], event.PmtWaveforms[pmt.Channel]) {
+					t.Fatalf("row %d: waveform of PMT %d differs", row, pmt.Channel)
+				}
+			}
+			row++
+		}
+	}
+}
+
+func TestWriterArrow(t *testing.T) {
+	setupTestConfiguration("zstd")
+	filename := filepath.Join(t.TempDir(), "out.arrow")
+	// More than a batch
+	events := writeEvents(t, filename, ARROW, EVENTS_PER_BATCH+3)
+
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	reader, err := ipc.NewFileReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	records := make([]arrow.Record, 0)
+	for i := 0; i < reader.NumRecords(); i++ {
+		record, err := reader.Record(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Owned by the reader until the next one is read
+		record.Retain()
+		defer record.Release()
+		records = append(records, record)
+	}
+	table := array.NewTableFromRecords(reader.Schema(), records)
+	defer table.Release()
+	checkTable(t, table, reader.Schema().Metadata(), events)
+}
+
+func TestWriterParquet(t *testing.T) {
+	for _, compression := range []string{"none", "snappy", "gzip", "zstd", "lz4"} {
+		t.Run(compression, func(t *testing.T) {
+			setupTestConfiguration(compression)
+			filename := filepath.Join(t.TempDir(), "out.parquet")
+			events := writeEvents(t, filename, PARQUET, 3)
+
+			parquetFile, err := file.OpenParquetFile(filename, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer parquetFile.Close()
+			reader, err := pqarrow.NewFileReader(parquetFile, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+			if err != nil {
+				t.Fatal(err)
+			}
+			table, err := reader.ReadTable(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer table.Release()
+
+			keyValues := parquetFile.MetaData().KeyValueMetadata()
+			keys := make([]string, 0)
+			values := make([]string, 0)
+			for _, key := range []string{"run_number", "sensors_pmt"} {
+				value := keyValues.FindValue(key)
+				if value == nil {
+					t.Fatalf("%s not found in the metadata", key)
+				}
+				keys = append(keys, key)
+				values = append(values, *value)
+			}
+			checkTable(t, table, arrow.NewMetadata(keys, values), events)
+		})
+	}
+}
+
+func TestWriterArrowCompression(t *testing.T) {
+	setupTestConfiguration("snappy")
+	if _, err := NewWriter(filepath.Join(t.TempDir(), "out.arrow"), ARROW); err == nil {
+		t.Fatal("snappy accepted for the arrow format")
+	}
+}
+
+// A file without events is still readable
+func TestWriterEmpty(t *testing.T) {
+	setupTestConfiguration("zstd")
+	filename := filepath.Join(t.TempDir(), "out.parquet")
+	writeEvents(t, filename, PARQUET, 0)
+	parquetFile, err := file.OpenParquetFile(filename, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer parquetFile.Close()
+	if parquetFile.NumRows() != 0 {
+		t.Fatalf("got %d rows", parquetFile.NumRows())
+	}
+}
@@ -3,22 +3,21 @@ package decoder
 import (
 	"encoding/json"
 	"fmt"
-
-	"github.com/next-exp/hdf5-go"
 )
 
 type BloscAlgorithm struct {
 	Name string
-	Code hdf5.BloscFilter
+	Code int
 }
 
+// Same codes as in blosc.h, the writers convert them to their own types
 const (
-	BLOSC_BLOSCLZ = hdf5.BLOSC_BLOSCLZ
-	BLOSC_LZ4     = hdf5.BLOSC_LZ4
-	BLOSC_LZ4HC   = hdf5.BLOSC_LZ4HC
-	BLOSC_SNAPPY  = hdf5.BLOSC_SNAPPY
-	BLOSC_ZLIB    = hdf5.BLOSC_ZLIB
-	BLOSC_ZSTD    = hdf5.BLOSC_ZSTD
+	BLOSC_BLOSCLZ = iota
+	BLOSC_LZ4
+	BLOSC_LZ4HC
+	BLOSC_SNAPPY
+	BLOSC_ZLIB
+	BLOSC_ZSTD
 )
 
 var bloscAlgorithmStrings = []string{
@@ -48,7 +47,7 @@ func (b *BloscAlgorithm) UnmarshalJSON(data []byte) error {
 	}
 	for i, v := range bloscAlgorithmStrings {
 		if v == s {
-			*b = BloscAlgorithm{Name: s, Code: hdf5.BloscFilter(i)}
+			*b = BloscAlgorithm{Name: s, Code: i}
 			return nil
 		}
 	}
@@ -57,13 +56,13 @@ func (b *BloscAlgorithm) UnmarshalJSON(data []byte) error {
 
 type BloscShuffle struct {
 	Name string
-	Code hdf5.BloscShuffle
+	Code int
 }
 
 const (
-	BLOSC_NOSHUFFLE  = hdf5.BLOSC_NOSHUFFLE
-	BLOSC_SHUFFLE    = hdf5.BLOSC_SHUFFLE
-	BLOSC_BITSHUFFLE = hdf5.BLOSC_BITSHUFFLE
+	BLOSC_NOSHUFFLE = iota
+	BLOSC_SHUFFLE
+	BLOSC_BITSHUFFLE
 )
 
 var bloscShuffleStrings = []string{
@@ -90,7 +89,7 @@ func (b *BloscShuffle) UnmarshalJSON(data []byte) error {
 	}
 	for i, v := range bloscShuffleStrings {
 		if v == s {
-			*b = BloscShuffle{Name: s, Code: hdf5.BloscShuffle(i)}
+			*b = BloscShuffle{Name: s, Code: i}
 			return nil
 		}
 	}
@@ -1,21 +1,45 @@
 package decoder
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
 type Configuration struct {
 	MaxEvents        int            `json:"max_events"`
 	Verbosity        int            `json:"verbosity"`
+	LogLevel         string         `json:"log_level"`
+	LogModules       string         `json:"log_modules"`
+	LogFormat        string         `json:"log_format"`
 	ExtTrigger       int            `json:"ext_trigger"`
 	PmtSumCh         int            `json:"pmt_sum_ch"`
 	FileIn           string         `json:"file_in"`
 	FileOut          string         `json:"file_out"`
 	FileOut2         string         `json:"file_out2"`
+	OutputFormat     string         `json:"output_format"`
 	TrgCode1         int            `json:"trg_code1"`
 	TrgCode2         int            `json:"trg_code2"`
 	ReadPMTs         bool           `json:"read_pmts"`
 	ReadSiPMs        bool           `json:"read_sipms"`
 	ReadTrigger      bool           `json:"read_trigger"`
 	SplitTrg         bool           `json:"split_trg"`
+	Routes           Routes         `json:"routes"`
 	NoDB             bool           `json:"no_db"`
 	Discard          bool           `json:"discard"`
+	KeepPartial      bool           `json:"keep_partial"`
+	CheckFecSync     bool           `json:"check_fec_sync"`
+	DiscardDesync    bool           `json:"discard_desync"`
+	CheckWordCount   bool           `json:"check_word_count"`
 	Skip             int            `json:"skip"`
 	Host             string         `json:"host"`
 	User             string         `json:"user"`
@@ -28,10 +52,57 @@ type Configuration struct {
 	CompressionLevel int            `json:"compression_level"`
 	BloscAlgorithm   BloscAlgorithm `json:"blosc_algorithm"`
 	BloscShuffle     BloscShuffle   `json:"blosc_shuffle"`
+	ArrowCompression string         `json:"arrow_compression"`
 }
 
 var configuration Configuration
 
+// Values used for the keys that are not set in the configuration file,
+// the environment or the command line
+func DefaultConfiguration() Configuration {
+	var config Configuration
+	config.MaxEvents = 1000000000
+	config.Verbosity = 0
+	config.LogFormat = "text"
+	config.OutputFormat = "hdf5"
+	config.ExtTrigger = 15
+	config.TrgCode1 = 1
+	config.TrgCode2 = 9
+	config.ReadPMTs = true
+	config.ReadSiPMs = true
+	config.ReadTrigger = true
+	config.SplitTrg = false
+	config.NoDB = false
+	config.Discard = true
+	config.KeepPartial = false
+	// The FEC checks are not validated against reference runs yet, they
+	// are enabled explicitly
+	config.CheckFecSync = false
+	config.DiscardDesync = false
+	config.CheckWordCount = false
+	config.Skip = 0
+	config.Host = "next.ific.uv.es"
+	config.User = "nextreader"
+	config.Passwd = "readonly"
+	config.DBName = "NEXT100"
+	config.NumWorkers = 1
+	config.WriteData = true
+	config.Parallel = false
+	config.UseBlosc = false
+	config.CompressionLevel = 4
+	config.ArrowCompression = "zstd"
+	return config
+}
+
+// Copy of the configuration that can be printed, without the password of
+// the database
+func (c Configuration) Redacted() Configuration {
+	if c.Passwd != "" {
+		c.Passwd = "REDACTED"
+	}
+	return c
+}
+
 func GetConfiguration() Configuration {
 	return configuration
 }
@@ -39,3 +110,171 @@ func GetConfiguration() Configuration {
 func SetConfiguration(config Configuration) {
 	configuration = config
 }
+
+// Reads a JSON configuration over config. Keys that are not part of the
+// configuration are rejected.
+func UnmarshalConfiguration(data []byte, config *Configuration) error {
+	values := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	_, fields := configurationFields()
+	unknown := make([]string, 0)
+	for key := range values {
+		if _, found := fields[key]; !found {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		errs := make([]error, 0, len(unknown))
+		for _, key := range unknown {
+			errs = append(errs, &ErrInvalidConfiguration{Key: key, Message: "unknown key"})
+		}
+		return errors.Join(errs...)
+	}
+	return json.Unmarshal(data, config)
+}
+
+// Checks the values and the combinations of options. All the problems
+// found are returned joined.
+func (c Configuration) Validate() error {
+	errs := make([]error, 0)
+	invalid := func(key string, format string, args ...interface{}) {
+		errs = append(errs, &ErrInvalidConfiguration{Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if c.FileIn == "" {
+		invalid("file_in", "input file is required")
+	}
+	if _, _, isStream := ParseStreamAddress(c.FileIn); isStream && c.Parallel {
+		invalid("parallel", "parallel decoding is not supported with stream input")
+	}
+	if c.FileOut == "" {
+		invalid("file_out", "output file is required")
+	}
+	if _, err := ParseOutputFormats(c.OutputFormat); err != nil {
+		invalid("output_format", "%v", err)
+	}
+	for i, route := range c.Routes {
+		if err := route.validate(); err != nil {
+			invalid("routes", "route %d: %v", i, err)
+		}
+	}
+	if c.SplitTrg && len(c.Routes) > 0 {
+		invalid("split_trg", "routes replace split_trg, use only one of them")
+	}
+	if c.SplitTrg {
+		if c.FileOut2 == "" {
+			invalid("file_out2", "second output file is required with split_trg")
+		} else if c.FileOut2 == c.FileOut {
+			invalid("file_out2", "must be different from file_out")
+		}
+		if c.TrgCode1 == c.TrgCode2 {
+			invalid("trg_code2", "must be different from trg_code1 (%d) with split_trg", c.TrgCode1)
+		}
+	}
+	if c.MaxEvents < 0 {
+		invalid("max_events", "must not be negative, got %d", c.MaxEvents)
+	}
+	if c.Skip < 0 {
+		invalid("skip", "must not be negative, got %d", c.Skip)
+	}
+	if c.Verbosity < 0 {
+		invalid("verbosity", "must not be negative, got %d", c.Verbosity)
+	}
+	if c.LogLevel != "" {
+		if _, err := ParseLogLevel(c.LogLevel); err != nil {
+			invalid("log_level", "%v", err)
+		}
+	}
+	if _, err := ParseModuleLevels(c.LogModules); err != nil {
+		invalid("log_modules", "%v", err)
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		invalid("log_format", "unknown format %q, use text or json", c.LogFormat)
+	}
+	if c.NumWorkers < 1 {
+		invalid("num_workers", "must be at least 1, got %d", c.NumWorkers)
+	} else if c.Parallel && c.NumWorkers == 1 {
+		invalid("num_workers", "parallel decoding needs more than 1 worker")
+	}
+	if c.CompressionLevel < 0 || c.CompressionLevel > 9 {
+		invalid("compression_level", "must be between 0 and 9, got %d", c.CompressionLevel)
+	}
+	if c.UseBlosc && c.BloscAlgorithm.String() == "UNKNOWN" {
+		invalid("blosc_algorithm", "unknown algorithm")
+	}
+	if c.UseBlosc && c.BloscShuffle.String() == "UNKNOWN" {
+		invalid("blosc_shuffle", "unknown shuffle")
+	}
+	if !slices.Contains([]string{"none", "snappy", "gzip", "zstd", "lz4"}, c.ArrowCompression) {
+		invalid("arrow_compression", "unknown compression %q, use none, snappy, gzip, zstd or lz4", c.ArrowCompression)
+	} else if formats, err := ParseOutputFormats(c.OutputFormat); err == nil && slices.Contains(formats, "arrow") &&
+		!slices.Contains([]string{"none", "zstd", "lz4"}, c.ArrowCompression) {
+		invalid("arrow_compression", "compression %s is not supported by the arrow format, use none, zstd or lz4", c.ArrowCompression)
+	}
+	if !c.ReadPMTs && !c.ReadSiPMs && !c.ReadTrigger {
+		invalid("read_pmts", "nothing to read, read_pmts, read_sipms and read_trigger are false")
+	}
+	if !c.NoDB {
+		if c.Host == "" {
+			invalid("host", "database host is required without no_db")
+		}
+		if c.DBName == "" {
+			invalid("dbname", "database name is required without no_db")
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Level of the logs. Without log_level it comes from the old verbosity:
+// 0 is info, 1 and 2 debug and higher values trace.
+func (c Configuration) Level() slog.Level {
+	if c.LogLevel != "" {
+		level, _ := ParseLogLevel(c.LogLevel)
+		return level
+	}
+	switch {
+	case c.Verbosity > 2:
+		return LevelTrace
+	case c.Verbosity > 0:
+		return slog.LevelDebug
+	}
+	return slog.LevelInfo
+}
+
+// Reads a configuration file over config. The format is chosen by the
+// extension: JSON (.json), YAML (.yaml, .yml) or TOML (.toml), all of
+// them with the same keys.
+func ReadConfigurationFile(filename string, config *Configuration) error {
+	data, err := ReadFileAsJSON(filename)
+	if err != nil {
+		return err
+	}
+	return UnmarshalConfiguration(data, config)
+}
+
+// Reads a JSON, YAML or TOML file, chosen by the extension, and returns
+// its content as JSON so all the formats are decoded the same way
+func ReadFileAsJSON(filename string) ([]byte, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]interface{}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return data, nil
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return nil, fmt.Errorf("unknown format %q, use .json, .yaml, .yml or .toml", filepath.Ext(filename))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(values)
+}
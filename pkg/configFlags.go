@@ -0,0 +1,190 @@
+package decoder
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Prefix of the environment variables overriding the configuration, the
+// rest of the name is the JSON key in upper case (DECODER_FILE_IN)
+const ENV_PREFIX = "DECODER_"
+
+var configurationHelp = map[string]string{
+	"max_events":        "Maximum number of events to read",
+	"verbosity":         "Verbosity level, deprecated in favour of log_level",
+	"log_level":         "Log level (trace, debug, info, warn, error), overrides verbosity",
+	"log_modules":       "Log level of some modules, as in sipms=debug,database=trace",
+	"log_format":        "Log format (text, json)",
+	"ext_trigger":       "Channel of the external trigger in the PMT FECs",
+	"pmt_sum_ch":        "Channel of the PMT sum, -1 if there is none",
+	"file_in":           "Input raw file",
+	"file_out":          "Output file",
+	"file_out2":         "Output file for the second trigger type when splitting triggers",
+	"output_format":     "Output formats, comma separated to write several (hdf5, parquet, arrow)",
+	"trg_code1":         "Trigger type written to file_out when splitting triggers",
+	"trg_code2":         "Trigger type written to file_out2 when splitting triggers",
+	"read_pmts":         "Decode the PMT FECs",
+	"read_sipms":        "Decode the SiPM FECs",
+	"read_trigger":      "Decode the trigger FEC",
+	"split_trg":         "Write the two trigger types to different files, deprecated in favour of routes",
+	"routes":            "Routing table of the events to output files, as JSON: [{\"trigger_types\": [9], \"suffix\": \"_calib\"}, {}]",
+	"no_db":             "Do not use the database",
+	"discard":           "Discard events with errors",
+	"keep_partial":      "Keep events with broken FECs, masking their channels",
+	"check_fec_sync":    "Check that all the FECs belong to the same event",
+	"discard_desync":    "Discard FECs out of sync, otherwise the events are only flagged",
+	"check_word_count":  "Check the word count and the sequence counters",
+	"skip":              "Number of events to skip",
+	"host":              "Database host",
+	"user":              "Database user",
+	"pass":              "Database password",
+	"dbname":            "Database name",
+	"num_workers":       "Number of workers decoding in parallel",
+	"write_data":        "Write the waveforms",
+	"parallel":          "Decode events in parallel",
+	"use_blosc":         "Compress the output with blosc",
+	"compression_level": "Compression level",
+	"blosc_algorithm":   "Blosc algorithm (blosclz, lz4, lz4hc, snappy, zlib, zstd)",
+	"blosc_shuffle":     "Blosc shuffle (no-shuffle, byte-shuffle, bit-shuffle)",
+	"arrow_compression": "Compression of the parquet and arrow outputs (none, snappy, gzip, zstd, lz4), arrow only supports zstd and lz4",
+}
+
+// Field of Configuration for each JSON key, in declaration order
+func configurationFields() ([]string, map[string]int) {
+	keys := make([]string, 0)
+	fields := make(map[string]int)
+	configType := reflect.TypeOf(Configuration{})
+	for i := 0; i < configType.NumField(); i++ {
+		key := strings.Split(configType.Field(i).Tag.Get("json"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		keys = append(keys, key)
+		fields[key] = i
+	}
+	return keys, fields
+}
+
+// Sets a configuration value from its text representation
+func SetConfigurationValue(config *Configuration, key string, value string) error {
+	_, fields := configurationFields()
+	index, found := fields[key]
+	if !found {
+		return fmt.Errorf("unknown configuration key %s", key)
+	}
+	field := reflect.ValueOf(config).Elem().Field(index)
+
+	if unmarshaler, ok := field.Addr().Interface().(json.Unmarshaler); ok {
+		data, _ := json.Marshal(value)
+		if err := unmarshaler.UnmarshalJSON(data); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", key, err)
+		}
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %q is not an integer", key, value)
+		}
+		field.SetInt(int64(parsed))
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %q is not a boolean", key, value)
+		}
+		field.SetBool(parsed)
+	default:
+		return fmt.Errorf("configuration key %s cannot be set from text", key)
+	}
+	return nil
+}
+
+// Overrides the configuration with the environment variables that are set
+func ApplyEnvironment(config *Configuration) error {
+	keys, _ := configurationFields()
+	for _, key := range keys {
+		value, found := os.LookupEnv(ENV_PREFIX + strings.ToUpper(key))
+		if !found {
+			continue
+		}
+		if err := SetConfigurationValue(config, key, value); err != nil {
+			return fmt.Errorf("environment variable %s: %w", ENV_PREFIX+strings.ToUpper(key), err)
+		}
+	}
+	return nil
+}
+
+// Value of a configuration flag, kept as text until the configuration is
+// loaded so only the flags given override it
+type configFlag struct {
+	value  string
+	isBool bool
+}
+
+func (f *configFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+func (f *configFlag) Set(value string) error {
+	f.value = value
+	return nil
+}
+
+func (f *configFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// Command line flags for every field of Configuration, named as the JSON
+// keys with dashes (-file-in, -max-events...)
+type ConfigurationFlags struct {
+	flags  *flag.FlagSet
+	values map[string]*configFlag
+}
+
+func NewConfigurationFlags(flags *flag.FlagSet) *ConfigurationFlags {
+	configFlags := &ConfigurationFlags{flags: flags, values: make(map[string]*configFlag)}
+	// The usage is printed with -h, without the default password
+	defaults := reflect.ValueOf(DefaultConfiguration().Redacted())
+	keys, fields := configurationFields()
+	for _, key := range keys {
+		field := defaults.Field(fields[key])
+		value := &configFlag{isBool: field.Kind() == reflect.Bool}
+		configFlags.values[key] = value
+		usage := fmt.Sprintf("%s (%s%s, default %v)", configurationHelp[key], ENV_PREFIX, strings.ToUpper(key), field.Interface())
+		flags.Var(value, flagName(key), usage)
+	}
+	return configFlags
+}
+
+func flagName(key string) string {
+	return strings.ReplaceAll(key, "_", "-")
+}
+
+// Overrides the configuration with the flags given in the command line
+func (f *ConfigurationFlags) Apply(config *Configuration) error {
+	set := make(map[string]bool)
+	f.flags.Visit(func(fl *flag.Flag) {
+		set[fl.Name] = true
+	})
+	keys, _ := configurationFields()
+	for _, key := range keys {
+		if !set[flagName(key)] {
+			continue
+		}
+		if err := SetConfigurationValue(config, key, f.values[key].value); err != nil {
+			return fmt.Errorf("flag -%s: %w", flagName(key), err)
+		}
+	}
+	return nil
+}
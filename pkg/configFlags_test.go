@@ -0,0 +1,65 @@
+package decoder
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfigurationOverrides(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	configFlags := NewConfigurationFlags(flags)
+	err := flags.Parse([]string{"-file-out", "flag.h5", "-no-db", "-blosc-algorithm", "zstd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DECODER_FILE_OUT", "env.h5")
+	t.Setenv("DECODER_MAX_EVENTS", "10")
+	t.Setenv("DECODER_READ_SIPMS", "false")
+
+	config := DefaultConfiguration()
+	config.FileIn = "file.rd"
+	if err := ApplyEnvironment(&config); err != nil {
+		t.Fatal(err)
+	}
+	if err := configFlags.Apply(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := DefaultConfiguration()
+	expected.FileIn = "file.rd"
+	expected.FileOut = "flag.h5"
+	expected.MaxEvents = 10
+	expected.ReadSiPMs = false
+	expected.NoDB = true
+	expected.BloscAlgorithm = BloscAlgorithm{Name: "zstd", Code: BLOSC_ZSTD}
+	if !reflect.DeepEqual(config, expected) {
+		t.Fatalf("got %+v, expected %+v", config, expected)
+	}
+}
+
+func TestConfigurationFlagsUsage(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	NewConfigurationFlags(flags)
+	usage := flags.Lookup("pass").Usage
+	if strings.Contains(usage, DefaultConfiguration().Passwd) || !strings.Contains(usage, "REDACTED") {
+		t.Fatalf("usage of -pass: %s", usage)
+	}
+}
+
+func TestConfigurationOverrideErrors(t *testing.T) {
+	config := DefaultConfiguration()
+	for _, test := range []struct{ key, value string }{
+		{"max_events", "many"},
+		{"read_pmts", "maybe"},
+		{"blosc_shuffle", "unknown"},
+		{"two_files", "true"},
+	} {
+		if err := SetConfigurationValue(&config, test.key, test.value); err == nil {
+			t.Errorf("%s=%s: expected an error", test.key, test.value)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package decoder
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func validConfiguration() Configuration {
+	config := DefaultConfiguration()
+	config.FileIn = "run.rd"
+	config.FileOut = "run.h5"
+	return config
+}
+
+func TestValidateConfiguration(t *testing.T) {
+	if err := validConfiguration().Validate(); err != nil {
+		t.Fatalf("valid configuration rejected: %v", err)
+	}
+	// Only the arrow format is limited to some compressions
+	config := validConfiguration()
+	config.OutputFormat = "parquet"
+	config.ArrowCompression = "snappy"
+	if err := config.Validate(); err != nil {
+		t.Fatalf("valid configuration rejected: %v", err)
+	}
+
+	for _, test := range []struct {
+		key    string
+		modify func(config *Configuration)
+	}{
+		{"file_in", func(config *Configuration) { config.FileIn = "" }},
+		{"file_out2", func(config *Configuration) { config.SplitTrg = true }},
+		{"trg_code2", func(config *Configuration) {
+			config.SplitTrg = true
+			config.FileOut2 = "run2.h5"
+			config.TrgCode2 = config.TrgCode1
+		}},
+		{"num_workers", func(config *Configuration) { config.NumWorkers = 0 }},
+		{"num_workers", func(config *Configuration) { config.Parallel = true }},
+		{"skip", func(config *Configuration) { config.Skip = -1 }},
+		{"compression_level", func(config *Configuration) { config.CompressionLevel = 10 }},
+		{"host", func(config *Configuration) { config.Host = "" }},
+		{"log_level", func(config *Configuration) { config.LogLevel = "verbose" }},
+		{"log_modules", func(config *Configuration) { config.LogModules = "sipms" }},
+		{"log_format", func(config *Configuration) { config.LogFormat = "xml" }},
+		{"output_format", func(config *Configuration) { config.OutputFormat = "hdf5,,hdf5" }},
+		{"arrow_compression", func(config *Configuration) { config.ArrowCompression = "brotli" }},
+		{"arrow_compression", func(config *Configuration) {
+			config.OutputFormat = "hdf5,arrow"
+			config.ArrowCompression = "snappy"
+		}},
+		{"routes", func(config *Configuration) { config.Routes = Routes{{EventTypes: []string{"pedestal"}}} }},
+		{"split_trg", func(config *Configuration) {
+			config.Routes = Routes{{}}
+			config.SplitTrg = true
+			config.FileOut2 = "run2.h5"
+		}},
+	} {
+		config := validConfiguration()
+		test.modify(&config)
+		err := config.Validate()
+		var invalid *ErrInvalidConfiguration
+		if !errors.As(err, &invalid) || invalid.Key != test.key {
+			t.Errorf("expected an error for %s, got %v", test.key, err)
+		}
+	}
+}
+
+func TestUnmarshalConfiguration(t *testing.T) {
+	config := DefaultConfiguration()
+	err := UnmarshalConfiguration([]byte(`{"file_in": "run.rd", "max_events": 5}`), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.FileIn != "run.rd" || config.MaxEvents != 5 || config.NumWorkers != 1 {
+		t.Fatalf("wrong configuration %+v", config)
+	}
+
+	err = UnmarshalConfiguration([]byte(`{"file_in": "run.rd", "two_files": false}`), &config)
+	var invalid *ErrInvalidConfiguration
+	if !errors.As(err, &invalid) || invalid.Key != "two_files" {
+		t.Fatalf("expected an unknown key error, got %v", err)
+	}
+}
+
+func TestReadConfigurationFile(t *testing.T) {
+	files := map[string]string{
+		"config.json": `{"file_in": "run.rd", "max_events": 5, "no_db": true, "blosc_algorithm": "zstd"}`,
+		"config.yaml": `
+# Input file
+file_in: run.rd
+max_events: 5 # Only a few events
+no_db: true
+blosc_algorithm: zstd
+`,
+		"config.toml": `
+# Input file
+file_in = "run.rd"
+max_events = 5 # Only a few events
+no_db = true
+blosc_algorithm = "zstd"
+`,
+	}
+	expected := DefaultConfiguration()
+	expected.FileIn = "run.rd"
+	expected.MaxEvents = 5
+	expected.NoDB = true
+	expected.BloscAlgorithm = BloscAlgorithm{Name: "zstd", Code: BLOSC_ZSTD}
+
+	dir := t.TempDir()
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		config := DefaultConfiguration()
+		if err := ReadConfigurationFile(filename, &config); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(config, expected) {
+			t.Errorf("%s: got %+v, expected %+v", name, config, expected)
+		}
+	}
+
+	filename := filepath.Join(dir, "unknown.yml")
+	if err := os.WriteFile(filename, []byte("two_files: false\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultConfiguration()
+	var invalid *ErrInvalidConfiguration
+	if err := ReadConfigurationFile(filename, &config); !errors.As(err, &invalid) {
+		t.Errorf("expected an unknown key error, got %v", err)
+	}
+	if err := ReadConfigurationFile(filepath.Join(dir, "config.ini"), &config); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
+
+func TestRedactedConfiguration(t *testing.T) {
+	config := DefaultConfiguration()
+	redacted := config.Redacted()
+	if redacted.Passwd == config.Passwd || config.Passwd != "readonly" {
+		t.Fatalf("password not redacted: %q", redacted.Passwd)
+	}
+	if redacted.User != config.User || redacted.Host != config.Host {
+		t.Fatal("other settings changed")
+	}
+}
@@ -0,0 +1,76 @@
+package decoder
+
+// Cursor walks a FEC payload checking that every access is inside it.
+// Reading past the end returns zero words and records an ErrOutOfBounds,
+// which is kept until the reader checks it with Err. This way the header
+// readers can read a block of words and check the error only once.
+type Cursor struct {
+	Data     []uint16
+	Position int
+	err      error
+}
+
+func NewCursor(data []uint16) *Cursor {
+	return &Cursor{Data: data}
+}
+
+// Next returns the word at the current position and moves forward
+func (c *Cursor) Next() uint16 {
+	word := c.Peek(0)
+	c.Position++
+	return word
+}
+
+// Peek returns the word at the current position plus offset without moving
+func (c *Cursor) Peek(offset int) uint16 {
+	index := c.Position + offset
+	if index < 0 || index >= len(c.Data) {
+		c.fail(index)
+		return 0
+	}
+	return c.Data[index]
+}
+
+// Pair packs the current and next words into a 32-bit word, the first one
+// in the high bits. Compressed values may end in the first word, so a
+// missing second word at the end of the data is read as zero.
+func (c *Cursor) Pair() uint32 {
+	high := c.Peek(0)
+	var low uint16
+	if c.Position+1 < len(c.Data) {
+		low = c.Data[c.Position+1]
+	}
+	return (uint32(high) << 16) | uint32(low)
+}
+
+// Skip moves the cursor n words forward. It may stop right at the end of
+// the data, but not after it.
+func (c *Cursor) Skip(n int) {
+	c.Position += n
+	if c.Position > len(c.Data) {
+		c.fail(c.Position - 1)
+	}
+}
+
+// Remaining returns the number of words left after the current position
+func (c *Cursor) Remaining() int {
+	if c.Position >= len(c.Data) {
+		return 0
+	}
+	return len(c.Data) - c.Position
+}
+
+// Err returns the first out of bounds access, if any
+func (c *Cursor) Err() error {
+	return c.err
+}
+
+func (c *Cursor) fail(index int) {
+	if c.err == nil {
+		c.err = &ErrOutOfBounds{
+			What:   "payload word",
+			Index:  index,
+			Length: len(c.Data),
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package decoder
 
 import (
+	"context"
 	"fmt"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -15,25 +16,38 @@ func LoadDatabase(dbConn *sqlx.DB, runNumber int) error {
 	var err error
 	huffmanCodesPmts, err = getHuffmanCodesFromDB(dbConn, runNumber, PMT)
 	if err != nil {
-		errMessage := fmt.Errorf("error getting huffman codes from database: %w", err)
-		logger.Error(errMessage.Error())
+		ModuleLogger("database").Error("error getting huffman codes from database", "run", runNumber, "error", err)
 		return err
 	}
 	huffmanCodesSipms, err = getHuffmanCodesFromDB(dbConn, runNumber, SiPM)
 	if err != nil {
-		errMessage := fmt.Errorf("error getting huffman codes from database: %w", err)
-		logger.Error(errMessage.Error())
+		ModuleLogger("database").Error("error getting huffman codes from database", "run", runNumber, "error", err)
 		return err
 	}
 	sensorsMap, err = getSensorsFromDB(dbConn, runNumber)
 	if err != nil {
 		errMessage := fmt.Errorf("error getting sensors map from database: %w", err)
-		logger.Error(errMessage.Error())
+		ModuleLogger("database").Error(errMessage.Error(), "run", runNumber)
 		return errMessage
 	}
 	return nil
 }
 
+// Huffman codes of the compressed data, to decode without the database
+func SetHuffmanCodes(pmts *HuffmanNode, sipms *HuffmanNode) {
+	huffmanCodesPmts = pmts
+	huffmanCodesSipms = sipms
+}
+
+func GetSensorsMap() SensorsMap {
+	return sensorsMap
+}
+
+// Channel mapping of the sensors, to decode without the database
+func SetSensorsMap(sensors SensorsMap) {
+	sensorsMap = sensors
+}
+
 func ConnectToDatabase(user string, pass string, host string, dbname string) (*sqlx.DB, error) {
 	port := "3306"
 	dbURI := fmt.Sprintf("%s:%s@(%s:%s)/%s?parseTime=true", user, pass, host, port, dbname)
@@ -79,14 +93,9 @@ func getHuffmanCodesFromDB(db *sqlx.DB, runNumber int, sensor SensorType) (*Huff
 	}
 
 	query = fmt.Sprintf(query, runNumber, runNumber)
-	if configuration.Verbosity > 0 {
-		message := fmt.Sprintf("Reading %v Huffman Codes from database", sensor)
-		logger.Info(message, "database")
-	}
-	if configuration.Verbosity > 2 {
-		message := fmt.Sprintf("Query: %s", query)
-		logger.Info(message, "database")
-	}
+	log := ModuleLogger("database")
+	log.Debug("Reading Huffman codes from database", "sensor", sensor, "run", runNumber)
+	log.Log(context.Background(), LevelTrace, "Query", "query", query)
 	rows, err := db.Queryx(query)
 	if err != nil {
 		errMessage := fmt.Errorf("error querying database: %w", err)
@@ -114,13 +123,9 @@ func getSensorsFromDB(db *sqlx.DB, runNumber int) (SensorsMap, error) {
 	query := "SELECT ElecID, SensorID FROM ChannelMapping WHERE MinRun <= %d and MaxRun >= %d ORDER BY SensorID"
 	query = fmt.Sprintf(query, runNumber, runNumber)
 
-	if configuration.Verbosity > 0 {
-		logger.Info("Channel mapping read from DB", "database")
-	}
-	if configuration.Verbosity > 2 {
-		message := fmt.Sprintf("Query: %s", query)
-		logger.Info(message, "database")
-	}
+	log := ModuleLogger("database")
+	log.Debug("Channel mapping read from DB", "run", runNumber)
+	log.Log(context.Background(), LevelTrace, "Query", "query", query)
 
 	rows, err := db.Queryx(query)
 	if err != nil {
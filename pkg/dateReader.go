@@ -4,7 +4,8 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
-	"os"
+	"io"
+	"time"
 	"unsafe"
 )
 
@@ -12,25 +13,28 @@ func ValidEvent(header EventHeaderStruct) bool {
 	return header.EventType == PHYSICS_EVENT || header.EventType == CALIBRATION_EVENT
 }
 
-func ReadEventFromFile(file *os.File) (EventHeaderStruct, []byte, error) {
+// Reads the next event from a file or any other stream of events
+func ReadEventFromFile(file io.Reader) (EventHeaderStruct, []byte, error) {
 	var header EventHeaderStruct
 	headerSize := unsafe.Sizeof(header)
 	headerBinary := make([]byte, headerSize)
-	nRead, err := file.Read(headerBinary)
+	_, err := io.ReadFull(file, headerBinary)
 	if err != nil {
 		return header, nil, err
 	}
 
-	if nRead == 0 {
-		return header, nil, err
-	}
-
 	headerReader := bytes.NewReader(headerBinary)
 	binary.Read(headerReader, binary.LittleEndian, &header)
 
+	if uint32(header.EventSize) < uint32(headerSize) {
+		return header, nil, &ErrEventSize{Size: uint32(header.EventSize), HeaderSize: int(headerSize)}
+	}
 	payloadSize := uint32(header.EventSize) - uint32(headerSize)
 	eventData := make([]byte, payloadSize)
-	file.Read(eventData)
+	_, err = io.ReadFull(file, eventData)
+	if err != nil {
+		return header, nil, err
+	}
 	return header, eventData, nil
 
 }
@@ -44,142 +48,385 @@ func ReadEvent(data []byte) (EventHeaderStruct, []byte, error) {
 	headerReader := bytes.NewReader(data[:headerSize])
 	binary.Read(headerReader, binary.LittleEndian, &header)
 
+	if uint32(header.EventSize) < uint32(headerSize) {
+		return header, nil, &ErrEventSize{Size: uint32(header.EventSize), HeaderSize: int(headerSize)}
+	}
+	if uint64(header.EventSize) > uint64(len(data)) {
+		return header, nil, &ErrOutOfBounds{What: "event end", Index: int(header.EventSize), Length: len(data)}
+	}
 	payloadSize := uint32(header.EventSize) - uint32(headerSize)
 	eventData := data[headerSize : uint32(headerSize)+payloadSize]
 	return header, eventData, nil
 }
 
-func ReadGDC(eventData []byte, header EventHeaderStruct) (EventType, error) {
+// State shared by all the FECs of an event while it is being decoded
+type gdcState struct {
 	// Map to keep SiPM data until is read. FEC-ID -> SiPM data
-	var sipmPayloads map[uint16][]uint16 = make(map[uint16][]uint16)
+	sipmPayloads map[uint16][]uint16
+	sync         fecSync
+	// FECs with problems in their headers, only used with KeepPartial
+	invalidFecs map[uint16]bool
+}
 
-	event := EventType{
-		PmtWaveforms:  make(map[uint16][]int16),
-		BlrWaveforms:  make(map[uint16][]int16),
-		SipmWaveforms: make(map[uint16][]int16),
-		Baselines:     make(map[uint16]uint16),
-		BlrBaselines:  make(map[uint16]uint16),
+func newEvent(header EventHeaderStruct) EventType {
+	return EventType{
+		RunNumber:          uint32(header.EventRunNb),
+		EventID:            EventIdGetNbInRun(header.EventId),
+		DateEventType:      header.EventType,
+		PmtWaveforms:       make(map[uint16][]int16),
+		BlrWaveforms:       make(map[uint16][]int16),
+		SipmWaveforms:      make(map[uint16][]int16),
+		Baselines:          make(map[uint16]uint16),
+		BlrBaselines:       make(map[uint16]uint16),
+		InvalidChannels:    make(map[uint16]bool),
+		InvalidBlrChannels: make(map[uint16]bool),
+	}
+}
+
+func ReadGDC(eventData []byte, header EventHeaderStruct) (EventType, error) {
+	defer Metrics.DecodeSeconds.ObserveDuration(time.Now())
+	state := &gdcState{
+		sipmPayloads: make(map[uint16][]uint16),
+		invalidFecs:  make(map[uint16]bool),
+	}
+	event := newEvent(header)
+	if configuration.CheckFecSync {
+		state.sync.chooseReference(readFecHeaders(eventData))
 	}
-	event.RunNumber = uint32(header.EventRunNb)
-	event.EventID = EventIdGetNbInRun(header.EventId)
 
 	// Read LDCs
 	position := 0
-	for {
-		nRead := readLDC(eventData, position, &event, sipmPayloads)
+	for position < len(eventData) {
+		nRead, err := readLDC(eventData, position, &event, state)
+		if err != nil {
+			event.Error = true
+			return event, err
+		}
 		// Next LDC
 		position += nRead
-		if position >= len(eventData) {
-			break
-		}
 	}
 
 	processPmtIds(&event, configuration)
+	Metrics.EventsDecoded.Inc()
 	return event, nil
 }
 
-func readLDC(eventData []byte, position int, event *EventType, sipmPayloads map[uint16][]uint16) int {
+func readLDC(eventData []byte, position int, event *EventType, state *gdcState) (int, error) {
 	var header EventHeaderStruct
-	headerSize := unsafe.Sizeof(header)
-	ldcHeaderBinary := eventData[position : position+int(headerSize)]
+	headerSize := int(unsafe.Sizeof(header))
+	if position+headerSize > len(eventData) {
+		return 0, &ErrOutOfBounds{What: "LDC header end", Index: position + headerSize, Length: len(eventData)}
+	}
+	ldcHeaderBinary := eventData[position : position+headerSize]
 	ldcHeaderReader := bytes.NewReader(ldcHeaderBinary)
 	binary.Read(ldcHeaderReader, binary.LittleEndian, &header)
 
+	if int(header.EventHeadSize) < headerSize || header.EventSize < EventSizeType(header.EventHeadSize) {
+		return 0, &ErrEventSize{Size: uint32(header.EventSize), HeaderSize: int(header.EventHeadSize)}
+	}
+	ldcEnd := position + int(header.EventSize)
+	if ldcEnd > len(eventData) {
+		return 0, &ErrOutOfBounds{What: "LDC end", Index: ldcEnd, Length: len(eventData)}
+	}
+
 	// Read equipment header
 	startLDCPayload := position + int(header.EventHeadSize)
+	ldcPayload := eventData[startLDCPayload:ldcEnd]
 	startPosition := 0
-	for {
-		nRead := readEquipment(eventData[startLDCPayload:], startPosition, header, event, sipmPayloads)
+	for startPosition < len(ldcPayload) {
+		nRead, err := readEquipment(ldcPayload, startPosition, header, event, state)
+		if err != nil {
+			return 0, err
+		}
 		// Next equipment
 		startPosition += nRead
-		if startPosition+int(header.EventHeadSize) >= int(header.EventSize) {
+	}
+
+	return int(header.EventSize), nil
+}
+
+// Words read from each FEC to get its common header, which is shorter
+const COMMON_HEADER_WORDS = 32
+
+// Common headers of all the FECs of the event, in the order they are read.
+// Equipments that cannot be read are left out, readLDC reports them later.
+func readFecHeaders(eventData []byte) []EventFormat {
+	var header EventHeaderStruct
+	var eqHeader EquipmentHeaderStruct
+	headerSize := int(unsafe.Sizeof(header))
+	eqHeaderSize := int(unsafe.Sizeof(eqHeader))
+
+	headers := make([]EventFormat, 0)
+	position := 0
+	for position+headerSize <= len(eventData) {
+		binary.Read(bytes.NewReader(eventData[position:position+headerSize]), binary.LittleEndian, &header)
+		ldcEnd := position + int(header.EventSize)
+		if int(header.EventHeadSize) < headerSize || header.EventSize < EventSizeType(header.EventHeadSize) ||
+			ldcEnd > len(eventData) {
 			break
 		}
+		eqPosition := position + int(header.EventHeadSize)
+		for eqPosition+eqHeaderSize <= ldcEnd {
+			binary.Read(bytes.NewReader(eventData[eqPosition:eqPosition+eqHeaderSize]), binary.LittleEndian, &eqHeader)
+			eqEnd := eqPosition + int(eqHeader.EquipmentSize)
+			if int(eqHeader.EquipmentSize) < eqHeaderSize || eqEnd > ldcEnd {
+				break
+			}
+			start := eqPosition + eqHeaderSize
+			words, _ := flipWords(eventData[start:min(eqEnd, start+2*COMMON_HEADER_WORDS)])
+			if evtFormat, err := ReadCommonHeader(words); err == nil {
+				headers = append(headers, evtFormat)
+			}
+			eqPosition = eqEnd
+		}
+		position = ldcEnd
 	}
-
-	return int(header.EventSize)
+	return headers
 }
 
+// Errors in the equipment headers are returned, as the rest of the LDC cannot
+// be read. Errors in the FEC payload are kept in the event.
 func readEquipment(eventData []byte, position int, header EventHeaderStruct, event *EventType,
-	sipmPayloads map[uint16][]uint16) int {
+	state *gdcState) (int, error) {
 	var eqHeader EquipmentHeaderStruct
-	eqHeaderSize := unsafe.Sizeof(eqHeader)
+	eqHeaderSize := int(unsafe.Sizeof(eqHeader))
 
-	eqHeaderBinary := eventData[position : position+int(eqHeaderSize)]
+	if position+eqHeaderSize > len(eventData) {
+		return 0, &ErrOutOfBounds{What: "equipment header end", Index: position + eqHeaderSize, Length: len(eventData)}
+	}
+	eqHeaderBinary := eventData[position : position+eqHeaderSize]
 	eqHeaderReader := bytes.NewReader(eqHeaderBinary)
 	binary.Read(eqHeaderReader, binary.LittleEndian, &eqHeader)
 	nRead := int(eqHeader.EquipmentSize)
 
-	start := position + int(eqHeaderSize)
+	start := position + eqHeaderSize
 	end := position + int(eqHeader.EquipmentSize)
-	payload := flipWords(eventData[start:end])
+	if nRead < eqHeaderSize {
+		return 0, &ErrEventSize{Size: uint32(eqHeader.EquipmentSize), HeaderSize: eqHeaderSize}
+	}
+	if end > len(eventData) {
+		return 0, &ErrOutOfBounds{What: "equipment end", Index: end, Length: len(eventData)}
+	}
+	payload, seqCounters := flipWords(eventData[start:end])
+	log := ModuleLogger("dateReader")
 
-	evtFormat := ReadCommonHeader(payload)
+	evtFormat, err := ReadCommonHeader(payload)
+	if err != nil {
+		fecDecodeError(event, evtFormat.FecID, err)
+		return nRead, nil
+	}
 	// Set event timestamp. All subevents should be at the same time
 	// so we can use the timestamp from the any of them
 	event.Timestamp = evtFormat.Timestamp
 	// Set trigger type. All subevents should have the same trigger type
 	event.TriggerType = evtFormat.TriggerType
 
+	// Check that this FEC agrees with the rest of the event
+	if configuration.CheckFecSync {
+		errs := state.sync.check(&evtFormat, event.EventID)
+		if len(errs) > 0 {
+			for _, err := range errs {
+				log.Error(err.Error(), "run", event.RunNumber, "event", event.EventID, "fec", evtFormat.FecID)
+				if desync, ok := err.(*ErrFecDesync); ok {
+					Metrics.FecDesyncs.Inc(fecLabel(desync.FecID), desync.Field)
+				}
+			}
+			event.Desync = true
+			event.SyncErrors = append(event.SyncErrors, errs...)
+			if configuration.DiscardDesync {
+				state.fecFailed(event, evtFormat.FecID)
+			}
+		}
+	}
+
+	// Check sequence counters and drop the padding after the data
+	dataEnd := len(payload)
+	if configuration.CheckWordCount {
+		errs := checkSequenceCounters(&evtFormat, seqCounters, event.EventID)
+		var err error
+		dataEnd, err = payloadEnd(&evtFormat, len(payload), event.EventID)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, err := range errs {
+			log.Error(err.Error(), "run", event.RunNumber, "event", event.EventID, "fec", evtFormat.FecID)
+			state.fecFailed(event, evtFormat.FecID)
+		}
+		if len(errs) > 0 && configuration.Discard && !configuration.KeepPartial {
+			return nRead, nil
+		}
+	}
+	data := payload[evtFormat.HeaderSize:dataEnd]
+
 	// Check error bit
 	if evtFormat.ErrorBit {
-		evtNumber := event.EventID
-		errMessage := fmt.Sprintf("event %d ErrorBit is %t, fec: 0x%x", evtNumber, evtFormat.ErrorBit, evtFormat.FecID)
-		logger.Error(errMessage)
-		event.Error = true
-		if configuration.Discard {
-			return nRead
+		log.Error("ErrorBit set", "run", event.RunNumber, "event", event.EventID, "fec", evtFormat.FecID)
+		Metrics.FecErrorBits.Inc(fecLabel(evtFormat.FecID))
+		state.fecFailed(event, evtFormat.FecID)
+		if configuration.Discard && !configuration.KeepPartial {
+			return nRead, nil
 		}
 	}
 
+	// Keeping partial events, each FEC is decoded apart and then merged
+	// into the event, only with zeros if the FEC had any problem
+	fecEvent := event
+	if configuration.KeepPartial {
+		scratch := newEvent(header)
+		fecEvent = &scratch
+	}
+
 	switch evtFormat.FWVersion {
 	case 10:
 		switch evtFormat.FecType {
 		case 0:
-			if configuration.Verbosity > 1 {
-				message := fmt.Sprintf("PMT FEC %d (0x%02x)", evtFormat.FecID, evtFormat.FecID)
-				logger.Info(message, "dateReader")
-			}
+			log.Debug("PMT FEC", "run", event.RunNumber, "event", event.EventID, "fec", evtFormat.FecID)
 			if configuration.ReadPMTs {
-				ReadPmtFEC(payload[evtFormat.HeaderSize:], &evtFormat, &header, event)
+				consumed, err := ReadPmtFEC(data, &evtFormat, &header, fecEvent)
+				if err != nil {
+					fecDecodeError(fecEvent, evtFormat.FecID, err)
+				} else {
+					checkFecWordCount(&evtFormat, consumed, len(data), fecEvent)
+				}
+				if configuration.KeepPartial {
+					valid := state.fecValid(fecEvent, evtFormat.FecID)
+					mergeFecData(event, fecEvent, valid)
+				}
 			}
 		case 1:
-			if configuration.Verbosity > 1 {
-				message := fmt.Sprintf("SiPM FEC %d (0x%02x)", evtFormat.FecID, evtFormat.FecID)
-				logger.Info(message, "dateReader")
-			}
+			log.Debug("SiPM FEC", "run", event.RunNumber, "event", event.EventID, "fec", evtFormat.FecID)
 			if configuration.ReadSiPMs {
-				ReadSipmFEC(payload[evtFormat.HeaderSize:], &evtFormat, &header, event, sipmPayloads)
+				err := ReadSipmFEC(data, &evtFormat, &header, fecEvent, state.sipmPayloads)
+				if err != nil {
+					fecDecodeError(fecEvent, evtFormat.FecID, err)
+				}
+				if configuration.KeepPartial {
+					// Both links of the FEC are decoded together
+					partner := evtFormat.FecID ^ 1
+					valid := state.fecValid(fecEvent, evtFormat.FecID, partner)
+					mergeFecData(event, fecEvent, valid)
+				}
 			}
 		case 2:
-			if configuration.Verbosity > 1 {
-				message := fmt.Sprintf("Triger FEC %d (0x%02x)", evtFormat.FecID, evtFormat.FecID)
-				logger.Info(message, "dateReader")
-			}
+			log.Debug("Trigger FEC", "run", event.RunNumber, "event", event.EventID, "fec", evtFormat.FecID)
 			if configuration.ReadTrigger {
-				ReadTriggerFEC(payload[evtFormat.HeaderSize:], event)
+				err := ReadTriggerFEC(data, fecEvent)
+				if err != nil {
+					fecDecodeError(fecEvent, evtFormat.FecID, err)
+				}
+				if configuration.KeepPartial {
+					// The trigger data of a broken FEC is left as zeros
+					if state.fecValid(fecEvent, evtFormat.FecID) {
+						event.TriggerConfig = fecEvent.TriggerConfig
+					} else {
+						event.InvalidTrigger = true
+					}
+					event.DecodeErrors = append(event.DecodeErrors, fecEvent.DecodeErrors...)
+				}
 			}
 		}
 	default:
-		errMessage := fmt.Errorf("Unknown firwmare version: %d. Event ID %d, FEC 0x%02x",
-			evtFormat.FWVersion, EventIdGetNbInRun(header.EventId), evtFormat.FecID)
-		logger.Error(errMessage.Error())
+		log.Error("Unknown firmware version", "fwVersion", evtFormat.FWVersion,
+			"run", event.RunNumber, "event", EventIdGetNbInRun(header.EventId), "fec", evtFormat.FecID)
 	}
 
-	return nRead
+	return nRead, nil
 }
 
-func flipWords(data []byte) []uint16 {
+// Marks a FEC as broken. Keeping partial events only the channels of this
+// FEC are masked, otherwise the whole event is flagged.
+func (s *gdcState) fecFailed(event *EventType, fecID uint16) {
+	if configuration.KeepPartial {
+		s.invalidFecs[fecID] = true
+	} else {
+		event.Error = true
+	}
+}
+
+// A FEC decoded apart is valid if neither its headers nor its payload had
+// any problem
+func (s *gdcState) fecValid(fecEvent *EventType, fecIDs ...uint16) bool {
+	if fecEvent.Error || len(fecEvent.DecodeErrors) > 0 {
+		return false
+	}
+	for _, fecID := range fecIDs {
+		if s.invalidFecs[fecID] {
+			return false
+		}
+	}
+	return true
+}
+
+// Copies the data of a FEC decoded apart into the event. Channels of a
+// broken FEC are written as zeros and flagged as invalid.
+func mergeFecData(event *EventType, fecEvent *EventType, valid bool) {
+	mergeWaveforms := func(to map[uint16][]int16, from map[uint16][]int16) {
+		for elecID, waveform := range from {
+			if !valid {
+				waveform = make([]int16, len(waveform))
+				event.InvalidChannels[elecID] = true
+			}
+			to[elecID] = waveform
+		}
+	}
+	mergeWaveforms(event.PmtWaveforms, fecEvent.PmtWaveforms)
+	mergeWaveforms(event.SipmWaveforms, fecEvent.SipmWaveforms)
+	if valid {
+		for elecID, baseline := range fecEvent.Baselines {
+			event.Baselines[elecID] = baseline
+		}
+	}
+	event.DecodeErrors = append(event.DecodeErrors, fecEvent.DecodeErrors...)
+}
+
+// Records an error decoding the payload of a FEC, the rest of the event
+// is still decoded. Keeping partial events, the event is not flagged, only
+// the channels of the FEC.
+func fecDecodeError(event *EventType, fecID uint16, err error) {
+	decodeErr := &ErrDecode{
+		EventID: event.EventID,
+		FecID:   fecID,
+		Err:     err,
+	}
+	ModuleLogger("dateReader").Error(decodeErr.Error(), "run", event.RunNumber, "event", event.EventID, "fec", fecID)
+	Metrics.FecDecodeErrors.Inc(fecLabel(fecID))
+	event.DecodeErrors = append(event.DecodeErrors, decodeErr)
+	if !configuration.KeepPartial {
+		event.Error = true
+	}
+}
+
+func checkFecWordCount(evtFormat *EventFormat, consumed int, available int, event *EventType) {
+	if !configuration.CheckWordCount {
+		return
+	}
+	err := checkConsumedWords(evtFormat, consumed, available, event.EventID)
+	if err != nil {
+		ModuleLogger("dateReader").Error(err.Error(),
+			"run", event.RunNumber, "event", event.EventID, "fec", evtFormat.FecID)
+		event.Error = true
+	}
+}
+
+// Returns the flipped payload and the sequence counters found in it
+func flipWords(data []byte) ([]uint16, []uint32) {
 	positionIn := 0
 	positionOut := 0
 
-	dataUint16 := *(*[]uint16)(unsafe.Pointer(&data))
-	dataFlipped := make([]uint16, len(data)/2) // TODO round up
+	nWords := len(data) / 2
+	if nWords == 0 {
+		return []uint16{}, []uint32{}
+	}
+	dataUint16 := unsafe.Slice((*uint16)(unsafe.Pointer(&data[0])), nWords)
+	dataFlipped := make([]uint16, nWords) // TODO round up
+	seqCounters := make([]uint32, 0)
 
-	for positionIn*2 < len(data) {
+	for positionIn+1 < nWords {
 		// Skip sequence counters. Size taken empirically
-		if positionIn > 0 && positionIn%3996 == 0 {
+		if positionIn > 0 && positionIn%SEQ_COUNTER_PERIOD == 0 {
+			seqCounters = append(seqCounters, (uint32(dataUint16[positionIn+1])<<16)|uint32(dataUint16[positionIn]))
 			positionIn += 2
+			continue
 		}
 		dataFlipped[positionOut] = dataUint16[positionIn+1]
 		dataFlipped[positionOut+1] = dataUint16[positionIn]
@@ -187,5 +434,5 @@ func flipWords(data []byte) []uint16 {
 		positionOut += 2
 	}
 
-	return dataFlipped[:positionOut]
+	return dataFlipped[:positionOut], seqCounters
 }
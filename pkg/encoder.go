@@ -0,0 +1,299 @@
+package decoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"unsafe"
+)
+
+// Encoding counterpart of the readers. Each function writes what the
+// corresponding reader expects, so the output can be decoded back.
+
+// Common header of firmware 10. WordCount is written as given, the caller
+// sets it once the payload is known.
+func EncodeCommonHeader(evtFormat *EventFormat) []uint16 {
+	words := make([]uint16, 0, 22)
+
+	// Sequence counter, always 0 in the header
+	words = append(words, 0, 0)
+
+	//Format ID H
+	formatID := evtFormat.FecType & 0x000F
+	if evtFormat.ZeroSuppression {
+		formatID |= 0x0010
+	}
+	if evtFormat.CompressedData {
+		formatID |= 0x0020
+	}
+	if evtFormat.Baseline {
+		formatID |= 0x0040
+	}
+	if evtFormat.DualModeBit {
+		formatID |= 0x0080
+	}
+	if evtFormat.ErrorBit {
+		formatID |= 0x4000
+	}
+	words = append(words, formatID)
+
+	//Format ID L
+	words = append(words, evtFormat.FWVersion)
+
+	//Word count
+	words = append(words, evtFormat.WordCount)
+
+	//Event ID
+	words = append(words,
+		uint16((evtFormat.TriggerCounter>>16)&0x0FFF)<<4|(evtFormat.TriggerType&0x000F),
+		uint16(evtFormat.TriggerCounter&0x0FFFF))
+
+	//Event conf0-4
+	words = append(words,
+		uint16(evtFormat.BufferSamples/2),
+		uint16(evtFormat.PreTrigger/2),
+		uint16(evtFormat.BufferSamples2/2),
+		uint16(evtFormat.PreTrigger2/2),
+		evtFormat.ChannelMask)
+
+	//Baselines, same pattern as readIndiaBaselines
+	if evtFormat.Baseline {
+		b := make([]uint16, 6)
+		copy(b, evtFormat.Baselines)
+		for i := range b {
+			b[i] &= 0x0FFF
+		}
+		words = append(words,
+			b[0]<<4|b[1]>>8,
+			b[1]<<8|b[2]>>4,
+			b[2]<<12|b[3],
+			b[4]<<4|b[5]>>8,
+			b[5]<<8)
+	}
+
+	//FEC ID
+	words = append(words, (evtFormat.FecID&0x07FF)<<5|(evtFormat.NumberOfChannels&0x001F))
+
+	//Timestamp high, low, FTH & CTms
+	timestamp := evtFormat.Timestamp & 0x03FFFFFFFFFF
+	words = append(words,
+		uint16(timestamp>>26),
+		uint16(timestamp>>10),
+		uint16(timestamp&0x03FF)|uint16(evtFormat.FTBit&0x1)<<15)
+
+	//FTl
+	words = append(words, evtFormat.TriggerFT)
+
+	return words
+}
+
+// Packs 12-bit charges, four charges in three words (see decodeCharge)
+func encodeCharges(charges []int16) []uint16 {
+	words := make([]uint16, 0, (3*len(charges)+3)/4)
+	for i, c := range charges {
+		charge := uint16(c) & 0x0FFF
+		switch i % 4 {
+		case 0:
+			words = append(words, charge<<4)
+		case 1:
+			words[len(words)-1] |= charge >> 8
+			words = append(words, charge<<8)
+		case 2:
+			words[len(words)-1] |= charge >> 4
+			words = append(words, charge<<12)
+		case 3:
+			words[len(words)-1] |= charge
+		}
+	}
+	return words
+}
+
+// Writes a stream of bits, most significant bit first, as the compressed
+// data is read
+type bitWriter struct {
+	words []uint16
+	free  int // Free bits in the last word
+}
+
+func (w *bitWriter) writeBit(bit uint16) {
+	if w.free == 0 {
+		w.words = append(w.words, 0)
+		w.free = 16
+	}
+	w.free--
+	w.words[len(w.words)-1] |= (bit & 0x1) << w.free
+}
+
+func (w *bitWriter) write(value uint32, nBits int) {
+	for i := nBits - 1; i >= 0; i-- {
+		w.writeBit(uint16(value>>i) & 0x1)
+	}
+}
+
+func (w *bitWriter) writeCode(code string) {
+	for i := 0; i < len(code); i++ {
+		w.writeBit(uint16(code[i] - '0'))
+	}
+}
+
+// Huffman codes used to compress the differences between consecutive
+// samples. The HUFFMAN_CONTROL_CODE entry is followed by a raw 12-bit value.
+type HuffmanTable map[int32]string
+
+// Codes for differences up to +-6, shorter codes for smaller differences
+func DefaultHuffmanTable() HuffmanTable {
+	table := HuffmanTable{
+		0:                    "10",
+		HUFFMAN_CONTROL_CODE: "11",
+	}
+	for diff := 1; diff <= 6; diff++ {
+		prefix := strings.Repeat("0", diff) + "1"
+		table[int32(diff)] = prefix + "0"
+		table[int32(-diff)] = prefix + "1"
+	}
+	return table
+}
+
+// Builds the tree used by the decoder
+func (table HuffmanTable) Tree() *HuffmanNode {
+	huffman := &HuffmanNode{}
+	for value, code := range table {
+		parse_huffman_line(value, code, huffman)
+	}
+	return huffman
+}
+
+// Checks that the table can be decoded: a control code, only 0s and 1s
+// and no code being the prefix of another one. The decoder reads the code
+// and the raw value from a 32-bit window with at least 17 bits left.
+func (table HuffmanTable) Validate() error {
+	control, found := table[HUFFMAN_CONTROL_CODE]
+	if !found {
+		return fmt.Errorf("huffman table has no control code")
+	}
+	if len(control)+12 > 17 {
+		return fmt.Errorf("huffman control code %s is too long", control)
+	}
+	codes := make([]string, 0, len(table))
+	for value, code := range table {
+		if len(code) == 0 || len(code) > 17 || strings.Trim(code, "01") != "" {
+			return fmt.Errorf("invalid huffman code %q for value %d", code, value)
+		}
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for i := 1; i < len(codes); i++ {
+		if strings.HasPrefix(codes[i], codes[i-1]) {
+			return fmt.Errorf("huffman code %s is a prefix of %s", codes[i-1], codes[i])
+		}
+	}
+	return nil
+}
+
+// Writes value as a difference with previous or, if there is no code for
+// the difference, as a control code followed by the raw value
+func (table HuffmanTable) encode(w *bitWriter, previous int16, value int16) {
+	diff := int32(value) - int32(previous)
+	if code, found := table[diff]; found && diff != HUFFMAN_CONTROL_CODE {
+		w.writeCode(code)
+		return
+	}
+	w.writeCode(table[HUFFMAN_CONTROL_CODE])
+	w.write(uint32(value)&0x0FFF, 12)
+}
+
+// Payload of the trigger FEC, see ReadTriggerFEC
+func EncodeTriggerData(trg *TriggerData) []uint16 {
+	words := make([]uint16, 0, 17)
+
+	//TRG conf 8, 7
+	words = append(words, uint16(trg.TriggerMask>>16)&0x03FF, uint16(trg.TriggerMask))
+
+	//TRG conf 6, 5
+	words = append(words, trg.TriggerDiff1, trg.TriggerDiff2)
+
+	//TRG conf 4
+	words = append(words, trg.WindowA1&0x003F|(trg.ChanA1&0x007F)<<6|
+		(trg.AutoTrigger&0x1)<<13|(trg.DualTrigger&0x1)<<14|(trg.ExternalTrigger&0x1)<<15)
+
+	//TRG conf 3
+	words = append(words, trg.WindowB1&0x003F|(trg.ChanB1&0x007F)<<6|
+		(trg.Mask&0x1)<<13|(trg.TriggerB2&0x1)<<14|(trg.TriggerB1&0x1)<<15)
+
+	//TRG conf 2, 1
+	words = append(words, trg.WindowA2&0x003F|(trg.ChanA2&0x007F)<<6)
+	words = append(words, trg.WindowB2&0x003F|(trg.ChanB2&0x007F)<<6)
+
+	//TRG conf 0
+	words = append(words, trg.TriggerExtN&0x000F|(trg.TriggerIntN&0x0FFF)<<4)
+
+	//Trigger type
+	words = append(words, (trg.TriggerType&0x1)<<15)
+
+	//Channels producing trigger: 47-32, 31-16, 15-0
+	channels := make([]uint16, 3)
+	for _, elecID := range trg.TrgChannels {
+		channelNumber := trgChannelNumber(elecID)
+		if channelNumber < 48 {
+			channels[2-channelNumber/16] |= 1 << (channelNumber % 16)
+		}
+	}
+	words = append(words, channels...)
+
+	//Trigger lost type 2, type 1
+	words = append(words, uint16(trg.TriggerLost2>>16), uint16(trg.TriggerLost2))
+	words = append(words, uint16(trg.TriggerLost1>>16), uint16(trg.TriggerLost1))
+
+	return words
+}
+
+// Flips the 16-bit words and inserts the sequence counters, reverting what
+// flipWords does. Words go in pairs, an odd payload is padded with zero.
+func EncodePayload(words []uint16) []byte {
+	raw := make([]uint16, 0, len(words)+2*(len(words)/SEQ_COUNTER_PERIOD+1)+1)
+	var counter uint32 = 1
+	for i := 0; i < len(words); i += 2 {
+		if len(raw) > 0 && len(raw)%SEQ_COUNTER_PERIOD == 0 {
+			raw = append(raw, uint16(counter), uint16(counter>>16))
+			counter++
+		}
+		var next uint16
+		if i+1 < len(words) {
+			next = words[i+1]
+		}
+		raw = append(raw, next, words[i])
+	}
+
+	data := make([]byte, 2*len(raw))
+	for i, word := range raw {
+		binary.LittleEndian.PutUint16(data[2*i:], word)
+	}
+	return data
+}
+
+// Equipment header followed by the FEC payload. EquipmentSize is computed.
+func EncodeEquipment(eqHeader EquipmentHeaderStruct, words []uint16) []byte {
+	payload := EncodePayload(words)
+	eqHeader.EquipmentSize = EquipmentSizeType(int(unsafe.Sizeof(eqHeader)) + len(payload))
+
+	buffer := new(bytes.Buffer)
+	binary.Write(buffer, binary.LittleEndian, eqHeader)
+	buffer.Write(payload)
+	return buffer.Bytes()
+}
+
+// DATE header followed by its payload, used both for GDCs (the payload is
+// a list of LDCs) and LDCs (the payload is a list of equipments).
+// EventSize and EventHeadSize are computed.
+func EncodeEvent(header EventHeaderStruct, payload []byte) []byte {
+	headerSize := int(unsafe.Sizeof(header))
+	header.EventHeadSize = EventHeadSizeType(headerSize)
+	header.EventSize = EventSizeType(headerSize + len(payload))
+
+	buffer := new(bytes.Buffer)
+	binary.Write(buffer, binary.LittleEndian, header)
+	buffer.Write(payload)
+	return buffer.Bytes()
+}
@@ -1,33 +1,146 @@
 package decoder
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
-// ErrOpenFile represents an error when opening a file.
-type ErrOpenFile struct {
-	Filename string
-	Err      error
+// ErrFecDesync represents a mismatch between the NEXT common headers of two
+// FECs belonging to the same event.
+type ErrFecDesync struct {
+	EventID  uint32
+	Field    string
+	RefFecID uint16
+	FecID    uint16
+	Expected uint64
+	Got      uint64
 }
 
-func (e *ErrOpenFile) Error() string {
-	return fmt.Sprintf("error opening file %q: %v", e.Filename, e.Err)
+func (e *ErrFecDesync) Error() string {
+	return fmt.Sprintf("event %d: %s mismatch, fec 0x%02x has %d, fec 0x%02x has %d",
+		e.EventID, e.Field, e.RefFecID, e.Expected, e.FecID, e.Got)
 }
 
-// ErrCreateGroup represents an error when creating a group.
-type ErrCreateGroup struct {
-	GroupName string
-	Err       error
+// ErrSeqCounter represents a gap in the sequence counters inserted by the DAQ
+// in the payload of a FEC.
+type ErrSeqCounter struct {
+	EventID  uint32
+	FecID    uint16
+	Index    int
+	Expected uint32
+	Got      uint32
 }
 
-func (e *ErrCreateGroup) Error() string {
-	return fmt.Sprintf("error creating group %q: %v", e.GroupName, e.Err)
+func (e *ErrSeqCounter) Error() string {
+	return fmt.Sprintf("event %d, fec 0x%02x: sequence counter %d is %d, expected %d",
+		e.EventID, e.FecID, e.Index, e.Got, e.Expected)
 }
 
-// ErrCreateTable represents an error when creating a table.
-type ErrCreateTable struct {
-	TableName string
-	Err       error
+// ErrPayloadOverrun represents a FEC whose header WordCount claims more data
+// than the equipment actually delivered.
+type ErrPayloadOverrun struct {
+	EventID   uint32
+	FecID     uint16
+	WordCount uint16
+	Available int
 }
 
-func (e *ErrCreateTable) Error() string {
-	return fmt.Sprintf("error creating table %q: %v", e.TableName, e.Err)
+func (e *ErrPayloadOverrun) Error() string {
+	return fmt.Sprintf("event %d, fec 0x%02x: WordCount %d overruns the %d words available",
+		e.EventID, e.FecID, e.WordCount, e.Available)
+}
+
+// ErrWordCountMismatch represents a FEC whose decoded data did not use the
+// number of words announced by the header WordCount.
+type ErrWordCountMismatch struct {
+	EventID  uint32
+	FecID    uint16
+	Expected int
+	Consumed int
+}
+
+func (e *ErrWordCountMismatch) Error() string {
+	return fmt.Sprintf("event %d, fec 0x%02x: decoded %d data words, WordCount announced %d",
+		e.EventID, e.FecID, e.Consumed, e.Expected)
+}
+
+// ErrOutOfBounds represents an access outside of the data being decoded.
+type ErrOutOfBounds struct {
+	What   string
+	Index  int
+	Length int
+}
+
+func (e *ErrOutOfBounds) Error() string {
+	return fmt.Sprintf("%s %d out of range (length %d)", e.What, e.Index, e.Length)
+}
+
+// ErrHuffmanCode represents compressed data that does not match any of the
+// Huffman codes.
+type ErrHuffmanCode struct {
+	Code     uint32
+	Position int
+}
+
+func (e *ErrHuffmanCode) Error() string {
+	return fmt.Sprintf("invalid huffman code in 0x%08x at bit %d", e.Code, e.Position)
+}
+
+// ErrSipmLinks represents a SiPM FEC whose two links carry a different
+// amount of data.
+type ErrSipmLinks struct {
+	LengthA int
+	LengthB int
+}
+
+func (e *ErrSipmLinks) Error() string {
+	return fmt.Sprintf("data from both SiPM links must have the same length: %d != %d", e.LengthA, e.LengthB)
+}
+
+// ErrDecode represents a FEC whose payload could not be decoded. The rest of
+// the FECs of the event are still decoded.
+type ErrDecode struct {
+	EventID uint32
+	FecID   uint16
+	Err     error
+}
+
+func (e *ErrDecode) Error() string {
+	return fmt.Sprintf("event %d, fec 0x%02x: error decoding payload: %v", e.EventID, e.FecID, e.Err)
+}
+
+func (e *ErrDecode) Unwrap() error {
+	return e.Err
+}
+
+// ErrEventSize represents a DATE or equipment header whose size field is
+// smaller than the header itself.
+type ErrEventSize struct {
+	Size       uint32
+	HeaderSize int
+}
+
+func (e *ErrEventSize) Error() string {
+	return fmt.Sprintf("invalid size %d, the header alone is %d bytes", e.Size, e.HeaderSize)
+}
+
+// ErrInvalidConfiguration represents a configuration key with a value that
+// is not valid or not consistent with the rest of the configuration.
+type ErrInvalidConfiguration struct {
+	Key     string
+	Message string
+}
+
+func (e *ErrInvalidConfiguration) Error() string {
+	return fmt.Sprintf("invalid configuration, %s: %s", e.Key, e.Message)
+}
+
+// ErrOutputFormat represents an output format that no writer has registered.
+type ErrOutputFormat struct {
+	Name      string
+	Available []string
+}
+
+func (e *ErrOutputFormat) Error() string {
+	return fmt.Sprintf("unknown output format %s, available formats: %s", e.Name, strings.Join(e.Available, ", "))
 }
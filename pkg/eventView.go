@@ -0,0 +1,97 @@
+package decoder
+
+import "sort"
+
+// Decoded event with the channels identified by sensor ID, for the event
+// display and any other consumer that wants the event as JSON.
+type EventView struct {
+	RunNumber      uint32
+	EventID        uint32
+	Timestamp      uint64
+	TriggerType    uint16
+	Error          bool
+	Desync         bool
+	Errors         []string
+	Trigger        TriggerData
+	InvalidTrigger bool `json:",omitempty"`
+	Pmts           []ChannelView
+	Blrs           []ChannelView
+	Sipms          []ChannelView
+	ExtTrgWaveform []int16 `json:",omitempty"`
+	PmtSumWaveform []int16 `json:",omitempty"`
+	PmtSumBaseline uint16
+	InvalidExtTrg  bool `json:",omitempty"`
+	InvalidPmtSum  bool `json:",omitempty"`
+}
+
+// SensorID is -1 when there is no database, as in the sensor mapping
+// tables of the output file. Invalid channels come from a broken FEC.
+type ChannelView struct {
+	ElecID   uint16
+	SensorID int32
+	Baseline *uint16 `json:",omitempty"`
+	Invalid  bool    `json:",omitempty"`
+	Waveform []int16
+}
+
+func NewEventView(event EventType) EventView {
+	view := EventView{
+		RunNumber:      event.RunNumber,
+		EventID:        event.EventID,
+		Timestamp:      event.Timestamp,
+		TriggerType:    event.TriggerType,
+		Error:          event.Error,
+		Desync:         event.Desync,
+		Errors:         make([]string, 0),
+		Trigger:        event.TriggerConfig,
+		InvalidTrigger: event.InvalidTrigger,
+		PmtSumBaseline: event.PmtSumBaseline,
+		InvalidExtTrg:  event.InvalidExtTrg,
+		InvalidPmtSum:  event.InvalidPmtSum,
+	}
+	for _, errs := range [][]error{event.SyncErrors, event.DecodeErrors} {
+		for _, err := range errs {
+			view.Errors = append(view.Errors, err.Error())
+		}
+	}
+	view.Pmts = channelViews(event.PmtWaveforms, event.Baselines, event.InvalidChannels, sensorsMap.Pmts)
+	view.Blrs = channelViews(event.BlrWaveforms, event.BlrBaselines, event.InvalidBlrChannels, sensorsMap.Pmts)
+	view.Sipms = channelViews(event.SipmWaveforms, nil, event.InvalidChannels, sensorsMap.Sipms)
+	if event.ExtTrgWaveform != nil {
+		view.ExtTrgWaveform = *event.ExtTrgWaveform
+	}
+	if event.PmtSumWaveform != nil {
+		view.PmtSumWaveform = *event.PmtSumWaveform
+	}
+	return view
+}
+
+// Sorted by sensor ID, or by elecID without database
+func channelViews(waveforms map[uint16][]int16, baselines map[uint16]uint16,
+	invalid map[uint16]bool, mapping SensorMapping) []ChannelView {
+	channels := make([]ChannelView, 0, len(waveforms))
+	for elecID, waveform := range waveforms {
+		channel := ChannelView{
+			ElecID:   elecID,
+			SensorID: -1,
+			Invalid:  invalid[elecID],
+			Waveform: waveform,
+		}
+		if !configuration.NoDB {
+			if sensorID, ok := mapping.ToSensorID[elecID]; ok {
+				channel.SensorID = int32(sensorID)
+			}
+		}
+		if baseline, ok := baselines[elecID]; ok {
+			channel.Baseline = &baseline
+		}
+		channels = append(channels, channel)
+	}
+	sort.Slice(channels, func(i, j int) bool {
+		if channels[i].SensorID != channels[j].SensorID {
+			return channels[i].SensorID < channels[j].SensorID
+		}
+		return channels[i].ElecID < channels[j].ElecID
+	})
+	return channels
+}
@@ -0,0 +1,48 @@
+package decoder
+
+import "testing"
+
+func TestEventViewSensorIDs(t *testing.T) {
+	setupTestConfiguration()
+	event := EventType{
+		EventID:         7,
+		PmtWaveforms:    map[uint16][]int16{5: {1, 2}, 3: {3, 4}},
+		Baselines:       map[uint16]uint16{5: 10, 3: 11},
+		SipmWaveforms:   map[uint16][]int16{1000: {5}, 1001: {6}},
+		InvalidChannels: map[uint16]bool{1001: true},
+		DecodeErrors:    []error{&ErrDecode{EventID: 7, FecID: 2, Err: &ErrSipmLinks{LengthA: 1, LengthB: 2}}},
+	}
+
+	// Without database the channels are sorted by elecID
+	view := NewEventView(event)
+	if len(view.Pmts) != 2 || view.Pmts[0].ElecID != 3 || view.Pmts[0].SensorID != -1 {
+		t.Fatalf("wrong PMT channels: %+v", view.Pmts)
+	}
+	if view.Pmts[0].Baseline == nil || *view.Pmts[0].Baseline != 11 {
+		t.Fatalf("wrong PMT baseline: %+v", view.Pmts[0])
+	}
+	if view.Sipms[0].Baseline != nil || view.Sipms[0].Invalid || !view.Sipms[1].Invalid {
+		t.Fatalf("wrong SiPM channels: %+v", view.Sipms)
+	}
+	if len(view.Errors) != 1 {
+		t.Fatalf("expected one error, got %v", view.Errors)
+	}
+
+	config := testConfiguration()
+	config.NoDB = false
+	SetConfiguration(config)
+	defer SetConfiguration(testConfiguration())
+	sensorsMap = SensorsMap{
+		Pmts:  SensorMapping{ToSensorID: map[uint16]uint16{5: 0, 3: 1}},
+		Sipms: SensorMapping{ToSensorID: map[uint16]uint16{1000: 1001, 1001: 1000}},
+	}
+	defer func() { sensorsMap = SensorsMap{} }()
+
+	view = NewEventView(event)
+	if view.Pmts[0].ElecID != 5 || view.Pmts[0].SensorID != 0 || view.Pmts[1].SensorID != 1 {
+		t.Fatalf("wrong PMT channels: %+v", view.Pmts)
+	}
+	if view.Sipms[0].ElecID != 1001 || view.Sipms[0].SensorID != 1000 {
+		t.Fatalf("wrong SiPM channels: %+v", view.Sipms)
+	}
+}
@@ -0,0 +1,177 @@
+package decoder
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Destination of the decoded events. The HDF5 writer of pkg/hdf5writer is
+// one, other output formats register their own with RegisterOutputFormat.
+type EventWriter interface {
+	WriteEvent(event *EventType)
+	Close() error
+}
+
+// Output format that can be selected with output_format
+type OutputFormat struct {
+	Name string
+	// Used for the file of each format when writing several formats
+	Extension string
+	Open      func(filename string) (EventWriter, error)
+}
+
+var outputFormats = &sync.Map{}
+
+// Makes a format available to NewEventWriter. The packages with writers
+// call it from init, so importing them is enough to use their format.
+func RegisterOutputFormat(format OutputFormat) {
+	outputFormats.Store(format.Name, format)
+}
+
+// Names of the registered formats, sorted
+func OutputFormats() []string {
+	names := make([]string, 0)
+	outputFormats.Range(func(name, _ any) bool {
+		names = append(names, name.(string))
+		return true
+	})
+	sort.Strings(names)
+	return names
+}
+
+// Splits a list of formats like "hdf5,parquet"
+func ParseOutputFormats(formats string) ([]string, error) {
+	names := make([]string, 0)
+	for _, name := range strings.Split(formats, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("empty output format in %q", formats)
+		}
+		if slices.Contains(names, name) {
+			return nil, fmt.Errorf("output format %s is repeated", name)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func selectedFormats(config Configuration) ([]OutputFormat, error) {
+	names, err := ParseOutputFormats(config.OutputFormat)
+	if err != nil {
+		return nil, err
+	}
+	formats := make([]OutputFormat, 0, len(names))
+	for _, name := range names {
+		format, found := outputFormats.Load(name)
+		if !found {
+			return nil, &ErrOutputFormat{Name: name, Available: OutputFormats()}
+		}
+		formats = append(formats, format.(OutputFormat))
+	}
+	return formats, nil
+}
+
+// Extension of the output files, the one of the first format when several
+// are written. Used to name the outputs that are not given.
+func OutputExtension(config Configuration) (string, error) {
+	formats, err := selectedFormats(config)
+	if err != nil {
+		return "", err
+	}
+	return formats[0].Extension, nil
+}
+
+// Files written for filename with the formats of config. Each format writes
+// its own file, with the extension of the format instead of the one of
+// filename.
+func OutputFilenames(filename string, config Configuration) ([]string, error) {
+	formats, err := selectedFormats(config)
+	if err != nil {
+		return nil, err
+	}
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	filenames := make([]string, 0, len(formats))
+	for _, format := range formats {
+		filenames = append(filenames, base+format.Extension)
+	}
+	return filenames, nil
+}
+
+// Writer of filename in the formats of the configuration, the events go to
+// all the files given by OutputFilenames
+func NewEventWriter(filename string) (EventWriter, error) {
+	formats, err := selectedFormats(configuration)
+	if err != nil {
+		return nil, err
+	}
+	filenames, _ := OutputFilenames(filename, configuration)
+	if len(formats) == 1 {
+		return formats[0].Open(filenames[0])
+	}
+
+	writers := make([]EventWriter, 0, len(formats))
+	for i, format := range formats {
+		writer, err := format.Open(filenames[i])
+		if err != nil {
+			NewMultiWriter(writers...).Close()
+			return nil, err
+		}
+		writers = append(writers, writer)
+	}
+	return NewMultiWriter(writers...), nil
+}
+
+// Sends every event to all the writers, like io.MultiWriter
+type MultiWriter struct {
+	writers []EventWriter
+}
+
+func NewMultiWriter(writers ...EventWriter) *MultiWriter {
+	return &MultiWriter{writers: writers}
+}
+
+func (m *MultiWriter) WriteEvent(event *EventType) {
+	for _, writer := range m.writers {
+		writer.WriteEvent(event)
+	}
+}
+
+// Closes all the writers, even if some of them fail
+func (m *MultiWriter) Close() error {
+	errs := make([]error, 0)
+	for _, writer := range m.writers {
+		if err := writer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Writes the event to the output of its route. Events with errors are
+// dropped when the configuration discards them, and so are the events that
+// no route takes. Both are counted as discarded.
+func ProcessDecodedEvent(event EventType, configuration Configuration, router *Router) {
+	if event.Error && configuration.Discard {
+		ModuleLogger("writer").Error("Discarding event with errors", "run", event.RunNumber, "event", event.EventID)
+		Metrics.EventsDiscarded.Inc("error")
+		return
+	}
+	if !configuration.WriteData {
+		return
+	}
+	output := router.Writer(&event)
+	if output == nil {
+		Metrics.EventsDiscarded.Inc("no_route")
+		return
+	}
+	start := time.Now()
+	output.WriteEvent(&event)
+	Metrics.WriteSeconds.ObserveDuration(start)
+	Metrics.EventsWritten.Inc()
+}
@@ -0,0 +1,105 @@
+package decoder
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// Keeps the events instead of writing them
+type recordingWriter struct {
+	filename string
+	events   []uint32
+	closed   bool
+	closeErr error
+}
+
+func (w *recordingWriter) WriteEvent(event *EventType) {
+	w.events = append(w.events, event.EventID)
+}
+
+func (w *recordingWriter) Close() error {
+	w.closed = true
+	return w.closeErr
+}
+
+func TestProcessDecodedEventDiscards(t *testing.T) {
+	setupTestConfiguration()
+	Metrics = NewDecoderMetrics()
+	defer func() { Metrics = NewDecoderMetrics() }()
+
+	config := DefaultGeneratorConfig()
+	config.Faults = Faults{ErrorBit: 1}
+	event := decodeGenerated(t, generateEvent(config).Data)
+	writer := &recordingWriter{}
+	ProcessDecodedEvent(event, testConfiguration(), NewRouter(Routes{{}}, []EventWriter{writer}))
+
+	if len(writer.events) != 0 {
+		t.Fatal("event with errors written")
+	}
+	if Metrics.EventsDiscarded.Value("error") != 1 || Metrics.EventsWritten.Value() != 0 {
+		t.Fatal("event with errors not counted as discarded")
+	}
+}
+
+func TestNewEventWriter(t *testing.T) {
+	setupTestConfiguration()
+	defer setupTestConfiguration()
+	opened := make([]*recordingWriter, 0)
+	for _, name := range []string{"test-a", "test-b"} {
+		RegisterOutputFormat(OutputFormat{
+			Name:      name,
+			Extension: "." + name,
+			Open: func(filename string) (EventWriter, error) {
+				writer := &recordingWriter{filename: filename}
+				opened = append(opened, writer)
+				return writer, nil
+			},
+		})
+	}
+	defer outputFormats.Delete("test-a")
+	defer outputFormats.Delete("test-b")
+
+	config := testConfiguration()
+	config.OutputFormat = "test-a, test-b"
+	SetConfiguration(config)
+	dir := t.TempDir()
+	writer, err := NewEventWriter(filepath.Join(dir, "run.h5"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.WriteEvent(&EventType{EventID: 7})
+	opened[1].closeErr = errors.New("disk full")
+	if err := writer.Close(); err == nil {
+		t.Fatal("close error not reported")
+	}
+	for i, name := range []string{"run.test-a", "run.test-b"} {
+		w := opened[i]
+		if w.filename != filepath.Join(dir, name) || len(w.events) != 1 || !w.closed {
+			t.Fatalf("writer %d: %+v", i, w)
+		}
+	}
+
+	// A single format writes the file given, with the extension of the format
+	config.OutputFormat = "test-a"
+	SetConfiguration(config)
+	if _, err := NewEventWriter(filepath.Join(dir, "run.test-a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewEventWriter(filepath.Join(dir, "run.h5")); err != nil {
+		t.Fatal(err)
+	}
+	if opened[2].filename != filepath.Join(dir, "run.test-a") || opened[3].filename != filepath.Join(dir, "run.test-a") {
+		t.Fatalf("filenames %s %s", opened[2].filename, opened[3].filename)
+	}
+	if extension, err := OutputExtension(config); err != nil || extension != ".test-a" {
+		t.Fatalf("extension %q: %v", extension, err)
+	}
+
+	config.OutputFormat = "unknown"
+	SetConfiguration(config)
+	var formatErr *ErrOutputFormat
+	if _, err := NewEventWriter("run.h5"); !errors.As(err, &formatErr) {
+		t.Fatalf("expected ErrOutputFormat, got %v", err)
+	}
+}
@@ -8,6 +8,8 @@ type EventType struct {
 	Baselines     map[uint16]uint16
 	BlrBaselines  map[uint16]uint16
 	EventID       uint32
+	// PHYSICS_EVENT or CALIBRATION_EVENT, from the DATE header
+	DateEventType EventTypeType
 	Timestamp     uint64
 	TriggerConfig TriggerData
 	// Trigger type is not written correctly in the trigger FEC
@@ -17,6 +19,22 @@ type EventType struct {
 	PmtSumWaveform *[]int16
 	PmtSumBaseline uint16
 	Error          bool
+	// Set when the FECs do not agree on trigger counter, timestamp,
+	// trigger type or FT. SyncErrors holds the *ErrFecDesync found.
+	Desync     bool
+	SyncErrors []error
+	// Errors found decoding the payload of a FEC (*ErrDecode). The data
+	// from the rest of the FECs is kept in the event.
+	DecodeErrors []error
+	// Channels (elecID) coming from a broken FEC when partial events
+	// are kept. Their waveforms are zeros.
+	InvalidChannels    map[uint16]bool
+	InvalidBlrChannels map[uint16]bool
+	// Same for the trigger FEC, whose data is zeros, and for the external
+	// trigger and PMT sum channels
+	InvalidTrigger bool
+	InvalidExtTrg  bool
+	InvalidPmtSum  bool
 }
 
 type SensorsMap struct {
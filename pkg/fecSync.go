@@ -0,0 +1,79 @@
+package decoder
+
+// fecSync keeps the common header that the FECs of an event are checked
+// against. All FECs are triggered by the same signal, any difference means
+// that at least one of them has slipped.
+type fecSync struct {
+	reference *EventFormat
+}
+
+// Header fields that every FEC of an event must share
+type syncFields struct {
+	TriggerCounter uint32
+	Timestamp      uint64
+	TriggerType    uint16
+	FTBit          int32
+	TriggerFT      uint16
+}
+
+func fecSyncFields(evtFormat *EventFormat) syncFields {
+	return syncFields{
+		TriggerCounter: evtFormat.TriggerCounter,
+		Timestamp:      evtFormat.Timestamp,
+		TriggerType:    evtFormat.TriggerType,
+		FTBit:          evtFormat.FTBit,
+		TriggerFT:      evtFormat.TriggerFT,
+	}
+}
+
+// Takes as reference the header shared by most of the FECs, so that the
+// FECs flagged are the ones that slipped even if one of them is read first.
+// With a tie, the first FEC read wins.
+func (s *fecSync) chooseReference(headers []EventFormat) {
+	count := make(map[syncFields]int)
+	best := 0
+	for i := range headers {
+		fields := fecSyncFields(&headers[i])
+		count[fields]++
+		if count[fields] > best {
+			best = count[fields]
+		}
+	}
+	for i := range headers {
+		if count[fecSyncFields(&headers[i])] == best {
+			reference := headers[i]
+			s.reference = &reference
+			return
+		}
+	}
+}
+
+// Without a reference, the first FEC checked is taken as one
+func (s *fecSync) check(evtFormat *EventFormat, eventID uint32) []error {
+	if s.reference == nil {
+		reference := *evtFormat
+		s.reference = &reference
+		return nil
+	}
+
+	ref := s.reference
+	errs := make([]error, 0)
+	compare := func(field string, expected uint64, got uint64) {
+		if expected != got {
+			errs = append(errs, &ErrFecDesync{
+				EventID:  eventID,
+				Field:    field,
+				RefFecID: ref.FecID,
+				FecID:    evtFormat.FecID,
+				Expected: expected,
+				Got:      got,
+			})
+		}
+	}
+	compare("TriggerCounter", uint64(ref.TriggerCounter), uint64(evtFormat.TriggerCounter))
+	compare("Timestamp", ref.Timestamp, evtFormat.Timestamp)
+	compare("TriggerType", uint64(ref.TriggerType), uint64(evtFormat.TriggerType))
+	compare("FTBit", uint64(ref.FTBit), uint64(evtFormat.FTBit))
+	compare("TriggerFT", uint64(ref.TriggerFT), uint64(evtFormat.TriggerFT))
+	return errs
+}
@@ -0,0 +1,54 @@
+package decoder
+
+import "testing"
+
+// Trigger counter of a FEC off by one, the low word of the event ID
+func slipFec(t *testing.T, data []byte, equipment int) uint16 {
+	t.Helper()
+	payload := fecPayloads(data)[equipment]
+	evtFormat, err := ReadCommonHeader(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setHeaderWord(data, equipment, 6, payload[6]+1)
+	return evtFormat.FecID
+}
+
+func TestFecSyncMajority(t *testing.T) {
+	setupTestConfiguration()
+	defer setupTestConfiguration()
+
+	for _, equipment := range []int{0, 1} {
+		generated := generateEvent(DefaultGeneratorConfig())
+		slipped := slipFec(t, generated.Data, equipment)
+
+		config := testConfiguration()
+		config.KeepPartial = true
+		SetConfiguration(config)
+		event := decodeGenerated(t, generated.Data)
+
+		if !event.Desync || len(event.SyncErrors) == 0 {
+			t.Fatalf("fec %d: desync not detected", slipped)
+		}
+		for _, err := range event.SyncErrors {
+			if desync := err.(*ErrFecDesync); desync.FecID != slipped || desync.RefFecID == slipped {
+				t.Fatalf("fec %d: wrong FEC flagged: %v", slipped, err)
+			}
+		}
+		// Only the channels of the FEC that slipped are masked
+		for elecID := range generated.PmtWaveforms {
+			if elecID%100 >= 12 {
+				continue
+			}
+			fromSlipped := elecID%2 == slipped%2
+			if event.InvalidChannels[elecID] != fromSlipped {
+				t.Fatalf("fec %d: PMT %d invalid: %v", slipped, elecID, event.InvalidChannels[elecID])
+			}
+		}
+		for elecID := range generated.SipmWaveforms {
+			if event.InvalidChannels[elecID] {
+				t.Fatalf("fec %d: SiPM %d masked", slipped, elecID)
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package decoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"time"
+	"unsafe"
+)
+
+// Reads events from a file that may still be written by the DAQ. When an
+// event is not complete it waits for more data instead of failing, until
+// Finished reports that the file will not grow anymore.
+type FollowReader struct {
+	file   *os.File
+	offset int64
+	// Time between checks of the file size
+	Poll time.Duration
+	// Called while waiting for data. Once it returns true the data left in
+	// the file is read and a partial event is reported as
+	// io.ErrUnexpectedEOF.
+	Finished func() bool
+}
+
+func NewFollowReader(file *os.File, poll time.Duration, finished func() bool) *FollowReader {
+	return &FollowReader{file: file, Poll: poll, Finished: finished}
+}
+
+// Offset of the next event in the file
+func (r *FollowReader) Offset() int64 {
+	return r.offset
+}
+
+// Returns io.EOF after the last complete event of a finished file
+func (r *FollowReader) ReadEvent() (EventHeaderStruct, []byte, error) {
+	var header EventHeaderStruct
+	headerSize := int64(unsafe.Sizeof(header))
+
+	if err := r.waitFor(headerSize, true); err != nil {
+		return header, nil, err
+	}
+	headerBinary := make([]byte, headerSize)
+	if _, err := r.file.ReadAt(headerBinary, r.offset); err != nil {
+		return header, nil, err
+	}
+	binary.Read(bytes.NewReader(headerBinary), binary.LittleEndian, &header)
+	if int64(header.EventSize) < headerSize {
+		return header, nil, &ErrEventSize{Size: uint32(header.EventSize), HeaderSize: int(headerSize)}
+	}
+
+	if err := r.waitFor(int64(header.EventSize), false); err != nil {
+		return header, nil, err
+	}
+	eventData := make([]byte, int64(header.EventSize)-headerSize)
+	if _, err := r.file.ReadAt(eventData, r.offset+headerSize); err != nil {
+		return header, nil, err
+	}
+	r.offset += int64(header.EventSize)
+	return header, eventData, nil
+}
+
+// Waits until size bytes from the current offset are in the file
+func (r *FollowReader) waitFor(size int64, eventStart bool) error {
+	for {
+		info, err := r.file.Stat()
+		if err != nil {
+			return err
+		}
+		available := info.Size() - r.offset
+		if available >= size {
+			return nil
+		}
+		// Checked before the last look at the size, so data written just
+		// before finishing is not lost
+		if r.Finished() {
+			info, err = r.file.Stat()
+			if err != nil {
+				return err
+			}
+			available = info.Size() - r.offset
+			switch {
+			case available >= size:
+				return nil
+			case available == 0 && eventStart:
+				return io.EOF
+			default:
+				return io.ErrUnexpectedEOF
+			}
+		}
+		time.Sleep(r.Poll)
+	}
+}
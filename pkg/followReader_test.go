@@ -0,0 +1,88 @@
+package decoder
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Writes the events in small pieces, as the DAQ does, while they are read
+func TestFollowReader(t *testing.T) {
+	setupTestConfiguration()
+	config := DefaultGeneratorConfig()
+	config.BufferSamples = 160
+	config.PreTrigger = 40
+	generator, err := NewGenerator(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make([]GeneratedEvent, 5)
+	for i := range events {
+		events[i] = generator.NextEvent()
+	}
+
+	filename := filepath.Join(t.TempDir(), "run.rd")
+	out, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var finished atomic.Bool
+	go func() {
+		defer finished.Store(true)
+		defer out.Close()
+		for _, event := range events {
+			for start := 0; start < len(event.Data); start += 1000 {
+				end := min(start+1000, len(event.Data))
+				if _, err := out.Write(event.Data[start:end]); err != nil {
+					return
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}
+		// A partial event at the end of the file
+		out.Write(events[0].Data[:100])
+	}()
+
+	in, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	reader := NewFollowReader(in, time.Millisecond, finished.Load)
+	for i, expected := range events {
+		header, eventData, err := reader.ReadEvent()
+		if err != nil {
+			t.Fatalf("event %d: %v", i, err)
+		}
+		if EventIdGetNbInRun(header.EventId) != expected.EventID {
+			t.Fatalf("event %d: got ID %d", i, EventIdGetNbInRun(header.EventId))
+		}
+		event, err := ReadGDC(eventData, header)
+		if err != nil || event.Error {
+			t.Fatalf("event %d: decoding failed: %v", i, err)
+		}
+	}
+	if _, _, err := reader.ReadEvent(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected a partial event, got %v", err)
+	}
+}
+
+func TestFollowReaderEOF(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "empty.rd")
+	if err := os.WriteFile(filename, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	in, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	reader := NewFollowReader(in, time.Millisecond, func() bool { return true })
+	if _, _, err := reader.ReadEvent(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
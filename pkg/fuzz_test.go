@@ -0,0 +1,217 @@
+package decoder
+
+import (
+	"testing"
+)
+
+// Fuzz targets for the decoding path. Run them with, for instance:
+//
+//	go test -run=^$ -fuzz=FuzzReadEvent -fuzztime=60s ./pkg
+//
+// Inputs that make a target fail are stored by the go tool in
+// testdata/fuzz/<target>, commit them so they are replayed as regression
+// cases by a plain "go test".
+
+// Larger buffers only make the fuzzer slower, the decoding is the same
+const fuzzMaxSamples = 4096
+
+// Small events with every FEC type and mode
+func seedConfigs() []GeneratorConfig {
+	configs := make([]GeneratorConfig, 0)
+	for _, compressed := range []bool{false, true} {
+		for _, zs := range []bool{false, true} {
+			config := DefaultGeneratorConfig()
+			config.BufferSamples = 160
+			config.PreTrigger = 40
+			config.PmtFecs = []uint16{2}
+			config.PmtChannelMask = 0x0003
+			config.PmtCompressed = compressed
+			config.SipmFebsPerFec = 1
+			config.SipmZeroSuppression = zs
+			config.SipmCompressed = compressed
+			configs = append(configs, config)
+		}
+	}
+	return configs
+}
+
+func seedEvents() []GeneratedEvent {
+	events := make([]GeneratedEvent, 0)
+	for _, config := range seedConfigs() {
+		events = append(events, generateEvent(config))
+	}
+	return events
+}
+
+// FEC payloads of the seed events, grouped by FEC type
+func seedFecs() map[uint16][][]uint16 {
+	fecs := make(map[uint16][][]uint16)
+	for _, event := range seedEvents() {
+		for _, payload := range fecPayloads(event.Data) {
+			evtFormat, _ := ReadCommonHeader(payload)
+			fecs[evtFormat.FecType] = append(fecs[evtFormat.FecType], payload)
+		}
+	}
+	return fecs
+}
+
+// The seeds must decode cleanly, otherwise the fuzzer starts from garbage
+func TestSeedEvents(t *testing.T) {
+	setupTestConfiguration()
+	for i, seed := range seedEvents() {
+		header, eventData, err := ReadEvent(seed.Data)
+		if err != nil {
+			t.Fatalf("seed %d: %v", i, err)
+		}
+		event, err := ReadGDC(eventData, header)
+		if err != nil {
+			t.Fatalf("seed %d: %v", i, err)
+		}
+		if event.Error {
+			t.Fatalf("seed %d: event flagged as erroneous: %v %v", i, event.SyncErrors, event.DecodeErrors)
+		}
+	}
+}
+
+func FuzzReadEvent(f *testing.F) {
+	setupTestConfiguration()
+	for _, seed := range seedEvents() {
+		f.Add(seed.Data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		header, eventData, err := ReadEvent(data)
+		if err != nil {
+			return
+		}
+		if len(eventData) > len(data) {
+			t.Fatalf("event data (%d bytes) larger than input (%d bytes)", len(eventData), len(data))
+		}
+		ReadGDC(eventData, header)
+	})
+}
+
+func FuzzReadCommonHeader(f *testing.F) {
+	setupTestConfiguration()
+	for _, payloads := range seedFecs() {
+		for _, payload := range payloads {
+			f.Add(wordsToBytes(payload))
+		}
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		words := bytesToWords(data)
+		evtFormat, err := ReadCommonHeader(words)
+		if err != nil {
+			return
+		}
+		if int(evtFormat.HeaderSize) > len(words) {
+			t.Fatalf("header size %d larger than input (%d words)", evtFormat.HeaderSize, len(words))
+		}
+	})
+}
+
+// Splits the input in the common header and the data that follows
+func fuzzHeader(data []byte) (EventFormat, []uint16, bool) {
+	words := bytesToWords(data)
+	evtFormat, err := ReadCommonHeader(words)
+	if err != nil {
+		return evtFormat, nil, false
+	}
+	if evtFormat.BufferSamples > fuzzMaxSamples || evtFormat.BufferSamples2 > fuzzMaxSamples {
+		return evtFormat, nil, false
+	}
+	return evtFormat, words[evtFormat.HeaderSize:], true
+}
+
+func FuzzReadPmtFEC(f *testing.F) {
+	setupTestConfiguration()
+	for _, payload := range seedFecs()[0] {
+		f.Add(wordsToBytes(payload))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		evtFormat, payload, ok := fuzzHeader(data)
+		if !ok {
+			return
+		}
+		header := EventHeaderStruct{}
+		event := newEvent(header)
+		consumed, err := ReadPmtFEC(payload, &evtFormat, &header, &event)
+		if err == nil && consumed > len(payload)+2 {
+			t.Fatalf("consumed %d words from a payload of %d", consumed, len(payload))
+		}
+	})
+}
+
+func FuzzReadSipmFEC(f *testing.F) {
+	setupTestConfiguration()
+	links := seedFecs()[1]
+	for i := 0; i+1 < len(links); i += 2 {
+		f.Add(wordsToBytes(links[i]), wordsToBytes(links[i+1]))
+	}
+	f.Fuzz(func(t *testing.T, dataA []byte, dataB []byte) {
+		evtFormatA, payloadA, okA := fuzzHeader(dataA)
+		evtFormatB, payloadB, okB := fuzzHeader(dataB)
+		if !okA || !okB {
+			return
+		}
+		// Both links must belong to the same FEC to be decoded together
+		evtFormatA.FecID = 32
+		evtFormatB.FecID = 33
+		header := EventHeaderStruct{}
+		event := newEvent(header)
+		payloads := make(map[uint16][]uint16)
+		if err := ReadSipmFEC(payloadA, &evtFormatA, &header, &event, payloads); err != nil {
+			return
+		}
+		ReadSipmFEC(payloadB, &evtFormatB, &header, &event, payloads)
+		if len(payloads) != 0 {
+			t.Fatalf("payloads not released after decoding: %d", len(payloads))
+		}
+	})
+}
+
+func FuzzReadTriggerFEC(f *testing.F) {
+	setupTestConfiguration()
+	for _, payload := range seedFecs()[2] {
+		evtFormat, _ := ReadCommonHeader(payload)
+		f.Add(wordsToBytes(payload[evtFormat.HeaderSize:]))
+		f.Add(wordsToBytes(payload[evtFormat.HeaderSize : evtFormat.HeaderSize+3]))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		event := newEvent(EventHeaderStruct{})
+		ReadTriggerFEC(bytesToWords(data), &event)
+	})
+}
+
+// The tree is built from the input too: each byte is one code, the lower
+// nibble is its length and the upper nibble its bits
+func FuzzDecodeHuffman(f *testing.F) {
+	f.Add([]byte{0x01, 0x12, 0x33, 0x73}, uint32(0x5A5A5A5A), uint8(31))
+	f.Add([]byte{0x01, 0x12}, uint32(0xFFFFFFFF), uint8(5))
+	f.Add([]byte{}, uint32(0), uint8(31))
+	f.Fuzz(func(t *testing.T, codes []byte, data uint32, start uint8) {
+		huffman := &HuffmanNode{}
+		for i, c := range codes {
+			length := int(c & 0x0F)
+			code := make([]byte, length)
+			for b := range code {
+				code[b] = '0' + byte((c>>(4+b%4))&1)
+			}
+			parse_huffman_line(int32(i), string(code), huffman)
+		}
+		control := int32(len(codes) - 1)
+
+		position := int(start % 32)
+		var previous int32
+		for position >= 0 {
+			last := position
+			value, err := decode_compressed_value(previous, data, control, &position, huffman)
+			if err != nil {
+				return
+			}
+			if position >= last {
+				t.Fatalf("position did not advance: %d -> %d", last, position)
+			}
+			previous = value
+		}
+	})
+}
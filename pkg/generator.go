@@ -0,0 +1,591 @@
+package decoder
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+	"math/rand"
+	"slices"
+	"sort"
+)
+
+// Synthetic DATE files for tests and benchmarks. The Generator writes
+// events with the configured FECs and returns, next to the raw data, the
+// waveforms the decoder should read back.
+
+// Faults injected in the generated data. Each one is the probability of
+// the fault for every FEC (every link for SiPMs) in an event.
+type Faults struct {
+	// Error bit set in the common header
+	ErrorBit float64
+	// One FT word off by one. Only in modes with an FT word per time bin:
+	// raw PMTs and SiPMs without zero suppression
+	FTJump float64
+	// Payload cut at a random position, keeping the WordCount of the full
+	// payload. For SiPMs only one of the links is cut.
+	Truncate float64
+}
+
+type GeneratorConfig struct {
+	RunNumber  uint32
+	FirstEvent uint32
+	Seed       int64
+	// Number of LDCs, FECs are distributed among them
+	LDCs int
+
+	TriggerType uint16
+	// Buffer and pretrigger in PMT samples (40 MHz). SiPMs take one sample
+	// every 40, so BufferSamples must be a multiple of 40 if there are SiPMs
+	BufferSamples uint32
+	PreTrigger    uint32
+
+	PmtFecs        []uint16
+	PmtChannelMask uint16
+	PmtCompressed  bool
+	PmtBaselines   bool
+
+	// Even FEC ID of each pair, the odd one is the second link
+	SipmFecs            []uint16
+	SipmFebsPerFec      int
+	SipmZeroSuppression bool
+	SipmCompressed      bool
+	// Samples below the threshold are not sent in zero suppression mode
+	SipmThreshold int16
+
+	TriggerFecs []uint16
+
+	// Codes for the compressed modes, DefaultHuffmanTable if nil
+	HuffmanCodes HuffmanTable
+
+	Faults Faults
+}
+
+func DefaultGeneratorConfig() GeneratorConfig {
+	return GeneratorConfig{
+		RunNumber:      1,
+		Seed:           1,
+		LDCs:           1,
+		TriggerType:    1,
+		BufferSamples:  800,
+		PreTrigger:     200,
+		PmtFecs:        []uint16{2, 3},
+		PmtChannelMask: 0x0FFF,
+		SipmFecs:       []uint16{32},
+		SipmFebsPerFec: 2,
+		SipmThreshold:  10,
+		TriggerFecs:    []uint16{40},
+	}
+}
+
+// An event as written, together with the expected decoded data. Waveforms
+// are indexed by the elecID sent by the FEC, before dual channels are moved
+// to the BLR waveforms.
+type GeneratedEvent struct {
+	EventID       uint32
+	Data          []byte
+	PmtWaveforms  map[uint16][]int16
+	PmtBaselines  map[uint16]uint16
+	SipmWaveforms map[uint16][]int16
+	TriggerConfig TriggerData
+	// Faults injected, one message per FEC
+	Faults []string
+}
+
+type Generator struct {
+	config  GeneratorConfig
+	random  *rand.Rand
+	eventID uint32
+}
+
+func NewGenerator(config GeneratorConfig) (*Generator, error) {
+	if config.HuffmanCodes == nil {
+		config.HuffmanCodes = DefaultHuffmanTable()
+	}
+	if config.LDCs < 1 {
+		config.LDCs = 1
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	generator := &Generator{
+		config:  config,
+		random:  rand.New(rand.NewSource(config.Seed)),
+		eventID: config.FirstEvent,
+	}
+	return generator, nil
+}
+
+func (config *GeneratorConfig) validate() error {
+	if config.BufferSamples < 2 || config.BufferSamples > 2*0x0FFFF || config.BufferSamples%2 != 0 {
+		return fmt.Errorf("buffer samples must be even and between 2 and %d: %d", 2*0x0FFFF, config.BufferSamples)
+	}
+	if config.PreTrigger >= config.BufferSamples || config.PreTrigger%2 != 0 {
+		return fmt.Errorf("pretrigger must be even and smaller than the buffer: %d", config.PreTrigger)
+	}
+	fecIDs := make(map[uint16]bool)
+	addFec := func(fecID uint16) error {
+		if fecID > 0x07FF {
+			return fmt.Errorf("FEC ID %d does not fit in the header", fecID)
+		}
+		if fecIDs[fecID] {
+			return fmt.Errorf("FEC ID %d is used twice", fecID)
+		}
+		fecIDs[fecID] = true
+		return nil
+	}
+	for _, fecID := range config.PmtFecs {
+		if fecID < 2 {
+			return fmt.Errorf("PMT FEC IDs start at 2: %d", fecID)
+		}
+		if err := addFec(fecID); err != nil {
+			return err
+		}
+	}
+	if len(config.SipmFecs) > 0 {
+		if config.BufferSamples%40 != 0 {
+			return fmt.Errorf("buffer samples must be a multiple of 40 with SiPMs: %d", config.BufferSamples)
+		}
+		if config.SipmFebsPerFec < 1 || config.SipmFebsPerFec > 0x001F {
+			return fmt.Errorf("invalid number of FEBs per SiPM FEC: %d", config.SipmFebsPerFec)
+		}
+		if len(config.SipmFecs)*config.SipmFebsPerFec > 56 {
+			return fmt.Errorf("too many FEBs: %d, maximum is 56", len(config.SipmFecs)*config.SipmFebsPerFec)
+		}
+	}
+	for _, fecID := range config.SipmFecs {
+		if fecID%2 != 0 {
+			return fmt.Errorf("SiPM FEC IDs must be even: %d", fecID)
+		}
+		if err := addFec(fecID); err != nil {
+			return err
+		}
+		if err := addFec(fecID + 1); err != nil {
+			return err
+		}
+	}
+	for _, fecID := range config.TriggerFecs {
+		if err := addFec(fecID); err != nil {
+			return err
+		}
+	}
+	if config.PmtCompressed || config.SipmCompressed {
+		if err := config.HuffmanCodes.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writes nEvents events to w
+func (g *Generator) WriteEvents(w io.Writer, nEvents int) error {
+	for i := 0; i < nEvents; i++ {
+		event := g.NextEvent()
+		if _, err := w.Write(event.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *Generator) NextEvent() GeneratedEvent {
+	config := &g.config
+	event := GeneratedEvent{
+		EventID:       g.eventID,
+		PmtWaveforms:  make(map[uint16][]int16),
+		PmtBaselines:  make(map[uint16]uint16),
+		SipmWaveforms: make(map[uint16][]int16),
+		Faults:        make([]string, 0),
+	}
+	g.eventID++
+
+	// Header fields shared by all the FECs
+	triggerFT := uint32(g.random.Intn(int(config.BufferSamples)))
+	common := EventFormat{
+		FWVersion:      10,
+		TriggerType:    config.TriggerType,
+		TriggerCounter: event.EventID,
+		BufferSamples:  config.BufferSamples,
+		PreTrigger:     config.PreTrigger,
+		BufferSamples2: config.BufferSamples,
+		PreTrigger2:    config.PreTrigger,
+		TriggerFT:      uint16(triggerFT),
+		FTBit:          int32(triggerFT >> 16),
+		Timestamp:      uint64(event.EventID)*40000 + uint64(g.random.Intn(1000)),
+	}
+
+	equipments := make([][]uint16, 0)
+	for _, fecID := range config.PmtFecs {
+		equipments = append(equipments, g.pmtFEC(common, fecID, &event))
+	}
+	for i, fecID := range config.SipmFecs {
+		firstFeb := uint16(i * config.SipmFebsPerFec)
+		linkA, linkB := g.sipmFEC(common, fecID, firstFeb, &event)
+		equipments = append(equipments, linkA, linkB)
+	}
+	for _, fecID := range config.TriggerFecs {
+		equipments = append(equipments, g.triggerFEC(common, fecID, &event))
+	}
+
+	// Distribute the equipments among the LDCs
+	header := EventHeaderStruct{
+		EventMagic:   EVENT_MAGIC_NUMBER,
+		EventVersion: EVENT_CURRENT_VERSION,
+		EventType:    PHYSICS_EVENT,
+		EventRunNb:   EventRunNbType(config.RunNumber),
+		EventId:      EventIdType{event.EventID, 0},
+	}
+	ldcPayloads := make([][]byte, config.LDCs)
+	for i, words := range equipments {
+		eqHeader := EquipmentHeaderStruct{
+			EquipmentId:               EquipmentIdType(i),
+			EquipmentBasicElementSize: 4,
+		}
+		ldc := i % config.LDCs
+		ldcPayloads[ldc] = append(ldcPayloads[ldc], EncodeEquipment(eqHeader, words)...)
+	}
+	gdcPayload := make([]byte, 0)
+	for i, payload := range ldcPayloads {
+		ldcHeader := header
+		ldcHeader.EventLdcId = EventLdcIdType(i)
+		gdcPayload = append(gdcPayload, EncodeEvent(ldcHeader, payload)...)
+	}
+	event.Data = EncodeEvent(header, gdcPayload)
+	return event
+}
+
+// Slow baseline with noise and, sometimes, a pulse
+func (g *Generator) waveform(nSamples int, baseline int, noise int, amplitude int) []int16 {
+	waveform := make([]int16, nSamples)
+	pulseStart, pulseWidth := -1, 0
+	if amplitude > 0 && g.random.Intn(2) == 0 {
+		pulseStart = g.random.Intn(nSamples)
+		pulseWidth = 1 + g.random.Intn(nSamples/10+1)
+	}
+	for t := range waveform {
+		value := baseline + g.random.Intn(2*noise+1) - noise
+		if t >= pulseStart && t < pulseStart+pulseWidth {
+			value += amplitude * (pulseStart + pulseWidth - t) / pulseWidth
+		}
+		waveform[t] = int16(min(max(value, 0), 0x0FFF))
+	}
+	return waveform
+}
+
+// FT sent by the PMT FECs in each time bin, as expected by computeNextFThm
+func pmtFT(evtFormat *EventFormat, time int) uint16 {
+	buffer := int32(evtFormat.BufferSamples2)
+	nextFT := ((evtFormat.FTBit << 16) + int32(evtFormat.TriggerFT) + int32(time)) % buffer
+	pretrigger := int32(evtFormat.PreTrigger2)
+	if pretrigger > nextFT {
+		return uint16(buffer - pretrigger + nextFT)
+	}
+	return uint16(nextFT - pretrigger)
+}
+
+// Position of the first SiPM sample in the ring buffer, see computeSipmTime
+func sipmFT(evtFormat *EventFormat, time int) uint16 {
+	buffer := int32(evtFormat.BufferSamples2)
+	ringBufferSize := buffer / 40
+	start := ((evtFormat.FTBit << 16) + int32(evtFormat.TriggerFT) - int32(evtFormat.PreTrigger2) + buffer) / 40 % ringBufferSize
+	return uint16((start + int32(time)) % ringBufferSize)
+}
+
+func (g *Generator) pmtFEC(common EventFormat, fecID uint16, event *GeneratedEvent) []uint16 {
+	config := &g.config
+	evtFormat := common
+	evtFormat.FecType = 0
+	evtFormat.FecID = fecID
+	evtFormat.ChannelMask = config.PmtChannelMask
+	evtFormat.NumberOfChannels = uint16(bits.OnesCount16(config.PmtChannelMask))
+	// PMTs use the zero suppression bit for compression
+	evtFormat.ZeroSuppression = config.PmtCompressed
+	evtFormat.Baseline = config.PmtBaselines
+
+	nSamples := int(config.BufferSamples)
+	waveforms := make([][]int16, 0)
+	channels := make([]uint16, 0)
+	for ch := uint16(0); ch < 16; ch++ {
+		if CheckBit(config.PmtChannelMask, ch) {
+			elecID := computePmtElecID(fecID, ch, 10)
+			waveform := g.waveform(nSamples, 2000+g.random.Intn(200), 2, 1000)
+			event.PmtWaveforms[elecID] = waveform
+			waveforms = append(waveforms, waveform)
+			channels = append(channels, elecID)
+		}
+	}
+	if config.PmtBaselines {
+		evtFormat.Baselines = make([]uint16, 6)
+		for i := range evtFormat.Baselines {
+			evtFormat.Baselines[i] = uint16(2000 + g.random.Intn(200))
+		}
+		for _, elecID := range channels {
+			event.PmtBaselines[elecID] = evtFormat.Baselines[((elecID%100)%12)/2]
+		}
+	}
+
+	data := make([]uint16, 0)
+	if config.PmtCompressed {
+		// FT of the first time bin and a single stream with all the samples
+		writer := &bitWriter{}
+		data = append(data, pmtFT(&evtFormat, 0))
+		for t := 0; t < nSamples; t++ {
+			for _, waveform := range waveforms {
+				var previous int16
+				if t > 0 {
+					previous = waveform[t-1]
+				}
+				config.HuffmanCodes.encode(writer, previous, waveform[t])
+			}
+		}
+		data = append(data, writer.words...)
+	} else {
+		charges := make([]int16, len(waveforms))
+		for t := 0; t < nSamples; t++ {
+			data = append(data, pmtFT(&evtFormat, t))
+			for i, waveform := range waveforms {
+				charges[i] = waveform[t]
+			}
+			data = append(data, encodeCharges(charges)...)
+		}
+	}
+
+	// An FT jump in raw mode ends the waveform in the decoder
+	ftWords := make([]int, 0)
+	if !config.PmtCompressed {
+		wordsPerSample := 1 + (3*len(waveforms)+3)/4
+		for t := 1; t < nSamples; t++ {
+			ftWords = append(ftWords, t*wordsPerSample)
+		}
+	}
+	words, _ := g.finishFEC(&evtFormat, data, ftWords, config.Faults, event)
+	return words
+}
+
+// Returns the two links of the FEC
+func (g *Generator) sipmFEC(common EventFormat, fecID uint16, firstFeb uint16,
+	event *GeneratedEvent) ([]uint16, []uint16) {
+	config := &g.config
+	evtFormat := common
+	evtFormat.FecType = 1
+	evtFormat.ZeroSuppression = config.SipmZeroSuppression
+	evtFormat.CompressedData = config.SipmCompressed
+	evtFormat.NumberOfChannels = uint16(config.SipmFebsPerFec)
+
+	nSamples := int(config.BufferSamples / 40)
+	febs := make([]uint16, config.SipmFebsPerFec)
+	waveforms := make([][][]int16, len(febs))
+	for i := range febs {
+		febs[i] = firstFeb + uint16(i)
+		waveforms[i] = make([][]int16, 64)
+		for ch := range waveforms[i] {
+			waveforms[i][ch] = g.waveform(nSamples, 5, 3, 30)
+		}
+	}
+	lastValues := make([][]int16, len(febs))
+	for i := range lastValues {
+		lastValues[i] = make([]int16, 64)
+	}
+	sent := make([][]bool, len(febs))
+	for i := range sent {
+		sent[i] = make([]bool, 64)
+	}
+
+	// Both links are interleaved word by word
+	payload := make([]uint16, 0)
+	ftWords := make([]int, 0)
+	for t := 0; t < nSamples; t++ {
+		// In zero suppression mode only the channels over threshold are sent
+		// and time bins without any of them are skipped
+		active := make([][]bool, len(febs))
+		anyActive := false
+		for i := range febs {
+			active[i] = make([]bool, 64)
+			for ch := range active[i] {
+				active[i][ch] = !config.SipmZeroSuppression || waveforms[i][ch][t] >= config.SipmThreshold
+				anyActive = anyActive || active[i][ch]
+			}
+		}
+		if !anyActive {
+			continue
+		}
+
+		for i, febID := range febs {
+			empty := true
+			for _, a := range active[i] {
+				empty = empty && !a
+			}
+			if empty {
+				payload = append(payload, febID<<10|0x0002)
+				continue
+			}
+			payload = append(payload, febID<<10)
+			if t > 0 && !config.SipmZeroSuppression {
+				ftWords = append(ftWords, len(payload))
+			}
+			payload = append(payload, sipmFT(&evtFormat, t))
+
+			// Channel mask, from channel 63 to 0
+			if t == 0 || config.SipmZeroSuppression {
+				for l := 3; l >= 0; l-- {
+					var mask uint16
+					for b := 0; b < 16; b++ {
+						if active[i][l*16+b] {
+							mask |= 1 << b
+						}
+					}
+					payload = append(payload, mask)
+				}
+			}
+
+			if config.SipmCompressed {
+				writer := &bitWriter{}
+				for ch := 0; ch < 64; ch++ {
+					if active[i][ch] {
+						value := waveforms[i][ch][t]
+						config.HuffmanCodes.encode(writer, lastValues[i][ch], value)
+						lastValues[i][ch] = value
+					}
+				}
+				payload = append(payload, writer.words...)
+			} else {
+				charges := make([]int16, 0, 64)
+				for ch := 0; ch < 64; ch++ {
+					if active[i][ch] {
+						charges = append(charges, waveforms[i][ch][t])
+					}
+				}
+				payload = append(payload, encodeCharges(charges)...)
+			}
+			for ch := 0; ch < 64; ch++ {
+				sent[i][ch] = sent[i][ch] || active[i][ch]
+			}
+		}
+	}
+	// Both links must have the same size, an empty FEB fills the gap
+	if len(payload)%2 != 0 {
+		payload = append(payload, febs[0]<<10|0x0002)
+	}
+
+	// The decoder only creates the waveforms of the channels sent
+	for i, febID := range febs {
+		for ch := 0; ch < 64; ch++ {
+			if !sent[i][ch] {
+				continue
+			}
+			elecID := (febID+1)*1000 + uint16(ch)
+			waveform := make([]int16, nSamples)
+			for t := range waveform {
+				if !config.SipmZeroSuppression || waveforms[i][ch][t] >= config.SipmThreshold {
+					waveform[t] = waveforms[i][ch][t]
+				}
+			}
+			event.SipmWaveforms[elecID] = waveform
+		}
+	}
+
+	links := make([][]uint16, 2)
+	linkFTWords := make([][]int, 2)
+	for i := range links {
+		links[i] = make([]uint16, 0, len(payload)/2)
+		for j := i; j < len(payload); j += 2 {
+			links[i] = append(links[i], payload[j])
+		}
+		for _, position := range ftWords {
+			if position%2 == i {
+				linkFTWords[i] = append(linkFTWords[i], position/2)
+			}
+		}
+	}
+
+	// Only one of the links is truncated
+	faults := config.Faults
+	evtFormat.FecID = fecID
+	linkA, truncated := g.finishFEC(&evtFormat, links[0], linkFTWords[0], faults, event)
+	if truncated {
+		faults.Truncate = 0
+	}
+	evtFormat.FecID = fecID + 1
+	linkB, _ := g.finishFEC(&evtFormat, links[1], linkFTWords[1], faults, event)
+
+	// Without WordCount, the data ends before a FFFFFFFF block
+	linkA = append(linkA, 0xFFFF, 0xFFFF)
+	linkB = append(linkB, 0xFFFF, 0xFFFF)
+	return linkA, linkB
+}
+
+func (g *Generator) triggerFEC(common EventFormat, fecID uint16, event *GeneratedEvent) []uint16 {
+	evtFormat := common
+	evtFormat.FecType = 2
+	evtFormat.FecID = fecID
+
+	channels := make([]uint16, 0)
+	for i := 0; i < 4; i++ {
+		if g.random.Intn(4) == 0 {
+			channels = append(channels, uint16(100*(g.random.Intn(4)+1)+g.random.Intn(12)))
+		}
+	}
+	trg := TriggerData{
+		TriggerType:     uint16(g.random.Intn(2)),
+		TriggerLost1:    uint32(g.random.Intn(10)),
+		TriggerLost2:    uint32(g.random.Intn(10)),
+		TriggerMask:     uint32(g.random.Intn(0x03FFFFFF)),
+		TriggerDiff1:    uint16(g.random.Intn(100)),
+		TriggerDiff2:    uint16(g.random.Intn(100)),
+		AutoTrigger:     uint16(g.random.Intn(2)),
+		DualTrigger:     uint16(g.random.Intn(2)),
+		ExternalTrigger: uint16(g.random.Intn(2)),
+		ChanA1:          uint16(g.random.Intn(48)),
+		ChanA2:          uint16(g.random.Intn(48)),
+		ChanB1:          uint16(g.random.Intn(48)),
+		ChanB2:          uint16(g.random.Intn(48)),
+		WindowA1:        uint16(g.random.Intn(64)),
+		WindowB1:        uint16(g.random.Intn(64)),
+		WindowA2:        uint16(g.random.Intn(64)),
+		WindowB2:        uint16(g.random.Intn(64)),
+		TriggerIntN:     uint16(g.random.Intn(0x0FFF)),
+		TriggerExtN:     uint16(g.random.Intn(0x000F)),
+	}
+	// The decoder returns the channels as they are in the payload, from 47 to 0
+	sort.Slice(channels, func(i, j int) bool {
+		return trgChannelNumber(channels[i]) > trgChannelNumber(channels[j])
+	})
+	trg.TrgChannels = slices.Compact(channels)
+	event.TriggerConfig = trg
+
+	words, _ := g.finishFEC(&evtFormat, EncodeTriggerData(&trg), nil, g.config.Faults, event)
+	return words
+}
+
+// Adds the header and the faults to the FEC data. ftWords are the
+// positions in data of the FT words that may jump. Returns whether the
+// payload has been truncated.
+func (g *Generator) finishFEC(evtFormat *EventFormat, data []uint16, ftWords []int,
+	faults Faults, event *GeneratedEvent) ([]uint16, bool) {
+	if g.random.Float64() < faults.ErrorBit {
+		evtFormat.ErrorBit = true
+		event.Faults = append(event.Faults, fmt.Sprintf("fec %d: error bit", evtFormat.FecID))
+	}
+	headerSize := len(EncodeCommonHeader(evtFormat))
+	evtFormat.WordCount = uint16(headerSize + len(data))
+	words := EncodeCommonHeader(evtFormat)
+	evtFormat.ErrorBit = false
+
+	if len(ftWords) > 0 && g.random.Float64() < faults.FTJump {
+		position := ftWords[g.random.Intn(len(ftWords))]
+		data[position]++
+		event.Faults = append(event.Faults, fmt.Sprintf("fec %d: FT jump at word %d", evtFormat.FecID, position))
+	}
+	truncated := false
+	if len(data) > 0 && g.random.Float64() < faults.Truncate {
+		length := g.random.Intn(len(data))
+		data = data[:length]
+		truncated = true
+		event.Faults = append(event.Faults, fmt.Sprintf("fec %d: truncated to %d words", evtFormat.FecID, length))
+	}
+	return append(words, data...), truncated
+}
+
+// Inverse of the elecID computation in ReadTriggerFEC
+func trgChannelNumber(elecID uint16) uint16 {
+	return (elecID/100-1)*12 + elecID%100
+}
@@ -0,0 +1,273 @@
+package decoder
+
+import (
+	"bytes"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func decodeGenerated(t *testing.T, data []byte) EventType {
+	t.Helper()
+	header, eventData, err := ReadEvent(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := ReadGDC(eventData, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func compareGenerated(t *testing.T, generated GeneratedEvent, event EventType) {
+	t.Helper()
+	if event.Error {
+		t.Fatalf("event %d flagged as erroneous: %v %v", generated.EventID, event.SyncErrors, event.DecodeErrors)
+	}
+	if event.EventID != generated.EventID {
+		t.Fatalf("event ID: got %d, expected %d", event.EventID, generated.EventID)
+	}
+
+	// Dual channels are moved to the BLR waveforms by the decoder
+	for elecID, expected := range generated.PmtWaveforms {
+		waveform, found := event.PmtWaveforms[elecID]
+		baseline, baselineFound := event.Baselines[elecID]
+		if elecID%100 >= 12 {
+			waveform, found = event.BlrWaveforms[elecID-12]
+			baseline, baselineFound = event.BlrBaselines[elecID-12]
+		}
+		if !found {
+			t.Fatalf("PMT %d not found", elecID)
+		}
+		if !slices.Equal(waveform, expected) {
+			t.Fatalf("PMT %d: waveforms differ\ngot      %v\nexpected %v", elecID, waveform, expected)
+		}
+		if expectedBaseline, sent := generated.PmtBaselines[elecID]; sent {
+			if !baselineFound || baseline != expectedBaseline {
+				t.Fatalf("PMT %d: baseline %d, expected %d", elecID, baseline, expectedBaseline)
+			}
+		}
+	}
+
+	if len(event.SipmWaveforms) != len(generated.SipmWaveforms) {
+		t.Fatalf("got %d SiPM waveforms, expected %d", len(event.SipmWaveforms), len(generated.SipmWaveforms))
+	}
+	for elecID, expected := range generated.SipmWaveforms {
+		waveform, found := event.SipmWaveforms[elecID]
+		if !found {
+			t.Fatalf("SiPM %d not found", elecID)
+		}
+		if !slices.Equal(waveform, expected) {
+			t.Fatalf("SiPM %d: waveforms differ\ngot      %v\nexpected %v", elecID, waveform, expected)
+		}
+	}
+
+	trg := event.TriggerConfig
+	expected := generated.TriggerConfig
+	if !slices.Equal(trg.TrgChannels, expected.TrgChannels) {
+		t.Fatalf("trigger channels: got %v, expected %v", trg.TrgChannels, expected.TrgChannels)
+	}
+	if !reflect.DeepEqual(trg, expected) {
+		t.Fatalf("trigger config:\ngot      %+v\nexpected %+v", trg, expected)
+	}
+}
+
+func TestGeneratorRoundTrip(t *testing.T) {
+	setupTestConfiguration()
+	tests := []struct {
+		name   string
+		modify func(config *GeneratorConfig)
+	}{
+		{"raw", func(config *GeneratorConfig) {}},
+		{"pmt compressed", func(config *GeneratorConfig) { config.PmtCompressed = true }},
+		{"pmt baselines", func(config *GeneratorConfig) { config.PmtBaselines = true }},
+		{"sipm zs", func(config *GeneratorConfig) { config.SipmZeroSuppression = true }},
+		{"sipm compressed", func(config *GeneratorConfig) { config.SipmCompressed = true }},
+		{"sipm zs compressed", func(config *GeneratorConfig) {
+			config.SipmZeroSuppression = true
+			config.SipmCompressed = true
+		}},
+		{"all channels", func(config *GeneratorConfig) {
+			config.PmtChannelMask = 0xFFFF
+			config.SipmFecs = []uint16{32, 34, 36}
+			config.SipmFebsPerFec = 3
+		}},
+		{"several LDCs", func(config *GeneratorConfig) { config.LDCs = 3 }},
+		{"FT bit", func(config *GeneratorConfig) {
+			config.BufferSamples = 80000
+			config.PreTrigger = 20000
+			config.PmtFecs = []uint16{2}
+			config.PmtChannelMask = 0x0001
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultGeneratorConfig()
+			test.modify(&config)
+			generator, err := NewGenerator(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 5; i++ {
+				generated := generator.NextEvent()
+				compareGenerated(t, generated, decodeGenerated(t, generated.Data))
+			}
+		})
+	}
+}
+
+func TestGeneratorFile(t *testing.T) {
+	setupTestConfiguration()
+	config := DefaultGeneratorConfig()
+	config.FirstEvent = 10
+	generator, err := NewGenerator(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer := new(bytes.Buffer)
+	if err := generator.WriteEvents(buffer, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	// Same seed, same events
+	generator, _ = NewGenerator(config)
+	data := buffer.Bytes()
+	for i := 0; i < 3; i++ {
+		header, eventData, err := ReadEvent(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.EventRunNb != EventRunNbType(config.RunNumber) {
+			t.Fatalf("run number: got %d, expected %d", header.EventRunNb, config.RunNumber)
+		}
+		event, err := ReadGDC(eventData, header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compareGenerated(t, generator.NextEvent(), event)
+		data = data[header.EventSize:]
+	}
+	if len(data) != 0 {
+		t.Fatalf("%d bytes left after the last event", len(data))
+	}
+}
+
+func TestGeneratorFaults(t *testing.T) {
+	setupTestConfiguration()
+	tests := []struct {
+		name   string
+		faults Faults
+	}{
+		{"error bit", Faults{ErrorBit: 1}},
+		{"FT jump", Faults{FTJump: 1}},
+		{"truncate", Faults{Truncate: 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultGeneratorConfig()
+			config.Faults = test.faults
+			generated := generateEvent(config)
+			if len(generated.Faults) == 0 {
+				t.Fatal("no faults injected")
+			}
+			event := decodeGenerated(t, generated.Data)
+			if !event.Error {
+				t.Fatalf("faults not detected: %v", generated.Faults)
+			}
+		})
+	}
+}
+
+func TestGeneratorConfigErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(config *GeneratorConfig)
+	}{
+		{"odd buffer", func(config *GeneratorConfig) { config.BufferSamples = 801 }},
+		{"pretrigger", func(config *GeneratorConfig) { config.PreTrigger = 800 }},
+		{"sipm buffer", func(config *GeneratorConfig) { config.BufferSamples = 802 }},
+		{"odd sipm fec", func(config *GeneratorConfig) { config.SipmFecs = []uint16{33} }},
+		{"repeated fec", func(config *GeneratorConfig) { config.TriggerFecs = []uint16{2} }},
+		{"too many febs", func(config *GeneratorConfig) {
+			config.SipmFecs = []uint16{32, 34}
+			config.SipmFebsPerFec = 29
+		}},
+		{"huffman prefix", func(config *GeneratorConfig) {
+			config.PmtCompressed = true
+			config.HuffmanCodes = HuffmanTable{0: "1", 1: "10", HUFFMAN_CONTROL_CODE: "0"}
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultGeneratorConfig()
+			test.modify(&config)
+			if _, err := NewGenerator(config); err == nil {
+				t.Fatal("invalid configuration accepted")
+			}
+		})
+	}
+}
+
+func BenchmarkReadGDC(b *testing.B) {
+	setupTestConfiguration()
+	config := DefaultGeneratorConfig()
+	config.PmtFecs = []uint16{2, 3, 6, 7, 10, 11, 14, 15}
+	config.SipmFecs = []uint16{32, 34, 36, 38}
+	config.SipmFebsPerFec = 7
+	generated := generateEvent(config)
+	header, eventData, err := ReadEvent(generated.Data)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(generated.Data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ReadGDC(eventData, header)
+	}
+}
+
+func TestKeepPartialErrorBit(t *testing.T) {
+	setupTestConfiguration()
+	defer setupTestConfiguration()
+
+	for _, errorBit := range []float64{0, 1} {
+		generatorConfig := DefaultGeneratorConfig()
+		generatorConfig.Faults = Faults{ErrorBit: errorBit}
+		generated := generateEvent(generatorConfig)
+		channels := make([]uint16, 0)
+		for elecID := range generated.PmtWaveforms {
+			if elecID%100 < 12 {
+				channels = append(channels, elecID)
+			}
+		}
+		slices.Sort(channels)
+
+		// Two PMTs taken as the external trigger and the PMT sum
+		config := testConfiguration()
+		config.KeepPartial = true
+		config.ExtTrigger = int(channels[0])
+		config.PmtSumCh = int(channels[1])
+		SetConfiguration(config)
+		event := decodeGenerated(t, generated.Data)
+
+		failed := errorBit > 0
+		if event.Error || event.InvalidTrigger != failed {
+			t.Fatalf("error bit %v: error %t, invalid trigger %t", errorBit, event.Error, event.InvalidTrigger)
+		}
+		if failed && !reflect.DeepEqual(event.TriggerConfig, TriggerData{}) {
+			t.Fatalf("trigger data of a broken FEC kept: %+v", event.TriggerConfig)
+		}
+		if !failed && !reflect.DeepEqual(event.TriggerConfig, generated.TriggerConfig) {
+			t.Fatalf("wrong trigger data: %+v", event.TriggerConfig)
+		}
+		if event.ExtTrgWaveform == nil || event.PmtSumWaveform == nil {
+			t.Fatal("external trigger or PMT sum not found")
+		}
+		if event.InvalidExtTrg != failed || event.InvalidPmtSum != failed {
+			t.Fatalf("error bit %v: invalid external trigger %t, PMT sum %t",
+				errorBit, event.InvalidExtTrg, event.InvalidPmtSum)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package hdf5writer
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+type CompareOptions struct {
+	// Maximum absolute difference allowed in array values (ADC counts)
+	Tolerance int
+	// Differences reported per dataset, 0 for no limit
+	MaxDiffs int
+}
+
+// A difference between two outputs. EventID and Channel are -1 when the
+// difference is not bound to an event or a channel.
+type OutputDiff struct {
+	Dataset string
+	EventID int32
+	Channel int32
+	Message string
+}
+
+func (d OutputDiff) String() string {
+	location := d.Dataset
+	if d.EventID >= 0 {
+		location += fmt.Sprintf(", event %d", d.EventID)
+	}
+	if d.Channel >= 0 {
+		location += fmt.Sprintf(", channel %d", d.Channel)
+	}
+	return fmt.Sprintf("%s: %s", location, d.Message)
+}
+
+// Collects the differences, limited per dataset
+type diffList struct {
+	options CompareOptions
+	diffs   []OutputDiff
+	count   map[string]int
+}
+
+func (l *diffList) add(dataset string, eventID int32, channel int32, format string, args ...interface{}) {
+	l.count[dataset]++
+	if l.options.MaxDiffs > 0 && l.count[dataset] > l.options.MaxDiffs {
+		return
+	}
+	l.diffs = append(l.diffs, OutputDiff{
+		Dataset: dataset,
+		EventID: eventID,
+		Channel: channel,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// Compares two outputs matching the events by event number and the
+// channels by their elecID, so the order in the files does not matter
+func CompareOutputs(a *Output, b *Output, options CompareOptions) []OutputDiff {
+	diffs := &diffList{
+		options: options,
+		diffs:   make([]OutputDiff, 0),
+		count:   make(map[string]int),
+	}
+
+	if a.RunNumber != b.RunNumber {
+		diffs.add("Run/runInfo", -1, -1, "run number %d != %d", a.RunNumber, b.RunNumber)
+	}
+	compareMapping(diffs, "Sensors/DataPMT", a.PmtChannels, a.PmtSensors, b.PmtChannels, b.PmtSensors)
+	compareMapping(diffs, "Sensors/DataSiPM", a.SipmChannels, a.SipmSensors, b.SipmChannels, b.SipmSensors)
+
+	params := make([]string, 0)
+	for param := range a.TriggerConfig {
+		params = append(params, param)
+	}
+	for param := range b.TriggerConfig {
+		if _, found := a.TriggerConfig[param]; !found {
+			params = append(params, param)
+		}
+	}
+	sort.Strings(params)
+	for _, param := range params {
+		valueA, foundA := a.TriggerConfig[param]
+		valueB, foundB := b.TriggerConfig[param]
+		switch {
+		case !foundA || !foundB:
+			diffs.add("Trigger/configuration", -1, -1, "parameter %s only in one file", param)
+		case valueA != valueB:
+			diffs.add("Trigger/configuration", -1, -1, "%s %d != %d", param, valueA, valueB)
+		}
+	}
+
+	// Row of each event in the files
+	rowsA := eventRows(a)
+	rowsB := eventRows(b)
+	eventIDs := make([]int32, 0)
+	for _, event := range a.Events {
+		if _, found := rowsB[event.EventID]; found {
+			eventIDs = append(eventIDs, event.EventID)
+		} else {
+			diffs.add("Run/events", event.EventID, -1, "event only in %s", nameOr(a.Filename, "first file"))
+		}
+	}
+	for _, event := range b.Events {
+		if _, found := rowsA[event.EventID]; !found {
+			diffs.add("Run/events", event.EventID, -1, "event only in %s", nameOr(b.Filename, "second file"))
+		}
+	}
+
+	for _, eventID := range eventIDs {
+		rowA, rowB := rowsA[eventID], rowsB[eventID]
+		if a.Events[rowA].Timestamp != b.Events[rowB].Timestamp {
+			diffs.add("Run/events", eventID, -1, "timestamp %d != %d",
+				a.Events[rowA].Timestamp, b.Events[rowB].Timestamp)
+		}
+		compareRowValue(diffs, "Trigger/triggerLost", eventID, "triggerLost1", a.TriggerLost1, rowA, b.TriggerLost1, rowB)
+		compareRowValue(diffs, "Trigger/triggerLost", eventID, "triggerLost2", a.TriggerLost2, rowA, b.TriggerLost2, rowB)
+		compareRowValue(diffs, "Trigger/trigger", eventID, "trigger_type", a.TriggerType, rowA, b.TriggerType, rowB)
+	}
+
+	names := make([]string, 0)
+	for name := range a.Arrays {
+		names = append(names, name)
+	}
+	for name := range b.Arrays {
+		if _, found := a.Arrays[name]; !found {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		arrayA, foundA := a.Arrays[name]
+		arrayB, foundB := b.Arrays[name]
+		if !foundA || !foundB {
+			diffs.add(name, -1, -1, "dataset only in one file")
+			continue
+		}
+		// The number of channels may change, they are matched later
+		if len(arrayA.Dims) != len(arrayB.Dims) || (len(arrayA.Dims) == 3 && arrayA.Dims[2] != arrayB.Dims[2]) {
+			diffs.add(name, -1, -1, "shape %v != %v", arrayA.Dims, arrayB.Dims)
+			continue
+		}
+		channelsA, channelsB := arrayChannels(a, name), arrayChannels(b, name)
+		for _, eventID := range eventIDs {
+			rowA, rowB := rowsA[eventID], rowsB[eventID]
+			if rowA >= arrayA.Dims[0] || rowB >= arrayB.Dims[0] {
+				diffs.add(name, eventID, -1, "event missing in the dataset")
+				continue
+			}
+			compareArrayRow(diffs, name, eventID, arrayA, rowA, channelsA, arrayB, rowB, channelsB)
+		}
+	}
+
+	// Report how many differences were left out
+	datasets := make([]string, 0, len(diffs.count))
+	for dataset := range diffs.count {
+		datasets = append(datasets, dataset)
+	}
+	sort.Strings(datasets)
+	for _, dataset := range datasets {
+		count := diffs.count[dataset]
+		if options.MaxDiffs > 0 && count > options.MaxDiffs {
+			diffs.diffs = append(diffs.diffs, OutputDiff{
+				Dataset: dataset,
+				EventID: -1,
+				Channel: -1,
+				Message: fmt.Sprintf("%d more differences not shown", count-options.MaxDiffs),
+			})
+		}
+	}
+	return diffs.diffs
+}
+
+func nameOr(name string, alternative string) string {
+	if name == "" {
+		return alternative
+	}
+	return name
+}
+
+func eventRows(output *Output) map[int32]int {
+	rows := make(map[int32]int)
+	for i, event := range output.Events {
+		rows[event.EventID] = i
+	}
+	return rows
+}
+
+func compareMapping(diffs *diffList, dataset string, channelsA []int32, sensorsA []int32,
+	channelsB []int32, sensorsB []int32) {
+	if !slices.Equal(channelsA, channelsB) || !slices.Equal(sensorsA, sensorsB) {
+		diffs.add(dataset, -1, -1, "%d channels %v != %d channels %v",
+			len(channelsA), shortList(channelsA), len(channelsB), shortList(channelsB))
+	}
+}
+
+func shortList(values []int32) string {
+	if len(values) <= 8 {
+		return fmt.Sprint(values)
+	}
+	return strings.TrimSuffix(fmt.Sprint(values[:8]), "]") + " ...]"
+}
+
+func compareRowValue(diffs *diffList, dataset string, eventID int32, field string,
+	valuesA []int32, rowA int, valuesB []int32, rowB int) {
+	if rowA >= len(valuesA) || rowB >= len(valuesB) {
+		if rowA < len(valuesA) || rowB < len(valuesB) {
+			diffs.add(dataset, eventID, -1, "%s missing in one file", field)
+		}
+		return
+	}
+	if valuesA[rowA] != valuesB[rowB] {
+		diffs.add(dataset, eventID, -1, "%s %d != %d", field, valuesA[rowA], valuesB[rowB])
+	}
+}
+
+// Channel of each position in the second dimension, nil if the positions
+// are not channels
+func arrayChannels(output *Output, name string) []int32 {
+	switch strings.TrimPrefix(name, "RD/") {
+	case "pmtrwf", "pmt_blr", "pmt_baselines", "blr_baselines", "pmt_valid", "blr_valid":
+		return output.PmtChannels
+	case "sipmrwf", "sipm_valid":
+		return output.SipmChannels
+	}
+	return nil
+}
+
+func compareArrayRow(diffs *diffList, name string, eventID int32,
+	arrayA Array16, rowA int, channelsA []int32, arrayB Array16, rowB int, channelsB []int32) {
+	valuesA, valuesB := arrayA.Row(rowA), arrayB.Row(rowB)
+	// Values per channel
+	width := 1
+	if len(arrayA.Dims) == 3 && arrayA.Dims[2] > 0 {
+		width = arrayA.Dims[2]
+	}
+	nA, nB := len(valuesA)/width, len(valuesB)/width
+
+	// Without channel labels, positions are compared
+	if channelsA == nil || len(channelsA) != nA || channelsB == nil || len(channelsB) != nB {
+		if len(valuesA) != len(valuesB) {
+			diffs.add(name, eventID, -1, "%d values != %d values", len(valuesA), len(valuesB))
+			return
+		}
+		compareValues(diffs, name, eventID, -1, valuesA, valuesB)
+		return
+	}
+
+	positionsB := make(map[int32]int)
+	for i, channel := range channelsB {
+		positionsB[channel] = i
+	}
+	for i, channel := range channelsA {
+		j, found := positionsB[channel]
+		if !found {
+			diffs.add(name, eventID, channel, "channel only in one file")
+			continue
+		}
+		delete(positionsB, channel)
+		compareValues(diffs, name, eventID, channel,
+			valuesA[i*width:(i+1)*width], valuesB[j*width:(j+1)*width])
+	}
+	for _, channel := range channelsB {
+		if _, left := positionsB[channel]; left {
+			diffs.add(name, eventID, channel, "channel only in one file")
+		}
+	}
+}
+
+func compareValues(diffs *diffList, name string, eventID int32, channel int32, valuesA []int16, valuesB []int16) {
+	nDiffs, first := 0, -1
+	for i := range valuesA {
+		diff := int(valuesA[i]) - int(valuesB[i])
+		if diff > diffs.options.Tolerance || -diff > diffs.options.Tolerance {
+			if first < 0 {
+				first = i
+			}
+			nDiffs++
+		}
+	}
+	if nDiffs > 0 {
+		diffs.add(name, eventID, channel, "%d values differ, first at %d: %d != %d",
+			nDiffs, first, valuesA[first], valuesB[first])
+	}
+}
@@ -0,0 +1,107 @@
+package hdf5writer
+
+import (
+	"strings"
+	"testing"
+)
+
+func testOutput() *Output {
+	return &Output{
+		RunNumber:     1,
+		Events:        []OutputEvent{{EventID: 10, Timestamp: 100}, {EventID: 11, Timestamp: 200}},
+		TriggerLost1:  []int32{0, 0},
+		TriggerLost2:  []int32{0, 1},
+		TriggerType:   []int32{1, 1},
+		TriggerConfig: map[string]int32{"triggerMask": 3},
+		PmtChannels:   []int32{100, 101},
+		PmtSensors:    []int32{-1, -1},
+		Arrays: map[string]Array16{
+			// 2 events, 2 PMTs, 3 samples
+			"RD/pmtrwf":        {Dims: []int{2, 2, 3}, Data: []int16{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}},
+			"RD/pmt_baselines": {Dims: []int{2, 2}, Data: []int16{20, 21, 22, 23}},
+		},
+	}
+}
+
+func TestCompareOutputsEqual(t *testing.T) {
+	diffs := CompareOutputs(testOutput(), testOutput(), CompareOptions{})
+	if len(diffs) != 0 {
+		t.Fatalf("unexpected differences: %v", diffs)
+	}
+}
+
+func TestCompareOutputsOrder(t *testing.T) {
+	// Same content with the events and the channels in a different order
+	b := testOutput()
+	b.Events[0], b.Events[1] = b.Events[1], b.Events[0]
+	b.TriggerLost2 = []int32{1, 0}
+	b.PmtChannels = []int32{101, 100}
+	b.Arrays["RD/pmtrwf"] = Array16{Dims: []int{2, 2, 3}, Data: []int16{10, 11, 12, 7, 8, 9, 4, 5, 6, 1, 2, 3}}
+	b.Arrays["RD/pmt_baselines"] = Array16{Dims: []int{2, 2}, Data: []int16{23, 22, 21, 20}}
+
+	diffs := CompareOutputs(testOutput(), b, CompareOptions{})
+	// Only the sensor tables are compared in file order
+	if len(diffs) != 1 || diffs[0].Dataset != "Sensors/DataPMT" {
+		t.Fatalf("unexpected differences: %v", diffs)
+	}
+}
+
+func TestCompareOutputsWaveform(t *testing.T) {
+	b := testOutput()
+	b.Arrays["RD/pmtrwf"].Data[10] = 13
+
+	diffs := CompareOutputs(testOutput(), b, CompareOptions{})
+	if len(diffs) != 1 {
+		t.Fatalf("expected one difference, got %v", diffs)
+	}
+	diff := diffs[0]
+	if diff.Dataset != "RD/pmtrwf" || diff.EventID != 11 || diff.Channel != 101 {
+		t.Fatalf("wrong difference: %v", diff)
+	}
+	if !strings.Contains(diff.String(), "first at 1: 11 != 13") {
+		t.Fatalf("wrong message: %v", diff)
+	}
+
+	// Inside tolerance
+	diffs = CompareOutputs(testOutput(), b, CompareOptions{Tolerance: 2})
+	if len(diffs) != 0 {
+		t.Fatalf("unexpected differences: %v", diffs)
+	}
+}
+
+func TestCompareOutputsMissing(t *testing.T) {
+	b := testOutput()
+	b.Events[1].EventID = 12
+	delete(b.Arrays, "RD/pmt_baselines")
+	b.TriggerConfig["triggerMask"] = 4
+
+	diffs := CompareOutputs(testOutput(), b, CompareOptions{})
+	expected := []string{
+		"Trigger/configuration: triggerMask 3 != 4",
+		"Run/events, event 11: event only in first file",
+		"Run/events, event 12: event only in second file",
+		"RD/pmt_baselines: dataset only in one file",
+	}
+	if len(diffs) != len(expected) {
+		t.Fatalf("expected %d differences, got %v", len(expected), diffs)
+	}
+	for i, diff := range diffs {
+		if diff.String() != expected[i] {
+			t.Errorf("difference %d: got %q, expected %q", i, diff.String(), expected[i])
+		}
+	}
+}
+
+func TestCompareOutputsMaxDiffs(t *testing.T) {
+	b := testOutput()
+	for i := range b.Arrays["RD/pmtrwf"].Data {
+		b.Arrays["RD/pmtrwf"].Data[i] = 0
+	}
+	diffs := CompareOutputs(testOutput(), b, CompareOptions{MaxDiffs: 2})
+	if len(diffs) != 3 {
+		t.Fatalf("expected 3 differences, got %v", diffs)
+	}
+	if diffs[2].Message != "2 more differences not shown" {
+		t.Fatalf("wrong summary: %v", diffs[2])
+	}
+}
@@ -0,0 +1,237 @@
+package hdf5writer
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	decoder "github.com/next-exp/decoder_go/pkg"
+)
+
+// End-to-end tests: synthetic raw events are decoded and written with
+// Writer, and every dataset is compared with the golden files in
+// testdata/golden. After an intended change of the output, regenerate
+// them with:
+//
+//	go test ./pkg/hdf5writer -run TestGolden -update
+var updateGolden = flag.Bool("update", false, "write the golden files in testdata/golden")
+
+type goldenCase struct {
+	name      string
+	generator func(config *decoder.GeneratorConfig)
+	decoder   func(config *decoder.Configuration)
+	// Interleave events with a second trigger type, for split trigger
+	secondTrigger bool
+	// Use a sensor map as if it came from the database
+	database bool
+}
+
+func goldenCases() []goldenCase {
+	noChange := func(config *decoder.Configuration) {}
+	return []goldenCase{
+		{name: "raw", generator: func(config *decoder.GeneratorConfig) {}, decoder: noChange},
+		{name: "compressed", generator: func(config *decoder.GeneratorConfig) {
+			config.PmtCompressed = true
+			config.SipmCompressed = true
+		}, decoder: noChange},
+		{name: "sipm_zs", generator: func(config *decoder.GeneratorConfig) {
+			config.SipmZeroSuppression = true
+		}, decoder: noChange},
+		{name: "sipm_zs_compressed", generator: func(config *decoder.GeneratorConfig) {
+			config.SipmZeroSuppression = true
+			config.SipmCompressed = true
+		}, decoder: noChange},
+		{name: "baselines", generator: func(config *decoder.GeneratorConfig) {
+			config.PmtBaselines = true
+		}, decoder: noChange},
+		{name: "split_trigger", generator: func(config *decoder.GeneratorConfig) {}, decoder: func(config *decoder.Configuration) {
+			config.SplitTrg = true
+			config.TrgCode1 = 1
+			config.TrgCode2 = 9
+		}, secondTrigger: true},
+		{name: "database", generator: func(config *decoder.GeneratorConfig) {}, decoder: func(config *decoder.Configuration) {
+			config.NoDB = false
+		}, database: true},
+		{name: "keep_partial", generator: func(config *decoder.GeneratorConfig) {
+			config.Faults.Truncate = 0.1
+		}, decoder: func(config *decoder.Configuration) {
+			config.KeepPartial = true
+		}},
+	}
+}
+
+// Small events, with dual PMT channels and two SiPM FECs
+func goldenGeneratorConfig() decoder.GeneratorConfig {
+	config := decoder.DefaultGeneratorConfig()
+	config.BufferSamples = 160
+	config.PreTrigger = 40
+	config.SipmFecs = []uint16{32, 34}
+	config.SipmFebsPerFec = 1
+	return config
+}
+
+// Sensor IDs: PMTs from 0 in elecID order, SiPMs keep their elecID
+func goldenSensorsMap(events []decoder.GeneratedEvent) decoder.SensorsMap {
+	sensors := decoder.SensorsMap{
+		Pmts:  decoder.SensorMapping{ToElecID: make(map[uint16]uint16), ToSensorID: make(map[uint16]uint16)},
+		Sipms: decoder.SensorMapping{ToElecID: make(map[uint16]uint16), ToSensorID: make(map[uint16]uint16)},
+	}
+	for _, event := range events {
+		for elecID := range event.PmtWaveforms {
+			if elecID%100 < 12 {
+				sensorID := (elecID/100-1)*12 + elecID%100
+				sensors.Pmts.ToSensorID[elecID] = sensorID
+				sensors.Pmts.ToElecID[sensorID] = elecID
+			}
+		}
+		for elecID := range event.SipmWaveforms {
+			sensors.Sipms.ToSensorID[elecID] = elecID
+			sensors.Sipms.ToElecID[elecID] = elecID
+		}
+	}
+	return sensors
+}
+
+func goldenEvents(t *testing.T, test goldenCase) []decoder.GeneratedEvent {
+	config := goldenGeneratorConfig()
+	test.generator(&config)
+	generator, err := decoder.NewGenerator(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var second *decoder.Generator
+	if test.secondTrigger {
+		config.TriggerType = 9
+		config.FirstEvent = 100
+		config.Seed++
+		second, err = decoder.NewGenerator(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events := make([]decoder.GeneratedEvent, 0)
+	for i := 0; i < 4; i++ {
+		events = append(events, generator.NextEvent())
+		if second != nil {
+			events = append(events, second.NextEvent())
+		}
+	}
+	return events
+}
+
+// Decodes the events with the full pipeline and reads back the output files
+func decodeToOutputs(t *testing.T, events []decoder.GeneratedEvent, config decoder.Configuration) []*Output {
+	dir := t.TempDir()
+	config.FileOut = filepath.Join(dir, "out.h5")
+	config.FileOut2 = filepath.Join(dir, "out_trg2.h5")
+	decoder.SetConfiguration(config)
+	defer decoder.SetConfiguration(testConfiguration())
+
+	routes := config.OutputRoutes()
+	router, err := decoder.OpenRouter(routes, config.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, generated := range events {
+		header, eventData, err := decoder.ReadEvent(generated.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		event, err := decoder.ReadGDC(eventData, header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoder.ProcessDecodedEvent(event, config, router)
+	}
+	if err := router.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	outputs := make([]*Output, 0)
+	for _, filename := range routes.Filenames(config.FileOut) {
+		output, err := ReadOutput(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, output)
+	}
+	return outputs
+}
+
+func goldenPath(name string, index int) string {
+	if index > 0 {
+		name += "_trg2"
+	}
+	return filepath.Join("testdata", "golden", name+".json")
+}
+
+func readGolden(filename string) (*Output, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	output := &Output{}
+	err = json.Unmarshal(data, output)
+	output.Filename = filename
+	return output, err
+}
+
+func writeGolden(filename string, output *Output) error {
+	data, err := json.Marshal(output)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0644)
+}
+
+func TestGolden(t *testing.T) {
+	setupTestConfiguration()
+	for _, test := range goldenCases() {
+		t.Run(test.name, func(t *testing.T) {
+			nOutputs := 1
+			if test.secondTrigger {
+				nOutputs = 2
+			}
+			goldens := make([]*Output, nOutputs)
+			if !*updateGolden {
+				for i := range goldens {
+					golden, err := readGolden(goldenPath(test.name, i))
+					if errors.Is(err, os.ErrNotExist) {
+						t.Fatalf("golden file %s not found, create it with -update", goldenPath(test.name, i))
+					}
+					if err != nil {
+						t.Fatal(err)
+					}
+					goldens[i] = golden
+				}
+			}
+
+			events := goldenEvents(t, test)
+			config := testConfiguration()
+			test.decoder(&config)
+			if test.database {
+				previous := decoder.GetSensorsMap()
+				decoder.SetSensorsMap(goldenSensorsMap(events))
+				defer decoder.SetSensorsMap(previous)
+			}
+			outputs := decodeToOutputs(t, events, config)
+
+			for i, output := range outputs {
+				if *updateGolden {
+					if err := writeGolden(goldenPath(test.name, i), output); err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+				diffs := CompareOutputs(goldens[i], output, CompareOptions{MaxDiffs: 10})
+				for _, diff := range diffs {
+					t.Error(diff.String())
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
-package decoder
+package hdf5writer
 
 import (
+	decoder "github.com/next-exp/decoder_go/pkg"
 	"github.com/next-exp/hdf5-go"
 )
 
@@ -43,7 +44,7 @@ func convertToHdf5String(s string) [STRLEN]byte {
 func openFile(fname string) (*hdf5.File, error) {
 	f, err := hdf5.CreateFile(fname, hdf5.F_ACC_TRUNC)
 	if err != nil {
-		logger.Error(err.Error())
+		decoder.ModuleLogger("hdf5").Error("HDF5 error", "error", err)
 		err = &ErrOpenFile{
 			Filename: fname,
 			Err:      err,
@@ -55,7 +56,7 @@ func openFile(fname string) (*hdf5.File, error) {
 func createGroup(file *hdf5.File, groupName string) (*hdf5.Group, error) {
 	g, err := file.CreateGroup(groupName)
 	if err != nil {
-		logger.Error(err.Error())
+		decoder.ModuleLogger("hdf5").Error("HDF5 error", "error", err)
 		err = &ErrCreateGroup{
 			GroupName: groupName,
 			Err:       err,
@@ -90,50 +91,52 @@ func create2dArray(group *hdf5.Group, name string, nSensors int) *hdf5.Dataset {
 func createArray(group *hdf5.Group, name string, dims []uint, maxDims []uint, chunks []uint) *hdf5.Dataset {
 	file_spaceArray, err := hdf5.CreateSimpleDataspace(dims, maxDims)
 	if err != nil {
-		logger.Error(err.Error())
+		decoder.ModuleLogger("hdf5").Error("HDF5 error", "error", err)
 	}
 
 	// create property list
 	plistArray, err := hdf5.NewPropList(hdf5.P_DATASET_CREATE)
 	if err != nil {
-		logger.Error(err.Error())
+		decoder.ModuleLogger("hdf5").Error("HDF5 error", "error", err)
 	}
 
 	err = plistArray.SetChunk(chunks)
 	if err != nil {
-		logger.Error(err.Error())
+		decoder.ModuleLogger("hdf5").Error("HDF5 error", "error", err)
 	}
 
 	// Set compression level
-	if configuration.UseBlosc {
-		err = hdf5.ConfigureBloscFilter(plistArray, configuration.BloscAlgorithm.Code, configuration.CompressionLevel, configuration.BloscShuffle.Code)
+	config := decoder.GetConfiguration()
+	if config.UseBlosc {
+		err = hdf5.ConfigureBloscFilter(plistArray, hdf5.BloscFilter(config.BloscAlgorithm.Code), config.CompressionLevel,
+			hdf5.BloscShuffle(config.BloscShuffle.Code))
 	} else {
-		err = plistArray.SetDeflate(configuration.CompressionLevel)
+		err = plistArray.SetDeflate(config.CompressionLevel)
 	}
 	if err != nil {
-		logger.Error(err.Error())
+		decoder.ModuleLogger("hdf5").Error("HDF5 error", "error", err)
 	}
 
 	// create the dataset
 	dsetArray, err := group.CreateDatasetWith(name, hdf5.T_NATIVE_INT16, file_spaceArray, plistArray)
 	if err != nil {
-		logger.Error(err.Error())
+		decoder.ModuleLogger("hdf5").Error("HDF5 error", "error", err)
 	}
 
 	err = file_spaceArray.Close()
 	if err != nil {
-		logger.Error(err.Error())
+		decoder.ModuleLogger("hdf5").Error("HDF5 error", "error", err)
 	}
 	err = plistArray.Close()
 	if err != nil {
-		logger.Error(err.Error())
+		decoder.ModuleLogger("hdf5").Error("HDF5 error", "error", err)
 	}
 
 	return dsetArray
 }
 
 func errorCreateTable(name string, err error) error {
-	logger.Error(err.Error())
+	decoder.ModuleLogger("hdf5").Error("Error creating table", "table", name, "error", err)
 	return &ErrCreateTable{
 		TableName: name,
 		Err:       err,
@@ -165,10 +168,12 @@ func createTable(group *hdf5.Group, name string, datatype interface{}) (*hdf5.Da
 	}
 
 	// Set compression level
-	if configuration.UseBlosc {
-		err = hdf5.ConfigureBloscFilter(plist, configuration.BloscAlgorithm.Code, configuration.CompressionLevel, configuration.BloscShuffle.Code)
+	config := decoder.GetConfiguration()
+	if config.UseBlosc {
+		err = hdf5.ConfigureBloscFilter(plist, hdf5.BloscFilter(config.BloscAlgorithm.Code), config.CompressionLevel,
+			hdf5.BloscShuffle(config.BloscShuffle.Code))
 	} else {
-		err = plist.SetDeflate(configuration.CompressionLevel)
+		err = plist.SetDeflate(config.CompressionLevel)
 	}
 	if err != nil {
 		err = errorCreateTable(name, err)
@@ -220,7 +225,7 @@ func writeArrayToTable[T any](dataset *hdf5.Dataset, data *[]T, evtCounter int)
 	dims := []uint{length}
 	dataspace, err := hdf5.CreateSimpleDataspace(dims, nil)
 	if err != nil {
-		logger.Error(err.Error())
+		decoder.ModuleLogger("hdf5").Error("HDF5 error", "error", err)
 	}
 
 	// extend
@@ -228,7 +233,7 @@ func writeArrayToTable[T any](dataset *hdf5.Dataset, data *[]T, evtCounter int)
 	newsize := []uint{eventsInFile + length}
 	err = dataset.Resize(newsize)
 	if err != nil {
-		logger.Error(err.Error())
+		decoder.ModuleLogger("hdf5").Error("HDF5 error", "error", err)
 	}
 	filespace := dataset.Space()
 
@@ -236,21 +241,21 @@ func writeArrayToTable[T any](dataset *hdf5.Dataset, data *[]T, evtCounter int)
 	count := []uint{length}
 	err = filespace.SelectHyperslab(start, nil, count, nil)
 	if err != nil {
-		logger.Error(err.Error())
+		decoder.ModuleLogger("hdf5").Error("HDF5 error", "error", err)
 	}
 
 	err = dataset.WriteSubset(data, dataspace, filespace)
 	if err != nil {
-		logger.Error(err.Error())
+		decoder.ModuleLogger("hdf5").Error("HDF5 error", "error", err)
 	}
 
 	err = dataspace.Close()
 	if err != nil {
-		logger.Error(err.Error())
+		decoder.ModuleLogger("hdf5").Error("HDF5 error", "error", err)
 	}
 	err = filespace.Close()
 	if err != nil {
-		logger.Error(err.Error())
+		decoder.ModuleLogger("hdf5").Error("HDF5 error", "error", err)
 	}
 }
 
@@ -259,7 +264,7 @@ func write3dArray(dataset *hdf5.Dataset, data *[]int16, evtCounter int, nSensors
 	newsize := []uint{uint(evtCounter) + 1, uint(nSensors), uint(nSamples)}
 	err := dataset.Resize(newsize)
 	if err != nil {
-		logger.Error(err.Error())
+		decoder.ModuleLogger("hdf5").Error("HDF5 error", "error", err)
 	}
 	filespace := dataset.Space()
 
@@ -269,22 +274,22 @@ func write3dArray(dataset *hdf5.Dataset, data *[]int16, evtCounter int, nSensors
 
 	dataspace, err := hdf5.CreateSimpleDataspace(count, nil)
 	if err != nil {
-		logger.Error(err.Error())
+		decoder.ModuleLogger("hdf5").Error("HDF5 error", "error", err)
 	}
 
 	// write data to the dataset
 	err = dataset.WriteSubset(data, dataspace, filespace)
 	if err != nil {
-		logger.Error(err.Error())
+		decoder.ModuleLogger("hdf5").Error("HDF5 error", "error", err)
 	}
 
 	err = dataspace.Close()
 	if err != nil {
-		logger.Error(err.Error())
+		decoder.ModuleLogger("hdf5").Error("HDF5 error", "error", err)
 	}
 	err = filespace.Close()
 	if err != nil {
-		logger.Error(err.Error())
+		decoder.ModuleLogger("hdf5").Error("HDF5 error", "error", err)
 	}
 }
 
@@ -293,7 +298,7 @@ func write2dArray(dataset *hdf5.Dataset, data *[]int16, evtCounter int, nSensors
 	newsize := []uint{uint(evtCounter) + 1, uint(nSensors)}
 	err := dataset.Resize(newsize)
 	if err != nil {
-		logger.Error(err.Error())
+		decoder.ModuleLogger("hdf5").Error("HDF5 error", "error", err)
 	}
 	filespace := dataset.Space()
 
@@ -303,20 +308,20 @@ func write2dArray(dataset *hdf5.Dataset, data *[]int16, evtCounter int, nSensors
 
 	dataspace, err := hdf5.CreateSimpleDataspace(count, nil)
 	if err != nil {
-		logger.Error(err.Error())
+		decoder.ModuleLogger("hdf5").Error("HDF5 error", "error", err)
 	}
 
 	err = dataset.WriteSubset(data, dataspace, filespace)
 	if err != nil {
-		logger.Error(err.Error())
+		decoder.ModuleLogger("hdf5").Error("HDF5 error", "error", err)
 	}
 
 	err = dataspace.Close()
 	if err != nil {
-		logger.Error(err.Error())
+		decoder.ModuleLogger("hdf5").Error("HDF5 error", "error", err)
 	}
 	err = filespace.Close()
 	if err != nil {
-		logger.Error(err.Error())
+		decoder.ModuleLogger("hdf5").Error("HDF5 error", "error", err)
 	}
 }
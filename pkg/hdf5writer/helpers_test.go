@@ -0,0 +1,34 @@
+package hdf5writer
+
+import (
+	"io"
+	"log/slog"
+
+	decoder "github.com/next-exp/decoder_go/pkg"
+)
+
+func testConfiguration() decoder.Configuration {
+	return decoder.Configuration{
+		WriteData:        true,
+		NoDB:             true,
+		ExtTrigger:       15,
+		PmtSumCh:         -1,
+		ReadPMTs:         true,
+		ReadSiPMs:        true,
+		ReadTrigger:      true,
+		Discard:          true,
+		CompressionLevel: 4,
+		OutputFormat:     "hdf5",
+		ArrowCompression: "zstd",
+		CheckFecSync:     true,
+		DiscardDesync:    true,
+		CheckWordCount:   true,
+	}
+}
+
+func setupTestConfiguration() {
+	decoder.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	decoder.SetConfiguration(testConfiguration())
+	huffman := decoder.DefaultHuffmanTable().Tree()
+	decoder.SetHuffmanCodes(huffman, huffman)
+}
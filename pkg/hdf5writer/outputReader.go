@@ -0,0 +1,255 @@
+package hdf5writer
+
+import (
+	"fmt"
+
+	hdf5 "github.com/next-exp/hdf5-go"
+)
+
+// Content of a file written by Writer. It is read back to compare the
+// output of different decoder versions and in the golden tests.
+type Output struct {
+	Filename      string             `json:"-"`
+	RunNumber     int32              `json:"run_number"`
+	Events        []OutputEvent      `json:"events"`
+	TriggerLost1  []int32            `json:"trigger_lost1"`
+	TriggerLost2  []int32            `json:"trigger_lost2"`
+	TriggerType   []int32            `json:"trigger_type"`
+	TriggerConfig map[string]int32   `json:"trigger_config"`
+	PmtChannels   []int32            `json:"pmt_channels"`
+	PmtSensors    []int32            `json:"pmt_sensors"`
+	SipmChannels  []int32            `json:"sipm_channels"`
+	SipmSensors   []int32            `json:"sipm_sensors"`
+	Arrays        map[string]Array16 `json:"arrays"`
+}
+
+type OutputEvent struct {
+	EventID   int32  `json:"event_id"`
+	Timestamp uint64 `json:"timestamp"`
+}
+
+// Waveforms, baselines and the rest of the arrays, the first dimension
+// is the event
+type Array16 struct {
+	Dims []int   `json:"dims"`
+	Data []int16 `json:"data"`
+}
+
+// Values of one event
+func (a Array16) Row(event int) []int16 {
+	size := 1
+	for _, dim := range a.Dims[1:] {
+		size *= dim
+	}
+	return a.Data[event*size : (event+1)*size]
+}
+
+func ReadOutput(filename string) (*Output, error) {
+	file, err := hdf5.OpenFile(filename, hdf5.F_ACC_RDONLY)
+	if err != nil {
+		return nil, &ErrOpenFile{Filename: filename, Err: err}
+	}
+	defer file.Close()
+
+	output := &Output{
+		Filename:      filename,
+		TriggerConfig: make(map[string]int32),
+		Arrays:        make(map[string]Array16),
+	}
+
+	runInfo := make([]RunInfoHDF5, 0)
+	if err := readTable(file, "Run/runInfo", &runInfo); err != nil {
+		return nil, err
+	}
+	if len(runInfo) > 0 {
+		output.RunNumber = runInfo[0].run_number
+	}
+
+	events := make([]EventDataHDF5, 0)
+	if err := readTable(file, "Run/events", &events); err != nil {
+		return nil, err
+	}
+	for _, event := range events {
+		output.Events = append(output.Events, OutputEvent{
+			EventID:   event.evt_number,
+			Timestamp: event.timestamp,
+		})
+	}
+
+	triggerLost := make([]TriggerLostHDF5, 0)
+	if err := readTable(file, "Trigger/triggerLost", &triggerLost); err != nil {
+		return nil, err
+	}
+	for _, lost := range triggerLost {
+		output.TriggerLost1 = append(output.TriggerLost1, lost.triggerLost1)
+		output.TriggerLost2 = append(output.TriggerLost2, lost.triggerLost2)
+	}
+
+	triggerType := make([]TriggerTypeHDF5, 0)
+	if err := readTable(file, "Trigger/trigger", &triggerType); err != nil {
+		return nil, err
+	}
+	for _, trigger := range triggerType {
+		output.TriggerType = append(output.TriggerType, trigger.trigger_type)
+	}
+
+	params := make([]TriggerParamsHDF5, 0)
+	if err := readTable(file, "Trigger/configuration", &params); err != nil {
+		return nil, err
+	}
+	for _, param := range params {
+		output.TriggerConfig[hdf5StringToString(param.paramStr)] = param.value
+	}
+
+	pmts := make([]SensorMappingHDF5, 0)
+	if err := readTable(file, "Sensors/DataPMT", &pmts); err != nil {
+		return nil, err
+	}
+	for _, pmt := range pmts {
+		output.PmtChannels = append(output.PmtChannels, pmt.channel)
+		output.PmtSensors = append(output.PmtSensors, pmt.sensorID)
+	}
+
+	sipms := make([]SensorMappingHDF5, 0)
+	if err := readTable(file, "Sensors/DataSiPM", &sipms); err != nil {
+		return nil, err
+	}
+	for _, sipm := range sipms {
+		output.SipmChannels = append(output.SipmChannels, sipm.channel)
+		output.SipmSensors = append(output.SipmSensors, sipm.sensorID)
+	}
+
+	// All the datasets in RD are arrays, they depend on the configuration
+	for _, groupName := range []string{"RD", "Trigger"} {
+		names, err := listDatasets(file, groupName)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			path := groupName + "/" + name
+			if groupName == "Trigger" && name != "events" {
+				continue
+			}
+			array, err := readArray16(file, path)
+			if err != nil {
+				return nil, err
+			}
+			output.Arrays[path] = array
+		}
+	}
+	// Per event flags in Run, written only with some options
+	for _, path := range []string{"Run/desync", "Run/trigger_valid"} {
+		if !file.LinkExists(path) {
+			continue
+		}
+		array, err := readArray16(file, path)
+		if err != nil {
+			return nil, err
+		}
+		output.Arrays[path] = array
+	}
+	return output, nil
+}
+
+func hdf5StringToString(s [STRLEN]byte) string {
+	length := 0
+	for length < len(s) && s[length] != 0 {
+		length++
+	}
+	return string(s[:length])
+}
+
+func openDataset(file *hdf5.File, path string) (*hdf5.Dataset, error) {
+	dataset, err := file.OpenDataset(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening dataset %s: %w", path, err)
+	}
+	return dataset, nil
+}
+
+// Missing tables are read as empty
+func readTable[T any](file *hdf5.File, path string, data *[]T) error {
+	if !file.LinkExists(path) {
+		return nil
+	}
+	dataset, err := openDataset(file, path)
+	if err != nil {
+		return err
+	}
+	defer dataset.Close()
+
+	dims, _, err := dataset.Space().SimpleExtentDims()
+	if err != nil {
+		return fmt.Errorf("error reading dimensions of %s: %w", path, err)
+	}
+	if len(dims) != 1 {
+		return fmt.Errorf("table %s has %d dimensions", path, len(dims))
+	}
+	*data = make([]T, dims[0])
+	if dims[0] == 0 {
+		return nil
+	}
+	if err := dataset.Read(data); err != nil {
+		return fmt.Errorf("error reading table %s: %w", path, err)
+	}
+	return nil
+}
+
+func readArray16(file *hdf5.File, path string) (Array16, error) {
+	array := Array16{}
+	dataset, err := openDataset(file, path)
+	if err != nil {
+		return array, err
+	}
+	defer dataset.Close()
+
+	dims, _, err := dataset.Space().SimpleExtentDims()
+	if err != nil {
+		return array, fmt.Errorf("error reading dimensions of %s: %w", path, err)
+	}
+	size := 1
+	for _, dim := range dims {
+		array.Dims = append(array.Dims, int(dim))
+		size *= int(dim)
+	}
+	array.Data = make([]int16, size)
+	if size == 0 {
+		return array, nil
+	}
+	if err := dataset.Read(&array.Data); err != nil {
+		return array, fmt.Errorf("error reading array %s: %w", path, err)
+	}
+	return array, nil
+}
+
+func listDatasets(file *hdf5.File, groupName string) ([]string, error) {
+	names := make([]string, 0)
+	if !file.LinkExists(groupName) {
+		return names, nil
+	}
+	group, err := file.OpenGroup(groupName)
+	if err != nil {
+		return nil, fmt.Errorf("error opening group %s: %w", groupName, err)
+	}
+	defer group.Close()
+
+	nObjects, err := group.NumObjects()
+	if err != nil {
+		return nil, fmt.Errorf("error listing group %s: %w", groupName, err)
+	}
+	for i := uint(0); i < nObjects; i++ {
+		objectType, err := group.ObjectTypeByIndex(i)
+		if err != nil {
+			return nil, fmt.Errorf("error listing group %s: %w", groupName, err)
+		}
+		if objectType != hdf5.H5G_DATASET {
+			continue
+		}
+		name, err := group.ObjectNameByIndex(i)
+		if err != nil {
+			return nil, fmt.Errorf("error listing group %s: %w", groupName, err)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
@@ -1,4 +1,4 @@
-package decoder
+package hdf5writer
 
 import (
 	"errors"
@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"sort"
 
+	decoder "github.com/next-exp/decoder_go/pkg"
 	hdf5 "github.com/next-exp/hdf5-go"
 	"golang.org/x/exp/maps"
 )
@@ -34,23 +35,43 @@ type Writer struct {
 	SipmWaveforms      *hdf5.Dataset
 	Baselines          *hdf5.Dataset
 	BlrBaselines       *hdf5.Dataset
+	PmtValid           *hdf5.Dataset
+	BlrValid           *hdf5.Dataset
+	SipmValid          *hdf5.Dataset
+	TriggerValid       *hdf5.Dataset
+	ExtTrgValid        *hdf5.Dataset
+	PmtSumValid        *hdf5.Dataset
+	Desync             *hdf5.Dataset
 	EvtCounter         int
 }
 
 const N_TRG_CH = 48
 
+func init() {
+	decoder.RegisterOutputFormat(decoder.OutputFormat{
+		Name:      "hdf5",
+		Extension: ".h5",
+		Open: func(filename string) (decoder.EventWriter, error) {
+			writer, err := NewWriter(filename)
+			if err != nil {
+				return nil, err
+			}
+			return writer, nil
+		},
+	})
+}
+
 func NewWriter(filename string) (*Writer, error) {
 	// Set string size for HDF5
 	hdf5.SetStringLength(STRLEN)
 
 	// So far we are not using Blosc
-	if configuration.UseBlosc {
+	if decoder.GetConfiguration().UseBlosc {
 		blosc_version, blosc_date, err := hdf5.RegisterBlosc()
 		_ = blosc_version
 		_ = blosc_date
-		//fmt.Println("Blosc version: ", blosc_version, " date: ", blosc_date)
 		if err != nil {
-			logger.Error(err.Error())
+			decoder.ModuleLogger("writer").Error("Error registering Blosc", "error", err)
 		}
 	}
 
@@ -154,7 +175,10 @@ func sortSensorsByElecID(sensors map[uint16][]int16) []SensorMappingHDF5 {
 	return sorted
 }
 
-func (w *Writer) WriteEvent(event *EventType) {
+func (w *Writer) WriteEvent(event *decoder.EventType) {
+	configuration := decoder.GetConfiguration()
+	sensorsMap := decoder.GetSensorsMap()
+
 	// Write event data
 	evtTimestamp := EventDataHDF5{
 		timestamp:  event.Timestamp,
@@ -241,6 +265,33 @@ func (w *Writer) WriteEvent(event *EventType) {
 			w.BlrBaselines = create2dArray(w.RDGroup, "blr_baselines", nPmts)
 		}
 
+		// Channels coming from broken FECs are flagged when keeping partial events
+		if configuration.KeepPartial {
+			if nPmts > 0 {
+				w.PmtValid = create2dArray(w.RDGroup, "pmt_valid", nPmts)
+			}
+			if len(event.BlrWaveforms) > 0 {
+				w.BlrValid = create2dArray(w.RDGroup, "blr_valid", nPmts)
+			}
+			if nSipms > 0 {
+				w.SipmValid = create2dArray(w.RDGroup, "sipm_valid", nSipms)
+			}
+			if event.ExtTrgWaveform != nil {
+				w.ExtTrgValid = create2dArray(w.RDGroup, "ext_pmt_valid", 1)
+			}
+			if event.PmtSumWaveform != nil {
+				w.PmtSumValid = create2dArray(w.RDGroup, "pmt_sum_valid", 1)
+			}
+			if configuration.ReadTrigger {
+				w.TriggerValid = create2dArray(w.RunGroup, "trigger_valid", 1)
+			}
+		}
+
+		// Events whose FECs are out of sync are flagged, even when kept
+		if configuration.CheckFecSync {
+			w.Desync = create2dArray(w.RunGroup, "desync", 1)
+		}
+
 		w.FirstEvt = true
 	}
 
@@ -262,14 +313,35 @@ func (w *Writer) WriteEvent(event *EventType) {
 	if nSipms > 0 {
 		writeWaveforms(w.SipmWaveforms, event.SipmWaveforms, sipmSorted, w.EvtCounter, nSipms, sipmSamples)
 	}
+	if w.PmtValid != nil {
+		writeValidity(w.PmtValid, event.PmtWaveforms, event.InvalidChannels, pmtSorted, w.EvtCounter)
+	}
+	if w.BlrValid != nil {
+		writeValidity(w.BlrValid, event.BlrWaveforms, event.InvalidBlrChannels, pmtSorted, w.EvtCounter)
+	}
+	if w.SipmValid != nil {
+		writeValidity(w.SipmValid, event.SipmWaveforms, event.InvalidChannels, sipmSorted, w.EvtCounter)
+	}
+	if w.TriggerValid != nil {
+		writeFlag(w.TriggerValid, !event.InvalidTrigger, w.EvtCounter)
+	}
+	if w.Desync != nil {
+		writeFlag(w.Desync, event.Desync, w.EvtCounter)
+	}
 	if event.ExtTrgWaveform != nil {
 		writeSingleWaveform(w.ExtTrgWaveform, event.ExtTrgWaveform, w.EvtCounter)
 	}
+	if w.ExtTrgValid != nil {
+		writeFlag(w.ExtTrgValid, event.ExtTrgWaveform != nil && !event.InvalidExtTrg, w.EvtCounter)
+	}
 	if event.PmtSumWaveform != nil {
 		writeSingleWaveform(w.PmtSumWaveform, event.PmtSumWaveform, w.EvtCounter)
 		pmtSumBaseline := []int16{int16(event.PmtSumBaseline)}
 		writeSingleWaveform(w.PmtSumBaseline, &pmtSumBaseline, w.EvtCounter)
 	}
+	if w.PmtSumValid != nil {
+		writeFlag(w.PmtSumValid, event.PmtSumWaveform != nil && !event.InvalidPmtSum, w.EvtCounter)
+	}
 
 	if configuration.NoDB {
 		writeTriggerChannelsNoDB(w.TriggerChannels, event.TriggerConfig.TrgChannels, nTrgChs, w.EvtCounter)
@@ -291,10 +363,10 @@ func writeTriggerChannels(dset *hdf5.Dataset, channels []uint16, nTrgChs int,
 			if sensorCorrected < uint16(nTrgChs) {
 				trgChannels[sensorCorrected] = 1
 			} else {
-				fmt.Println("Trigger channel out of range: ", elecid, sensor)
+				decoder.ModuleLogger("writer").Warn("Trigger channel out of range", "elecid", elecid, "sensor", sensor)
 			}
 		} else {
-			fmt.Println("Trigger channel not found in mapping: ", elecid, sensor)
+			decoder.ModuleLogger("writer").Warn("Trigger channel not found in mapping", "elecid", elecid)
 		}
 	}
 	write2dArray(dset, &trgChannels, evtCounter, nTrgChs)
@@ -312,7 +384,7 @@ func writeTriggerChannelsNoDB(dset *hdf5.Dataset, channels []uint16, nTrgChs int
 		if sensor < uint16(nTrgChs) {
 			trgChannels[sensor] = 1
 		} else {
-			fmt.Println("Trigger channel out of range: ", sensor)
+			decoder.ModuleLogger("writer").Warn("Trigger channel out of range", "elecid", elecid, "sensor", sensor)
 		}
 	}
 	write2dArray(dset, &trgChannels, evtCounter, nTrgChs)
@@ -357,6 +429,30 @@ func writeBaselines(dset *hdf5.Dataset, baselines map[uint16]uint16,
 	write2dArray(dset, &data, evtCounter, nSensors)
 }
 
+// A channel is valid (1) if it has data and it does not come from a broken
+// FEC, otherwise it is 0
+func writeValidity(dset *hdf5.Dataset, waveforms map[uint16][]int16, invalid map[uint16]bool,
+	order []SensorMappingHDF5, evtCounter int) {
+	nSensors := len(order)
+	data := make([]int16, nSensors)
+	for i, sensor := range order {
+		elecID := uint16(sensor.channel)
+		if _, ok := waveforms[elecID]; ok && !invalid[elecID] {
+			data[i] = 1
+		}
+	}
+	write2dArray(dset, &data, evtCounter, nSensors)
+}
+
+// Per event flag, 1 when set
+func writeFlag(dset *hdf5.Dataset, flag bool, evtCounter int) {
+	data := []int16{0}
+	if flag {
+		data[0] = 1
+	}
+	write2dArray(dset, &data, evtCounter, 1)
+}
+
 func (w *Writer) Close() error {
 	var errs []error
 
@@ -410,6 +506,41 @@ func (w *Writer) Close() error {
 			errs = append(errs, fmt.Errorf("error closing BLR baselines: %w", err))
 		}
 	}
+	if w.PmtValid != nil {
+		if err := w.PmtValid.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("error closing PMT validity mask: %w", err))
+		}
+	}
+	if w.BlrValid != nil {
+		if err := w.BlrValid.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("error closing BLR validity mask: %w", err))
+		}
+	}
+	if w.SipmValid != nil {
+		if err := w.SipmValid.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("error closing SiPM validity mask: %w", err))
+		}
+	}
+	if w.TriggerValid != nil {
+		if err := w.TriggerValid.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("error closing trigger validity flags: %w", err))
+		}
+	}
+	if w.ExtTrgValid != nil {
+		if err := w.ExtTrgValid.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("error closing external trigger validity flags: %w", err))
+		}
+	}
+	if w.PmtSumValid != nil {
+		if err := w.PmtSumValid.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("error closing PMT sum validity flags: %w", err))
+		}
+	}
+	if w.Desync != nil {
+		if err := w.Desync.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("error closing desync flags: %w", err))
+		}
+	}
 	if w.PmtMappingTable != nil {
 		if err := w.PmtMappingTable.Close(); err != nil {
 			errs = append(errs, fmt.Errorf("error closing PMT mapping table: %w", err))
@@ -472,7 +603,7 @@ func (w *Writer) Close() error {
 	return nil
 }
 
-func (w *Writer) writeTriggerConfiguration(params TriggerData) {
+func (w *Writer) writeTriggerConfiguration(params decoder.TriggerData) {
 	t := reflect.TypeOf(params)
 	n := t.NumField()
 	entries := make([]TriggerParamsHDF5, n)
@@ -504,19 +635,3 @@ func (w *Writer) writeTriggerConfiguration(params TriggerData) {
 	toWrite := entries[:fieldsToWrite]
 	writeArrayToTable(w.TriggerParamsTable, &toWrite, w.EvtCounter)
 }
-
-func ProcessDecodedEvent(event EventType, configuration Configuration,
-	writer *Writer, writer2 *Writer) {
-	if configuration.WriteData && !event.Error {
-		if configuration.SplitTrg {
-			switch int(event.TriggerType) {
-			case configuration.TrgCode1:
-				writer.WriteEvent(&event)
-			case configuration.TrgCode2:
-				writer2.WriteEvent(&event)
-			}
-		} else {
-			writer.WriteEvent(&event)
-		}
-	}
-}
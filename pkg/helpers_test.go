@@ -0,0 +1,99 @@
+package decoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"unsafe"
+)
+
+func testConfiguration() Configuration {
+	return Configuration{
+		WriteData:        true,
+		NoDB:             true,
+		ExtTrigger:       15,
+		PmtSumCh:         -1,
+		ReadPMTs:         true,
+		ReadSiPMs:        true,
+		ReadTrigger:      true,
+		Discard:          true,
+		CompressionLevel: 4,
+		OutputFormat:     "hdf5",
+		ArrowCompression: "zstd",
+		CheckFecSync:     true,
+		DiscardDesync:    true,
+		CheckWordCount:   true,
+	}
+}
+
+func setupTestConfiguration() {
+	SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	SetConfiguration(testConfiguration())
+	huffmanCodesPmts = DefaultHuffmanTable().Tree()
+	huffmanCodesSipms = DefaultHuffmanTable().Tree()
+}
+
+func generateEvent(config GeneratorConfig) GeneratedEvent {
+	generator, err := NewGenerator(config)
+	if err != nil {
+		panic(err)
+	}
+	return generator.NextEvent()
+}
+
+// Start and end of the payloads of all the equipments in a DATE event
+func equipmentBounds(data []byte) [][2]int {
+	var header EventHeaderStruct
+	var eqHeader EquipmentHeaderStruct
+	headerSize := int(unsafe.Sizeof(header))
+	eqHeaderSize := int(unsafe.Sizeof(eqHeader))
+
+	bounds := make([][2]int, 0)
+	position := headerSize
+	for position < len(data) {
+		binary.Read(bytes.NewReader(data[position:]), binary.LittleEndian, &header)
+		ldcEnd := position + int(header.EventSize)
+		position += int(header.EventHeadSize)
+		for position < ldcEnd {
+			binary.Read(bytes.NewReader(data[position:]), binary.LittleEndian, &eqHeader)
+			end := position + int(eqHeader.EquipmentSize)
+			bounds = append(bounds, [2]int{position + eqHeaderSize, end})
+			position = end
+		}
+	}
+	return bounds
+}
+
+// Payloads of all the equipments in a DATE event, after flipping the words
+func fecPayloads(data []byte) [][]uint16 {
+	payloads := make([][]uint16, 0)
+	for _, bounds := range equipmentBounds(data) {
+		payload, _ := flipWords(data[bounds[0]:bounds[1]])
+		payloads = append(payloads, payload)
+	}
+	return payloads
+}
+
+// Changes a word of the common header of an equipment, given its position
+// after flipping the words
+func setHeaderWord(data []byte, equipment int, word int, value uint16) {
+	start := equipmentBounds(data)[equipment][0]
+	binary.LittleEndian.PutUint16(data[start+2*(word^1):], value)
+}
+
+func wordsToBytes(words []uint16) []byte {
+	data := make([]byte, 2*len(words))
+	for i, w := range words {
+		binary.LittleEndian.PutUint16(data[2*i:], w)
+	}
+	return data
+}
+
+func bytesToWords(data []byte) []uint16 {
+	words := make([]uint16, len(data)/2)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint16(data[2*i:])
+	}
+	return words
+}
@@ -2,6 +2,9 @@ package decoder
 
 import "fmt"
 
+// Value of the code that precedes an uncompressed 12-bit sample
+const HUFFMAN_CONTROL_CODE int32 = 123456
+
 type HuffmanNode struct {
 	NextNodes [2]*HuffmanNode
 	Value     int32
@@ -40,14 +43,20 @@ func printfHuffman(huffman *HuffmanNode, code int) {
 }
 
 // start_bit will be modified to set the new position
-func decode_compressed_value(previous_value int32, data uint32, control_code int32, start_bit *int, huffman *HuffmanNode) int32 {
+func decode_compressed_value(previous_value int32, data uint32, control_code int32, start_bit *int, huffman *HuffmanNode) (int32, error) {
 	// Check data type (0 uncompressed, 1 huffman)
 	current_bit := *start_bit
 
 	var wfvalue int32
-	current_bit = decode_huffman(huffman, data, current_bit, &wfvalue)
+	current_bit, err := decode_huffman(huffman, data, current_bit, &wfvalue)
+	if err != nil {
+		return 0, err
+	}
 
 	if wfvalue == control_code {
+		if current_bit < 11 {
+			return 0, &ErrHuffmanCode{Code: data, Position: current_bit}
+		}
 		wfvalue = (int32(data) >> (current_bit - 11)) & 0x0FFF
 		current_bit -= 12
 	} else {
@@ -55,18 +64,26 @@ func decode_compressed_value(previous_value int32, data uint32, control_code int
 	}
 	*start_bit = current_bit
 
-	return wfvalue
+	return wfvalue, nil
 }
 
-func decode_huffman(huffman *HuffmanNode, code uint32, position int, result *int32) int {
-	bit := (code >> position) & 0x01
-
-	final_pos := position
-
-	if (huffman.NextNodes[0] == nil) && (huffman.NextNodes[1] == nil) {
-		*result = huffman.Value
-	} else {
-		final_pos = decode_huffman(huffman.NextNodes[bit], code, position-1, result)
+// Walks the tree from the root until a leaf is found, returns the position
+// of the first bit after the code
+func decode_huffman(huffman *HuffmanNode, code uint32, position int, result *int32) (int, error) {
+	node := huffman
+	for node != nil && ((node.NextNodes[0] != nil) || (node.NextNodes[1] != nil)) {
+		if position < 0 {
+			return position, &ErrHuffmanCode{Code: code, Position: position}
+		}
+		bit := (code >> position) & 0x01
+		node = node.NextNodes[bit]
+		position--
 	}
-	return final_pos
+	// There is no code for this sequence of bits or no codes at all
+	if node == nil || node == huffman {
+		return position, &ErrHuffmanCode{Code: code, Position: position}
+	}
+
+	*result = node.Value
+	return position, nil
 }
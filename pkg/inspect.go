@@ -0,0 +1,153 @@
+package decoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"unsafe"
+)
+
+// Structure of a raw event, with the headers of every level and the NEXT
+// common header of every FEC. Used to debug raw files, nothing is decoded
+// beyond the headers.
+type EventStructure struct {
+	Header EventHeaderStruct
+	Ldcs   []LdcStructure
+}
+
+type LdcStructure struct {
+	Header     EventHeaderStruct
+	Equipments []EquipmentStructure
+}
+
+type EquipmentStructure struct {
+	Header EquipmentHeaderStruct
+	Format EventFormat
+	// Error reading the common header, empty if it was read
+	FormatError string `json:",omitempty"`
+	// Sequence counters removed from the payload
+	SeqCounters []uint32
+	// Flipped payload, including the common header
+	Payload []uint16 `json:"-"`
+}
+
+// Reads the headers of an event. The structure read until an error is found
+// is returned with it.
+func ReadEventStructure(eventData []byte, header EventHeaderStruct) (EventStructure, error) {
+	return readEventStructure(bytes.NewReader(eventData), len(eventData), header, false)
+}
+
+// Same as ReadEventStructure, reading from a file positioned after the DATE
+// header. Only the headers are read, the rest of the payload is skipped, so
+// the Payload of the equipments has only the common header and there are no
+// SeqCounters. The file is left at the end of the event, even after an error.
+func ReadEventHeaders(file io.ReadSeeker, header EventHeaderStruct) (EventStructure, error) {
+	size := int(header.EventSize) - int(unsafe.Sizeof(header))
+	if size < 0 {
+		return EventStructure{Header: header}, &ErrEventSize{Size: uint32(header.EventSize), HeaderSize: int(unsafe.Sizeof(header))}
+	}
+	start, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return EventStructure{Header: header}, err
+	}
+	defer file.Seek(start+int64(size), io.SeekStart)
+	return readEventStructure(file, size, header, true)
+}
+
+func readEventStructure(reader io.ReadSeeker, size int, header EventHeaderStruct,
+	headersOnly bool) (EventStructure, error) {
+	structure := EventStructure{Header: header, Ldcs: make([]LdcStructure, 0)}
+	headerSize := int(unsafe.Sizeof(header))
+	start, err := reader.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return structure, err
+	}
+	// length bytes at position, counted from the start of the payload
+	read := func(position int, length int) ([]byte, error) {
+		if _, err := reader.Seek(start+int64(position), io.SeekStart); err != nil {
+			return nil, err
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		return data, nil
+	}
+
+	position := 0
+	for position < size {
+		if position+headerSize > size {
+			return structure, &ErrOutOfBounds{What: "LDC header end", Index: position + headerSize, Length: size}
+		}
+		data, err := read(position, headerSize)
+		if err != nil {
+			return structure, err
+		}
+		ldc := LdcStructure{Equipments: make([]EquipmentStructure, 0)}
+		binary.Read(bytes.NewReader(data), binary.LittleEndian, &ldc.Header)
+		if int(ldc.Header.EventHeadSize) < headerSize || ldc.Header.EventSize < EventSizeType(ldc.Header.EventHeadSize) {
+			return structure, &ErrEventSize{Size: uint32(ldc.Header.EventSize), HeaderSize: int(ldc.Header.EventHeadSize)}
+		}
+		ldcEnd := position + int(ldc.Header.EventSize)
+		if ldcEnd > size {
+			return structure, &ErrOutOfBounds{What: "LDC end", Index: ldcEnd, Length: size}
+		}
+		err = readEquipmentStructures(read, position+int(ldc.Header.EventHeadSize), ldcEnd, &ldc, headersOnly)
+		structure.Ldcs = append(structure.Ldcs, ldc)
+		if err != nil {
+			return structure, err
+		}
+		position = ldcEnd
+	}
+	return structure, nil
+}
+
+// Equipments between ldcStart and ldcEnd. Positions in the errors are
+// counted from ldcStart.
+func readEquipmentStructures(read func(int, int) ([]byte, error), ldcStart int, ldcEnd int,
+	ldc *LdcStructure, headersOnly bool) error {
+	var eqHeader EquipmentHeaderStruct
+	eqHeaderSize := int(unsafe.Sizeof(eqHeader))
+	ldcSize := ldcEnd - ldcStart
+
+	position := 0
+	for position < ldcSize {
+		if position+eqHeaderSize > ldcSize {
+			return &ErrOutOfBounds{What: "equipment header end", Index: position + eqHeaderSize, Length: ldcSize}
+		}
+		data, err := read(ldcStart+position, eqHeaderSize)
+		if err != nil {
+			return err
+		}
+		equipment := EquipmentStructure{}
+		binary.Read(bytes.NewReader(data), binary.LittleEndian, &equipment.Header)
+		end := position + int(equipment.Header.EquipmentSize)
+		if int(equipment.Header.EquipmentSize) < eqHeaderSize {
+			return &ErrEventSize{Size: uint32(equipment.Header.EquipmentSize), HeaderSize: eqHeaderSize}
+		}
+		if end > ldcSize {
+			return &ErrOutOfBounds{What: "equipment end", Index: end, Length: ldcSize}
+		}
+		payloadEnd := end
+		if headersOnly {
+			payloadEnd = min(end, position+eqHeaderSize+2*COMMON_HEADER_WORDS)
+		}
+		data, err = read(ldcStart+position+eqHeaderSize, payloadEnd-position-eqHeaderSize)
+		if err != nil {
+			return err
+		}
+		equipment.Payload, equipment.SeqCounters = flipWords(data)
+		format, err := ReadCommonHeader(equipment.Payload)
+		equipment.Format = format
+		if err != nil {
+			equipment.FormatError = err.Error()
+		}
+		ldc.Equipments = append(ldc.Equipments, equipment)
+		position = end
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package decoder
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+func TestReadEventHeaders(t *testing.T) {
+	setupTestConfiguration()
+	generator, err := NewGenerator(DefaultGeneratorConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer := new(bytes.Buffer)
+	if err := generator.WriteEvents(buffer, 2); err != nil {
+		t.Fatal(err)
+	}
+	data := buffer.Bytes()
+
+	header, eventData, err := ReadEvent(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ReadEventStructure(eventData, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the headers are read and the file is left at the next event
+	file := bytes.NewReader(data)
+	file.Seek(int64(unsafe.Sizeof(header)), io.SeekStart)
+	structure, err := ReadEventHeaders(file, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if position, _ := file.Seek(0, io.SeekCurrent); position != int64(header.EventSize) {
+		t.Fatalf("file left at %d, expected %d", position, header.EventSize)
+	}
+	if len(structure.Ldcs) != len(expected.Ldcs) {
+		t.Fatalf("got %d LDCs, expected %d", len(structure.Ldcs), len(expected.Ldcs))
+	}
+	for i, ldc := range structure.Ldcs {
+		if ldc.Header != expected.Ldcs[i].Header || len(ldc.Equipments) != len(expected.Ldcs[i].Equipments) {
+			t.Fatalf("LDC %d differs", i)
+		}
+		for j, equipment := range ldc.Equipments {
+			if !reflect.DeepEqual(equipment.Format, expected.Ldcs[i].Equipments[j].Format) {
+				t.Fatalf("LDC %d, equipment %d: got %+v, expected %+v",
+					i, j, equipment.Format, expected.Ldcs[i].Equipments[j].Format)
+			}
+		}
+	}
+
+	// A truncated event is an error
+	file = bytes.NewReader(data[:header.EventSize/2])
+	file.Seek(int64(unsafe.Sizeof(header)), io.SeekStart)
+	if _, err := ReadEventHeaders(file, header); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected an unexpected EOF, got %v", err)
+	}
+}
@@ -1,12 +1,117 @@
 package decoder
 
-type Logger interface {
-	Info(message string, module string)
-	Error(string)
-}
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// Below debug, the contents of the NEXT headers and of every sample
+const LevelTrace = slog.LevelDebug - 4
 
-var logger Logger
+var logger = slog.New(slog.NewTextHandler(io.Discard, nil))
 
-func SetLogger(l Logger) {
+// Loggers with the module attribute, created once per module
+var moduleLoggers = &sync.Map{}
+
+func SetLogger(l *slog.Logger) {
 	logger = l
+	moduleLoggers = &sync.Map{}
+}
+
+// Logger of a module of the decoder. Its records carry the module name,
+// used by LevelHandler to set the level of each module.
+func ModuleLogger(module string) *slog.Logger {
+	if l, found := moduleLoggers.Load(module); found {
+		return l.(*slog.Logger)
+	}
+	l, _ := moduleLoggers.LoadOrStore(module, logger.With(slog.String("module", module)))
+	return l.(*slog.Logger)
+}
+
+// Used in the hot paths to build the log arguments only when needed
+func logEnabled(l *slog.Logger, level slog.Level) bool {
+	return l.Enabled(context.Background(), level)
+}
+
+// Parses trace, debug, info, warn or error
+func ParseLogLevel(name string) (slog.Level, error) {
+	if strings.ToLower(name) == "trace" {
+		return LevelTrace, nil
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return level, fmt.Errorf("unknown log level %q, use trace, debug, info, warn or error", name)
+	}
+	return level, nil
+}
+
+func LogLevelName(level slog.Level) string {
+	if level == LevelTrace {
+		return "TRACE"
+	}
+	return level.String()
+}
+
+// Parses the per module levels, as in "sipms=debug,database=trace"
+func ParseModuleLevels(text string) (map[string]slog.Level, error) {
+	levels := make(map[string]slog.Level)
+	for _, item := range strings.Split(text, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		module, name, found := strings.Cut(item, "=")
+		if !found || module == "" {
+			return nil, fmt.Errorf("invalid module level %q, use module=level", item)
+		}
+		level, err := ParseLogLevel(name)
+		if err != nil {
+			return nil, fmt.Errorf("module %s: %w", module, err)
+		}
+		levels[module] = level
+	}
+	return levels, nil
+}
+
+// Filters the records by level, with a different level for the modules
+// given. The module is taken from the attributes of the logger, as set
+// by moduleLogger.
+type LevelHandler struct {
+	handler slog.Handler
+	level   slog.Level
+	modules map[string]slog.Level
+}
+
+// handler must accept every level, the filtering is done here
+func NewLevelHandler(handler slog.Handler, level slog.Level, modules map[string]slog.Level) *LevelHandler {
+	return &LevelHandler{handler: handler, level: level, modules: modules}
+}
+
+func (h *LevelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *LevelHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.handler.Handle(ctx, r)
+}
+
+func (h *LevelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	level := h.level
+	for _, attr := range attrs {
+		if attr.Key != "module" {
+			continue
+		}
+		if moduleLevel, found := h.modules[attr.Value.String()]; found {
+			level = moduleLevel
+		}
+	}
+	return &LevelHandler{handler: h.handler.WithAttrs(attrs), level: level, modules: h.modules}
+}
+
+func (h *LevelHandler) WithGroup(name string) slog.Handler {
+	return &LevelHandler{handler: h.handler.WithGroup(name), level: h.level, modules: h.modules}
 }
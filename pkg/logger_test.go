@@ -0,0 +1,65 @@
+package decoder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestModuleLevels(t *testing.T) {
+	modules, err := ParseModuleLevels("sipms=debug, database=trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var output bytes.Buffer
+	handler := slog.NewJSONHandler(&output, &slog.HandlerOptions{Level: LevelTrace})
+	SetLogger(slog.New(NewLevelHandler(handler, slog.LevelInfo, modules)))
+	defer SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	ModuleLogger("sipms").Debug("Empty FEB", "fec", 2)
+	ModuleLogger("pmts").Debug("Channel mask")
+	ModuleLogger("database").Log(context.Background(), LevelTrace, "Query")
+	ModuleLogger("pmts").Info("Connected")
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	messages := make([]string, 0)
+	for _, line := range lines {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		messages = append(messages, record["module"].(string)+": "+record["msg"].(string))
+	}
+	expected := "sipms: Empty FEB, database: Query, pmts: Connected"
+	if strings.Join(messages, ", ") != expected {
+		t.Fatalf("expected %s, got %s", expected, strings.Join(messages, ", "))
+	}
+
+	if _, err := ParseModuleLevels("sipms=loud"); err == nil {
+		t.Fatal("expected an error for an unknown level")
+	}
+}
+
+func TestConfigurationLevel(t *testing.T) {
+	for _, test := range []struct {
+		verbosity int
+		logLevel  string
+		expected  slog.Level
+	}{
+		{0, "", slog.LevelInfo},
+		{1, "", slog.LevelDebug},
+		{3, "", LevelTrace},
+		{3, "warn", slog.LevelWarn},
+		{0, "TRACE", LevelTrace},
+	} {
+		config := Configuration{Verbosity: test.verbosity, LogLevel: test.logLevel}
+		if level := config.Level(); level != test.expected {
+			t.Errorf("verbosity %d, log level %q: expected %v, got %v",
+				test.verbosity, test.logLevel, test.expected, level)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package decoder
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Counters of the decoder, exposed in the Prometheus text format by
+// Metrics.Registry. The CLI counts what is read, pkg what is decoded and
+// written.
+type DecoderMetrics struct {
+	Registry        *MetricsRegistry
+	EventsRead      *Counter
+	BytesRead       *Counter
+	EventsDecoded   *Counter
+	EventsWritten   *Counter
+	EventsDiscarded *Counter
+	DecodeSeconds   *Histogram
+	WriteSeconds    *Histogram
+	FecErrorBits    *Counter
+	FtMismatches    *Counter
+	FecDesyncs      *Counter
+	FecDecodeErrors *Counter
+}
+
+var Metrics = NewDecoderMetrics()
+
+func NewDecoderMetrics() *DecoderMetrics {
+	registry := NewMetricsRegistry()
+	// From 100 us to 1.6 s
+	latencyBuckets := ExponentialBuckets(1e-4, 2, 15)
+	return &DecoderMetrics{
+		Registry:        registry,
+		EventsRead:      registry.NewCounter("decoder_events_read_total", "Valid DATE events read"),
+		BytesRead:       registry.NewCounter("decoder_bytes_read_total", "Bytes of the DATE events read"),
+		EventsDecoded:   registry.NewCounter("decoder_events_decoded_total", "Events decoded"),
+		EventsWritten:   registry.NewCounter("decoder_events_written_total", "Events written to an output file"),
+		EventsDiscarded: registry.NewCounter("decoder_events_discarded_total", "Events decoded but not written", "reason"),
+		DecodeSeconds:   registry.NewHistogram("decoder_decode_seconds", "Time decoding an event", latencyBuckets),
+		WriteSeconds:    registry.NewHistogram("decoder_write_seconds", "Time writing an event", latencyBuckets),
+		FecErrorBits:    registry.NewCounter("decoder_fec_error_bits_total", "FECs with the error bit set", "fec"),
+		FtMismatches:    registry.NewCounter("decoder_ft_mismatches_total", "Unexpected FT in the data of a FEC", "fec"),
+		FecDesyncs:      registry.NewCounter("decoder_fec_desyncs_total", "FECs that do not agree with the rest of the event", "fec", "field"),
+		FecDecodeErrors: registry.NewCounter("decoder_fec_decode_errors_total", "FECs whose payload could not be decoded", "fec"),
+	}
+}
+
+func fecLabel(fecID uint16) string {
+	return fmt.Sprintf("0x%02x", fecID)
+}
+
+type metric interface {
+	write(w io.Writer) error
+}
+
+type MetricsRegistry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{}
+}
+
+func (r *MetricsRegistry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+func (r *MetricsRegistry) NewCounter(name string, help string, labels ...string) *Counter {
+	counter := &Counter{metricValues: newMetricValues(name, help, "counter", labels)}
+	r.register(counter)
+	return counter
+}
+
+func (r *MetricsRegistry) NewGauge(name string, help string, labels ...string) *Gauge {
+	gauge := &Gauge{metricValues: newMetricValues(name, help, "gauge", labels)}
+	r.register(gauge)
+	return gauge
+}
+
+// Gauge whose value is read when the metrics are written
+func (r *MetricsRegistry) NewGaugeFunc(name string, help string, value func() float64) {
+	r.register(&gaugeFunc{name: name, help: help, value: value})
+}
+
+func (r *MetricsRegistry) NewHistogram(name string, help string, buckets []float64) *Histogram {
+	histogram := &Histogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets))}
+	r.register(histogram)
+	return histogram
+}
+
+// Writes all the metrics in the Prometheus text format
+func (r *MetricsRegistry) Write(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+	for _, m := range metrics {
+		if err := m.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MetricsRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.Write(w)
+}
+
+// Values of a metric by label values
+type metricValues struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newMetricValues(name string, help string, kind string, labels []string) metricValues {
+	return metricValues{name: name, help: help, kind: kind, labels: labels, values: make(map[string]float64)}
+}
+
+func (m *metricValues) key(labelValues []string) string {
+	if len(labelValues) != len(m.labels) {
+		panic(fmt.Sprintf("metric %s has %d labels, got %d values", m.name, len(m.labels), len(labelValues)))
+	}
+	pairs := make([]string, len(m.labels))
+	for i, label := range m.labels {
+		pairs[i] = fmt.Sprintf("%s=\"%s\"", label, escapeLabelValue(labelValues[i]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m *metricValues) update(labelValues []string, update func(float64) float64) {
+	key := m.key(labelValues)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[key] = update(m.values[key])
+}
+
+// Value for the given label values, 0 if never updated
+func (m *metricValues) Value(labelValues ...string) float64 {
+	key := m.key(labelValues)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.values[key]
+}
+
+// Sum of the values for all the label values
+func (m *metricValues) Total() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	total := 0.0
+	for _, value := range m.values {
+		total += value
+	}
+	return total
+}
+
+func (m *metricValues) write(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind); err != nil {
+		return err
+	}
+	// Metrics without labels are always written, so they can be scraped
+	// before anything happens
+	if len(m.labels) == 0 && len(m.values) == 0 {
+		_, err := fmt.Fprintf(w, "%s 0\n", m.name)
+		return err
+	}
+	keys := make([]string, 0, len(m.values))
+	for key := range m.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name := m.name
+		if key != "" {
+			name += "{" + key + "}"
+		}
+		if _, err := fmt.Fprintf(w, "%s %s\n", name, formatMetricValue(m.values[key])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type Counter struct {
+	metricValues
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		panic(fmt.Sprintf("counter %s cannot decrease", c.name))
+	}
+	c.update(labelValues, func(current float64) float64 { return current + value })
+}
+
+type Gauge struct {
+	metricValues
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.update(labelValues, func(float64) float64 { return value })
+}
+
+type gaugeFunc struct {
+	name  string
+	help  string
+	value func() float64
+}
+
+func (g *gaugeFunc) write(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n",
+		g.name, g.help, g.name, g.name, formatMetricValue(g.value()))
+	return err
+}
+
+// Histogram with cumulative buckets, as Prometheus expects them
+type Histogram struct {
+	name    string
+	help    string
+	buckets []float64
+	mu      sync.Mutex
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+// count buckets starting at start, each factor times the previous one
+func ExponentialBuckets(start float64, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+func (h *Histogram) Observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+func (h *Histogram) ObserveDuration(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+func (h *Histogram) write(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var b strings.Builder
+	fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for i, bound := range h.buckets {
+		fmt.Fprintf(&b, "%s_bucket{le=\"%s\"} %d\n", h.name, formatMetricValue(bound), h.counts[i])
+	}
+	fmt.Fprintf(&b, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(&b, "%s_sum %s\n%s_count %d\n", h.name, formatMetricValue(h.sum), h.name, h.count)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func formatMetricValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return fmt.Sprint(value)
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,74 @@
+package decoder
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMetricsTextFormat(t *testing.T) {
+	registry := NewMetricsRegistry()
+	events := registry.NewCounter("test_events_total", "Events")
+	discarded := registry.NewCounter("test_discarded_total", "Discarded events", "reason")
+	registry.NewGaugeFunc("test_queue", "Queue length", func() float64 { return 3 })
+	latency := registry.NewHistogram("test_seconds", "Latency", []float64{0.1, 1})
+
+	discarded.Inc("error")
+	discarded.Add(2, `a "b"`)
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(5)
+
+	var output strings.Builder
+	if err := registry.Write(&output); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP test_events_total Events
+# TYPE test_events_total counter
+test_events_total 0
+# HELP test_discarded_total Discarded events
+# TYPE test_discarded_total counter
+test_discarded_total{reason="a \"b\""} 2
+test_discarded_total{reason="error"} 1
+# HELP test_queue Queue length
+# TYPE test_queue gauge
+test_queue 3
+# HELP test_seconds Latency
+# TYPE test_seconds histogram
+test_seconds_bucket{le="0.1"} 1
+test_seconds_bucket{le="1"} 2
+test_seconds_bucket{le="+Inf"} 3
+test_seconds_sum 5.55
+test_seconds_count 3
+`
+	if output.String() != expected {
+		t.Fatalf("got:\n%s\nexpected:\n%s", output.String(), expected)
+	}
+	if events.Value() != 0 || discarded.Value("error") != 1 || discarded.Total() != 3 {
+		t.Fatal("wrong counter values")
+	}
+}
+
+func TestMetricsDecoding(t *testing.T) {
+	setupTestConfiguration()
+	Metrics = NewDecoderMetrics()
+	defer func() { Metrics = NewDecoderMetrics() }()
+
+	config := DefaultGeneratorConfig()
+	config.Faults = Faults{ErrorBit: 1}
+	generated := generateEvent(config)
+	event := decodeGenerated(t, generated.Data)
+
+	if Metrics.EventsDecoded.Value() != 1 {
+		t.Fatalf("decoded events: %g", Metrics.EventsDecoded.Value())
+	}
+	errorBits := 0.0
+	for _, fecID := range append(append(config.PmtFecs, config.SipmFecs...), config.TriggerFecs...) {
+		errorBits += Metrics.FecErrorBits.Value(fecLabel(fecID))
+	}
+	if errorBits == 0 {
+		t.Fatal("error bits not counted")
+	}
+	if !event.Error {
+		t.Fatal("event with error bits not flagged")
+	}
+}
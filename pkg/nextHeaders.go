@@ -1,46 +1,125 @@
 package decoder
 
-import "fmt"
+import "context"
 
-func ReadCommonHeader(data []uint16) EventFormat {
-	position := 0
+func ReadCommonHeader(data []uint16) (EventFormat, error) {
+	cursor := NewCursor(data)
 	evtFormat := EventFormat{}
 
-	sequenceCounter, position := readSeqCounter(data, position)
-	if configuration.Verbosity > 2 {
-		message := fmt.Sprintf("Sequence counter: %d", sequenceCounter)
-		logger.Info(message, "nextHeader")
+	evtFormat.SequenceCounter = readSeqCounter(cursor)
+	readFormatID(cursor, &evtFormat)
+	readWordCount(cursor, &evtFormat)
+	readEventID(cursor, &evtFormat)
+	if evtFormat.FWVersion == 10 {
+		readEventConfJuliett(cursor, &evtFormat)
 	}
-
-	if sequenceCounter == 0 {
-		position = readFormatID(data, position, &evtFormat)
-		position = readWordCount(data, position, &evtFormat)
-		position = readEventID(data, position, &evtFormat)
-		if evtFormat.FWVersion == 10 {
-			position = readEventConfJuliett(data, position, &evtFormat)
-		}
-		if evtFormat.FWVersion >= 9 {
-			if evtFormat.Baseline {
-				position = readIndiaBaselines(data, position, &evtFormat)
-			}
-			position = readIndiaFecID(data, position, &evtFormat)
+	if evtFormat.FWVersion >= 9 {
+		if evtFormat.Baseline {
+			readIndiaBaselines(cursor, &evtFormat)
 		}
-		position = readCTandFTh(data, position, &evtFormat)
-		position = readFTl(data, position, &evtFormat)
+		readIndiaFecID(cursor, &evtFormat)
 	}
+	readCTandFTh(cursor, &evtFormat)
+	readFTl(cursor, &evtFormat)
+
+	evtFormat.HeaderSize = uint16(cursor.Position)
+	log := ModuleLogger("nextHeader")
+	if logEnabled(log, LevelTrace) {
+		log.Log(context.Background(), LevelTrace, "NEXT header",
+			"fec", evtFormat.FecID, "sequenceCounter", evtFormat.SequenceCounter,
+			"fecType", evtFormat.FecType, "zeroSuppression", evtFormat.ZeroSuppression,
+			"compressedData", evtFormat.CompressedData, "baseline", evtFormat.Baseline,
+			"dualMode", evtFormat.DualModeBit, "errorBit", evtFormat.ErrorBit,
+			"fwVersion", evtFormat.FWVersion, "wordCount", evtFormat.WordCount,
+			"triggerType", evtFormat.TriggerType, "triggerCounter", evtFormat.TriggerCounter,
+			"bufferSamples", evtFormat.BufferSamples, "preTrigger", evtFormat.PreTrigger,
+			"bufferSamples2", evtFormat.BufferSamples2, "preTrigger2", evtFormat.PreTrigger2,
+			"channelMask", evtFormat.ChannelMask, "baselines", evtFormat.Baselines,
+			"numberOfChannels", evtFormat.NumberOfChannels, "timestamp", evtFormat.Timestamp,
+			"ftBit", evtFormat.FTBit, "triggerFT", evtFormat.TriggerFT)
+	}
+	return evtFormat, cursor.Err()
+
+}
+
+func readSeqCounter(cursor *Cursor) uint32 {
+	high := cursor.Next()
+	low := cursor.Next()
+	sequenceCounter := (uint32(high) << 16) | (uint32(low) & 0x0ffff)
+	return sequenceCounter
+}
 
-	evtFormat.HeaderSize = uint16(position)
-	return evtFormat
+// The DAQ inserts a 32-bit sequence counter every SEQ_COUNTER_PERIOD words.
+// The first one is part of the common header, the following ones are
+// removed by flipWords and must increase by one from it, wrapping around.
+const SEQ_COUNTER_PERIOD = 3996
+
+func checkSequenceCounters(evtFormat *EventFormat, counters []uint32, eventID uint32) []error {
+	errs := make([]error, 0)
+	for i, counter := range counters {
+		expected := evtFormat.SequenceCounter + uint32(i+1)
+		if counter != expected {
+			errs = append(errs, &ErrSeqCounter{
+				EventID:  eventID,
+				FecID:    evtFormat.FecID,
+				Index:    i + 1,
+				Expected: expected,
+				Got:      counter,
+			})
+			// Report only the first gap, the rest would be shifted too
+			break
+		}
+	}
+	return errs
+}
 
+// WordCount is the number of 16-bit words sent by the FEC in this link,
+// common header included and sequence counters excluded. The field is only
+// 16 bits wide, so it wraps around for large buffers. The end of the data is
+// the last position that matches it, anything after it is padding (the
+// FFFF... FAFAFAFA trailer). A WordCount of zero means it was not filled.
+func payloadEnd(evtFormat *EventFormat, nWords int, eventID uint32) (int, error) {
+	wordCount := int(evtFormat.WordCount)
+	if wordCount == 0 {
+		return nWords, nil
+	}
+	if wordCount > nWords || wordCount < int(evtFormat.HeaderSize) {
+		err := &ErrPayloadOverrun{
+			EventID:   eventID,
+			FecID:     evtFormat.FecID,
+			WordCount: evtFormat.WordCount,
+			Available: nWords,
+		}
+		return nWords, err
+	}
+	const wrap = 1 << 16
+	end := wordCount + (nWords-wordCount)/wrap*wrap
+	return end, nil
 }
 
-func readSeqCounter(data []uint16, position int) (uint32, int) {
-	sequenceCounter := (uint32(data[position+1]) & 0x0ffff) + (uint32(data[position+1]) << 16)
-	position += 2
-	return sequenceCounter, position
+// Compressed data is read in 32-bit words, the last one may be only
+// partially used, so a difference of up to two words is allowed.
+func checkConsumedWords(evtFormat *EventFormat, consumed int, available int, eventID uint32) error {
+	if evtFormat.WordCount == 0 {
+		return nil
+	}
+	slack := 0
+	if evtFormat.CompressedData || (evtFormat.FecType == 0 && evtFormat.ZeroSuppression) {
+		slack = 2
+	}
+	if consumed > available || consumed < available-slack {
+		return &ErrWordCountMismatch{
+			EventID:  eventID,
+			FecID:    evtFormat.FecID,
+			Expected: available,
+			Consumed: consumed,
+		}
+	}
+	return nil
 }
 
 type EventFormat struct {
+	SequenceCounter  uint32
 	FecType          uint16
 	ZeroSuppression  bool
 	CompressedData   bool
@@ -75,36 +154,19 @@ type FormatID struct {
 	FWVersion       uint16
 }
 
-func readFormatID(data []uint16, position int, evtFormat *EventFormat) int {
+func readFormatID(cursor *Cursor, evtFormat *EventFormat) {
 	//Format ID H
-	FecType := data[position] & 0x000F
-	ZeroSuppression := (data[position] & 0x0010) >> 4
-	CompressedData := (data[position] & 0x0020) >> 5
-	Baseline := (data[position] & 0x0040) >> 6
-	DualModeBit := (data[position] & 0x0080) >> 7
-	ErrorBit := (data[position] & 0x4000) >> 14
-	position++
+	FecType := cursor.Peek(0) & 0x000F
+	ZeroSuppression := (cursor.Peek(0) & 0x0010) >> 4
+	CompressedData := (cursor.Peek(0) & 0x0020) >> 5
+	Baseline := (cursor.Peek(0) & 0x0040) >> 6
+	DualModeBit := (cursor.Peek(0) & 0x0080) >> 7
+	ErrorBit := (cursor.Peek(0) & 0x4000) >> 14
+	cursor.Skip(1)
 
 	//Format ID L
-	FWVersion := data[position] & 0x0FFFF
-	position++
-
-	if configuration.Verbosity > 2 {
-		message := fmt.Sprintf("FecType: 0x%02x", FecType)
-		logger.Info(message, "nextHeader")
-		message = fmt.Sprintf("Zero Suppression: %d", ZeroSuppression)
-		logger.Info(message, "nextHeader")
-		message = fmt.Sprintf("Compressed Data: %d", CompressedData)
-		logger.Info(message, "nextHeader")
-		message = fmt.Sprintf("Baseline: %d", Baseline)
-		logger.Info(message, "nextHeader")
-		message = fmt.Sprintf("Dual Mode: %d", DualModeBit)
-		logger.Info(message, "nextHeader")
-		message = fmt.Sprintf("Error bit: %d", ErrorBit)
-		logger.Info(message, "nextHeader")
-		message = fmt.Sprintf("FW version: %d", FWVersion)
-		logger.Info(message, "nextHeader")
-	}
+	FWVersion := cursor.Peek(0) & 0x0FFFF
+	cursor.Skip(1)
 
 	evtFormat.FecType = FecType
 	evtFormat.ZeroSuppression = ZeroSuppression > 0
@@ -114,78 +176,51 @@ func readFormatID(data []uint16, position int, evtFormat *EventFormat) int {
 	evtFormat.ErrorBit = ErrorBit > 0
 	evtFormat.FWVersion = FWVersion
 
-	return position
 }
 
-func readWordCount(data []uint16, position int, evtFormat *EventFormat) int {
-	WordCounter := data[position] & 0x0FFFF
-	position++
-	if configuration.Verbosity > 2 {
-		message := fmt.Sprintf("Word count: %d", WordCounter)
-		logger.Info(message, "nextHeader")
-	}
+func readWordCount(cursor *Cursor, evtFormat *EventFormat) {
+	WordCounter := cursor.Peek(0) & 0x0FFFF
+	cursor.Skip(1)
 	evtFormat.WordCount = WordCounter
-	return position
 }
 
-func readEventID(data []uint16, position int, evtFormat *EventFormat) int {
-	TriggerType := data[position] & 0x000F
-	TriggerCounter := (uint32(data[position]&0x0FFF0) << 12) + (uint32(data[position+1]) & 0x0FFFF)
-	position += 2
-	if configuration.Verbosity > 2 {
-		message := fmt.Sprintf("Trigger type: %d", TriggerType)
-		logger.Info(message, "nextHeader")
-		message = fmt.Sprintf("Trigger Counter: %d", TriggerCounter)
-		logger.Info(message, "nextHeader")
-	}
+func readEventID(cursor *Cursor, evtFormat *EventFormat) {
+	TriggerType := cursor.Peek(0) & 0x000F
+	TriggerCounter := (uint32(cursor.Peek(0)&0x0FFF0) << 12) + (uint32(cursor.Peek(1)) & 0x0FFFF)
+	cursor.Skip(2)
 	evtFormat.TriggerType = TriggerType
 	evtFormat.TriggerCounter = TriggerCounter
-	return position
 }
 
-func readEventConfJuliett(data []uint16, position int, evtFormat *EventFormat) int {
+func readEventConfJuliett(cursor *Cursor, evtFormat *EventFormat) {
 	//Event conf0
-	BufferSamples := 2 * uint32(data[position]&0x0FFFF)
-	position++
+	BufferSamples := 2 * uint32(cursor.Peek(0)&0x0FFFF)
+	cursor.Skip(1)
 
 	//Event conf1
-	PreTriggerSamples := 2 * uint32(data[position]&0x0FFFF)
-	position++
+	PreTriggerSamples := 2 * uint32(cursor.Peek(0)&0x0FFFF)
+	cursor.Skip(1)
 
 	//Event conf2
-	BufferSamples2 := 2 * uint32(data[position]&0x0FFFF)
-	position++
+	BufferSamples2 := 2 * uint32(cursor.Peek(0)&0x0FFFF)
+	cursor.Skip(1)
 
 	//Event conf3
-	PreTriggerSamples2 := 2 * uint32(data[position]&0x0FFFF)
-	position++
+	PreTriggerSamples2 := 2 * uint32(cursor.Peek(0)&0x0FFFF)
+	cursor.Skip(1)
 
 	//Event conf4
-	ChannelMask := data[position] & 0x0FFFF
-	position++
+	ChannelMask := cursor.Peek(0) & 0x0FFFF
+	cursor.Skip(1)
 
 	evtFormat.BufferSamples = BufferSamples
 	evtFormat.PreTrigger = PreTriggerSamples
 	evtFormat.BufferSamples2 = BufferSamples2
 	evtFormat.PreTrigger2 = PreTriggerSamples2
 	evtFormat.ChannelMask = ChannelMask
-
-	if configuration.Verbosity > 2 {
-		message := fmt.Sprintf("Buffer samples: %d", BufferSamples)
-		logger.Info(message, "nextHeader")
-		message = fmt.Sprintf("Pretrigger samples: %d", PreTriggerSamples)
-		logger.Info(message, "nextHeader")
-		message = fmt.Sprintf("Buffer 2 samples: %d", BufferSamples2)
-		logger.Info(message, "nextHeader")
-		message = fmt.Sprintf("Pretrigger 2 samples: %d", PreTriggerSamples2)
-		logger.Info(message, "nextHeader")
-		message = fmt.Sprintf("Channel mask: 0x%04x", ChannelMask)
-		logger.Info(message, "nextHeader")
-	}
-	return position
 }
 
-func readIndiaBaselines(data []uint16, position int, evtFormat *EventFormat) int {
+func readIndiaBaselines(cursor *Cursor, evtFormat *EventFormat) {
 	// Baselines
 	// Pattern goes like this:
 	// 0xFFF0, 0x000F, 12 bits,  4 bits; ch0, ch1
@@ -197,103 +232,76 @@ func readIndiaBaselines(data []uint16, position int, evtFormat *EventFormat) int
 	baselines := make([]uint16, 0)
 
 	//Baseline ch0
-	baselineTemp = (data[position] & 0xFFF0) >> 4
+	baselineTemp = (cursor.Peek(0) & 0xFFF0) >> 4
 	baselines = append(baselines, baselineTemp)
 
 	//Baseline ch1
-	baselineTemp = (data[position] & 0x000F) << 8
-	position++
-	baselineTemp = baselineTemp + ((data[position] & 0xFF00) >> 8)
+	baselineTemp = (cursor.Peek(0) & 0x000F) << 8
+	cursor.Skip(1)
+	baselineTemp = baselineTemp + ((cursor.Peek(0) & 0xFF00) >> 8)
 	baselines = append(baselines, baselineTemp)
 
 	//Baseline ch2
-	baselineTemp = (data[position] & 0x00FF) << 4
-	position++
-	baselineTemp = baselineTemp + ((data[position] & 0xF000) >> 12)
+	baselineTemp = (cursor.Peek(0) & 0x00FF) << 4
+	cursor.Skip(1)
+	baselineTemp = baselineTemp + ((cursor.Peek(0) & 0xF000) >> 12)
 	baselines = append(baselines, baselineTemp)
 
 	//Baseline ch3
-	baselineTemp = (data[position] & 0x0FFF)
+	baselineTemp = (cursor.Peek(0) & 0x0FFF)
 	baselines = append(baselines, baselineTemp)
 
 	//Baseline ch4
-	position++
-	baselineTemp = (data[position] & 0xFFF0) >> 4
+	cursor.Skip(1)
+	baselineTemp = (cursor.Peek(0) & 0xFFF0) >> 4
 	baselines = append(baselines, baselineTemp)
-	baselineTemp = (data[position] & 0x000F) << 8
+	baselineTemp = (cursor.Peek(0) & 0x000F) << 8
 
 	//Baseline ch5
-	position++
-	baselineTemp = baselineTemp + ((data[position] & 0xFF00) >> 8)
+	cursor.Skip(1)
+	baselineTemp = baselineTemp + ((cursor.Peek(0) & 0xFF00) >> 8)
 	baselines = append(baselines, baselineTemp)
-	position++
+	cursor.Skip(1)
 
 	evtFormat.Baselines = baselines
-
-	if configuration.Verbosity > 2 {
-		message := fmt.Sprintf("Baselines: %v", baselines)
-		logger.Info(message, "nextHeader")
-	}
-	return position
 }
 
-func readIndiaFecID(data []uint16, position int, evtFormat *EventFormat) int {
-	NumberOfChannels := data[position] & 0x001F
-	FecID := (data[position] & 0x0FFE0) >> 5
-	position++
-
-	if configuration.Verbosity > 2 {
-		message := fmt.Sprintf("Number of channels: %d", NumberOfChannels)
-		logger.Info(message, "nextHeader")
-		message = fmt.Sprintf("FEC ID: %d, 0x%02x", FecID, FecID)
-		logger.Info(message, "nextHeader")
-	}
+func readIndiaFecID(cursor *Cursor, evtFormat *EventFormat) {
+	NumberOfChannels := cursor.Peek(0) & 0x001F
+	FecID := (cursor.Peek(0) & 0x0FFE0) >> 5
+	cursor.Skip(1)
 
 	evtFormat.NumberOfChannels = NumberOfChannels
 	evtFormat.FecID = FecID
-	return position
 }
 
-func readCTandFTh(data []uint16, position int, evtFormat *EventFormat) int {
+func readCTandFTh(cursor *Cursor, evtFormat *EventFormat) {
 	//Timestamp high
 	var Timestamp uint64
-	Timestamp = uint64((data[position] & 0x0FFFF)) << 16
-	position++
+	Timestamp = uint64((cursor.Peek(0) & 0x0FFFF)) << 16
+	cursor.Skip(1)
 
 	//Timestamp Low
-	Timestamp = Timestamp + uint64((data[position] & 0x0ffff))
-	position++
+	Timestamp = Timestamp + uint64((cursor.Peek(0) & 0x0ffff))
+	cursor.Skip(1)
 
 	//FTH & CTms
-	Timestamp = (Timestamp << 10) + uint64((data[position] & 0x03FF))
+	Timestamp = (Timestamp << 10) + uint64((cursor.Peek(0) & 0x03FF))
 	Timestamp = Timestamp & 0x03FFFFFFFFFF
 
 	// We use 32 bits to avoid overflow later
-	FTBit := int32((data[position] & 0x8000) >> 15)
-	position++
-
-	if configuration.Verbosity > 2 {
-		message := fmt.Sprintf("Timestamp: %d", Timestamp)
-		logger.Info(message, "nextHeader")
-		message = fmt.Sprintf("FTBit: %d", FTBit)
-		logger.Info(message, "nextHeader")
-	}
+	FTBit := int32((cursor.Peek(0) & 0x8000) >> 15)
+	cursor.Skip(1)
 
 	evtFormat.Timestamp = Timestamp
 	evtFormat.FTBit = FTBit
 
-	return position
 }
 
-func readFTl(data []uint16, position int, evtFormat *EventFormat) int {
-	TriggerFT := data[position] & 0x0FFFF
-	position++
-	if configuration.Verbosity > 2 {
-		message := fmt.Sprintf("TriggerFT: %04x", TriggerFT)
-		logger.Info(message, "nextHeader")
-	}
+func readFTl(cursor *Cursor, evtFormat *EventFormat) {
+	TriggerFT := cursor.Peek(0) & 0x0FFFF
+	cursor.Skip(1)
 
 	evtFormat.TriggerFT = TriggerFT
 
-	return position
 }
@@ -0,0 +1,53 @@
+package decoder
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// Adds offset to the sequence counters of an equipment, the one in the
+// common header included, as if the buffer did not start at 0
+func shiftSequenceCounters(data []byte, equipment int, offset uint32) {
+	bounds := equipmentBounds(data)[equipment]
+	raw := data[bounds[0]:bounds[1]]
+	for position := 0; position+1 < len(raw)/2; position += 2 {
+		if position > 0 && position%SEQ_COUNTER_PERIOD != 0 {
+			continue
+		}
+		counter := uint32(binary.LittleEndian.Uint16(raw[2*position+2:]))<<16 |
+			uint32(binary.LittleEndian.Uint16(raw[2*position:]))
+		counter += offset
+		binary.LittleEndian.PutUint16(raw[2*position:], uint16(counter))
+		binary.LittleEndian.PutUint16(raw[2*position+2:], uint16(counter>>16))
+	}
+}
+
+func TestSequenceCounters(t *testing.T) {
+	evtFormat := &EventFormat{SequenceCounter: 41}
+	if errs := checkSequenceCounters(evtFormat, []uint32{42, 43}, 1); len(errs) != 0 {
+		t.Fatalf("continuous counters rejected: %v", errs)
+	}
+	if errs := checkSequenceCounters(evtFormat, []uint32{42, 44}, 1); len(errs) != 1 {
+		t.Fatalf("gap not found: %v", errs)
+	}
+	// The counter wraps around
+	evtFormat.SequenceCounter = 0xFFFFFFFF
+	if errs := checkSequenceCounters(evtFormat, []uint32{0, 1}, 1); len(errs) != 0 {
+		t.Fatalf("counters after the wrap rejected: %v", errs)
+	}
+}
+
+// A buffer whose counter does not start at 0 is decoded
+func TestSequenceCountersNonZeroStart(t *testing.T) {
+	setupTestConfiguration()
+	generated := generateEvent(DefaultGeneratorConfig())
+	for equipment := range equipmentBounds(generated.Data) {
+		shiftSequenceCounters(generated.Data, equipment, 1000)
+	}
+	// The PMT FECs are long enough to have counters in the payload
+	bounds := equipmentBounds(generated.Data)[0]
+	if _, counters := flipWords(generated.Data[bounds[0]:bounds[1]]); len(counters) == 0 {
+		t.Fatal("no sequence counters in the payload")
+	}
+	compareGenerated(t, generated, decodeGenerated(t, generated.Data))
+}
@@ -1,11 +1,13 @@
 package decoder
 
 import (
+	"context"
 	"fmt"
 )
 
-func ReadPmtFEC(data []uint16, evtFormat *EventFormat, dateHeader *EventHeaderStruct, event *EventType) {
-	position := 0
+// Returns the number of words consumed from data
+func ReadPmtFEC(data []uint16, evtFormat *EventFormat, dateHeader *EventHeaderStruct, event *EventType) (int, error) {
+	cursor := NewCursor(data)
 	var time int = -1
 	var current_bit int = 31
 
@@ -34,9 +36,6 @@ func ReadPmtFEC(data []uint16, evtFormat *EventFormat, dateHeader *EventHeaderSt
 		writePmtPedestals(evtFormat, channelMask, event.Baselines)
 	}
 
-	//TODO maybe size of payload could be used here to stop, but the size is
-	//2x size per link and there are many FFFF at the end, which are the actual
-	//stop condition...
 	for true {
 		time++
 
@@ -48,29 +47,46 @@ func ReadPmtFEC(data []uint16, evtFormat *EventFormat, dateHeader *EventHeaderSt
 		if Compression {
 			// Skip FTm
 			if time == 0 {
-				position++
+				cursor.Skip(1)
 			}
-			position = decodeChargeIndiaPmtCompressed(data, position, wfPointers,
+			err := decodeChargeIndiaPmtCompressed(cursor, wfPointers,
 				&current_bit, huffmanCodesPmts, chPositions, uint32(time))
+			if err != nil {
+				return cursor.Position, err
+			}
 		} else {
-			var FT int32 = int32(data[position]) & 0x0FFFF
-			position++
+			var FT int32 = int32(cursor.Next()) & 0x0FFFF
+			if err := cursor.Err(); err != nil {
+				return cursor.Position, err
+			}
 
 			//If not ZS check next FT value, if not expected (0xffff) end of data
-			computeNextFThm(&nextFT, &nextFThm, evtFormat)
+			err := computeNextFThm(&nextFT, &nextFThm, evtFormat)
+			if err != nil {
+				return cursor.Position, err
+			}
 			if FT != (nextFThm & 0x0FFFF) {
 				// Check with run 13868 DEMO.
-				errMessage := fmt.Errorf("evt %d, fecID: %d, nextFThm != FT: 0x%04x, 0x%04x",
-					EventIdGetNbInRun(dateHeader.EventId), fFecId, (nextFThm & 0x0ffff), FT)
-				logger.Error(errMessage.Error())
+				ModuleLogger("pmts").Error("nextFThm != FT", "nextFThm", nextFThm&0x0ffff, "ft", FT,
+					"run", dateHeader.EventRunNb, "event", EventIdGetNbInRun(dateHeader.EventId), "fec", fFecId)
+				Metrics.FtMismatches.Inc(fecLabel(fFecId))
 				break
 			}
-			position = decodeCharge(data, position, wfPointers, chPositions, uint32(time))
+			err = decodeCharge(cursor, wfPointers, chPositions, uint32(time))
+			if err != nil {
+				return cursor.Position, err
+			}
 		}
 	}
+
+	if Compression {
+		// The last 32-bit word may be partially used
+		return cursor.Position + 1, nil
+	}
+	return cursor.Position, nil
 }
 
-func computeNextFThm(nextFT *int32, nextFThm *int32, evtFormat *EventFormat) {
+func computeNextFThm(nextFT *int32, nextFThm *int32, evtFormat *EventFormat) error {
 	PreTrgSamples := int32(evtFormat.PreTrigger)
 	BufferSamples := int32(evtFormat.BufferSamples)
 	if evtFormat.FWVersion == 10 {
@@ -82,6 +98,10 @@ func computeNextFThm(nextFT *int32, nextFThm *int32, evtFormat *EventFormat) {
 	FTBit := evtFormat.FTBit
 	TriggerFT := evtFormat.TriggerFT
 
+	if BufferSamples <= 0 {
+		return fmt.Errorf("invalid buffer size in header: %d samples", BufferSamples)
+	}
+
 	//Compute actual FT taking into account FTh bit
 	// FTm = FT - PreTrigger
 	if *nextFT == -1 {
@@ -101,46 +121,57 @@ func computeNextFThm(nextFT *int32, nextFThm *int32, evtFormat *EventFormat) {
 		*nextFThm = *nextFT - int32(PreTrgSamples)
 	}
 
-	if configuration.Verbosity > 3 {
-		message := fmt.Sprintf("nextFThm: 0x%05x\tnextFT: 0x%05x", *nextFThm, *nextFT)
-		logger.Info(message, "pmts")
+	if log := ModuleLogger("pmts"); logEnabled(log, LevelTrace) {
+		log.Log(context.Background(), LevelTrace, "Next FT", "nextFThm", *nextFThm, "nextFT", *nextFT)
 	}
+	return nil
 }
 
-func decodeChargeIndiaPmtCompressed(data []uint16, position int, waveforms []*[]int16,
-	current_bit *int, huffman *HuffmanNode, channelMask []uint16, time uint32) int {
+func decodeChargeIndiaPmtCompressed(cursor *Cursor, waveforms []*[]int16,
+	current_bit *int, huffman *HuffmanNode, channelMask []uint16, time uint32) error {
 	var dataword uint32 = 0
+	log := ModuleLogger("pmts")
+	trace := logEnabled(log, LevelTrace)
 
 	for _, channelID := range channelMask {
 		if *current_bit < 16 {
-			position++
+			cursor.Skip(1)
 			*current_bit += 16
 		}
 		// Pack two 16-bit words into a 32-bit word in the correct order
-		dataword = (uint32(data[position]) << 16) | uint32(data[position+1])
+		dataword = cursor.Pair()
+		if err := cursor.Err(); err != nil {
+			return err
+		}
 
 		// Get previous value
-		waveform := *waveforms[channelID%100]
+		waveform := waveforms[channelID%100]
 		var previous int16 = 0
-		if time > 0 {
-			previous = waveform[time-1]
+		if time > 0 && waveform != nil && int(time) <= len(*waveform) {
+			previous = (*waveform)[time-1]
 		}
 
-		var control_code int32 = 123456
-		wfvalue := int16(decode_compressed_value(int32(previous), dataword, control_code, current_bit, huffman))
+		var control_code int32 = HUFFMAN_CONTROL_CODE
+		value, err := decode_compressed_value(int32(previous), dataword, control_code, current_bit, huffman)
+		if err != nil {
+			return err
+		}
+		wfvalue := int16(value)
 
-		if configuration.Verbosity > 3 {
-			message := fmt.Sprintf("ElecID %d, time %d, charge 0x%04x", channelID, time, wfvalue)
-			logger.Info(message, "pmts")
+		if trace {
+			log.Log(context.Background(), LevelTrace, "Sample", "elecID", channelID, "time", time, "charge", wfvalue)
 		}
 
-		waveform[time] = wfvalue
+		if err := setSample(waveform, time, wfvalue); err != nil {
+			return err
+		}
 	}
-	return position
+	return nil
 }
 
 func computePmtWaveformPointerArray(waveforms map[uint16][]int16, chmask []uint16, positions []uint16) []*[]int16 {
-	MAX_PMTs_PER_FEC := 12
+	// One per bit in the channel mask
+	MAX_PMTs_PER_FEC := 16
 	wfPointers := make([]*[]int16, MAX_PMTs_PER_FEC)
 	for i, elecID := range chmask {
 		position := positions[i]
@@ -169,9 +200,8 @@ func pmtsChannelMask(evtFormat *EventFormat) ([]uint16, []uint16) {
 		}
 	}
 
-	if configuration.Verbosity > 2 {
-		message := fmt.Sprintf("Channel mask: %v", channelMaskVec)
-		logger.Info(message, "pmts")
+	if log := ModuleLogger("pmts"); logEnabled(log, LevelTrace) {
+		log.Log(context.Background(), LevelTrace, "Channel mask", "fec", evtFormat.FecID, "elecIDs", channelMaskVec)
 	}
 	return channelMaskVec, positions
 }
@@ -236,7 +266,9 @@ func writePmtPedestals(evtFormat *EventFormat, channelMask []uint16, baselines m
 		//       25,27,29,...      -> 0,1,2,3,4,5
 		//       37,39,41,...      -> 0,1,2,3,4,5
 		baseline_index := ((elecID % 100) % 12) / 2
-		baselines[elecID] = evtFormat.Baselines[baseline_index]
+		if int(baseline_index) < len(evtFormat.Baselines) {
+			baselines[elecID] = evtFormat.Baselines[baseline_index]
+		}
 	}
 }
 
@@ -246,16 +278,20 @@ func processPmtIds(event *EventType, configuration Configuration) {
 		// Check external trigger
 		if elecID == uint16(extTriggerCh) {
 			event.ExtTrgWaveform = &waveform
+			event.InvalidExtTrg = event.InvalidChannels[elecID]
 			delete(event.PmtWaveforms, elecID)
 			delete(event.Baselines, elecID)
+			delete(event.InvalidChannels, elecID)
 		}
 
 		// Check PMT sum waveform
 		if elecID == uint16(configuration.PmtSumCh) {
 			event.PmtSumWaveform = &waveform
 			event.PmtSumBaseline = event.Baselines[elecID]
+			event.InvalidPmtSum = event.InvalidChannels[elecID]
 			delete(event.PmtWaveforms, elecID)
 			delete(event.Baselines, elecID)
+			delete(event.InvalidChannels, elecID)
 		}
 
 		// Check dual channels
@@ -282,8 +318,12 @@ func processPmtIds(event *EventType, configuration Configuration) {
 			newid := elecID - 12
 			event.BlrWaveforms[newid] = waveform
 			event.BlrBaselines[newid] = event.Baselines[elecID]
+			if event.InvalidChannels[elecID] {
+				event.InvalidBlrChannels[newid] = true
+			}
 			delete(event.PmtWaveforms, elecID)
 			delete(event.Baselines, elecID)
+			delete(event.InvalidChannels, elecID)
 		}
 	}
 }
@@ -0,0 +1,51 @@
+package decoder
+
+import (
+	"io"
+	"iter"
+)
+
+// Decodes the events of a DATE file or stream. The decoding uses the
+// configuration given to SetConfiguration and the Huffman codes and sensors
+// map loaded from the database, or set with SetHuffmanCodes and
+// SetSensorsMap.
+type Reader struct {
+	read func() (EventHeaderStruct, []byte, error)
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{read: func() (EventHeaderStruct, []byte, error) {
+		return ReadEventFromFile(r)
+	}}
+}
+
+// Events from any other source, like a FollowReader or a StreamReader
+func NewEventReader(read func() (EventHeaderStruct, []byte, error)) *Reader {
+	return &Reader{read: read}
+}
+
+// Decoded physics and calibration events, the rest are skipped. An event
+// that cannot be decoded is yielded with its error and the iteration goes
+// on. An error reading the input is yielded and ends the iteration, the end
+// of the input ends it without error.
+func (r *Reader) Events() iter.Seq2[EventType, error] {
+	return func(yield func(EventType, error) bool) {
+		for {
+			header, eventData, err := r.read()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(EventType{}, err)
+				return
+			}
+			if !ValidEvent(header) {
+				continue
+			}
+			event, err := ReadGDC(eventData, header)
+			if !yield(event, err) {
+				return
+			}
+		}
+	}
+}
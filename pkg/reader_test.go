@@ -0,0 +1,46 @@
+package decoder
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestReaderEvents(t *testing.T) {
+	setupTestConfiguration()
+	config := DefaultGeneratorConfig()
+	generator, err := NewGenerator(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer := new(bytes.Buffer)
+	if err := generator.WriteEvents(buffer, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	generator, _ = NewGenerator(config)
+	count := 0
+	for event, err := range NewReader(bytes.NewReader(buffer.Bytes())).Events() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		compareGenerated(t, generator.NextEvent(), event)
+		count++
+	}
+	if count != 3 {
+		t.Fatalf("got %d events, expected 3", count)
+	}
+
+	// A truncated event ends the iteration with an error
+	data := buffer.Bytes()
+	count = 0
+	var lastErr error
+	for _, err := range NewReader(bytes.NewReader(data[:len(data)-10])).Events() {
+		count++
+		lastErr = err
+	}
+	if count != 3 || !errors.Is(lastErr, io.ErrUnexpectedEOF) {
+		t.Fatalf("got %d results, last error %v", count, lastErr)
+	}
+}
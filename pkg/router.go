@@ -0,0 +1,224 @@
+package decoder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Output of the events that meet all the conditions of the route, the
+// conditions not given match any event. A route without conditions takes
+// all the events that no previous route took.
+type Route struct {
+	TriggerTypes []int `json:"trigger_types,omitempty"`
+	// DATE event types: physics or calibration
+	EventTypes []string `json:"event_types,omitempty"`
+	// True only matches the events with errors in the FECs or with FECs out
+	// of sync, false only the rest, and unset both
+	Errors *bool `json:"errors,omitempty"`
+	// Output file, by default file_out with the suffix before the
+	// extension: run.h5 and _calib give run_calib.h5
+	File   string `json:"file,omitempty"`
+	Suffix string `json:"suffix,omitempty"`
+}
+
+var dateEventTypes = map[string]EventTypeType{
+	"physics":     PHYSICS_EVENT,
+	"calibration": CALIBRATION_EVENT,
+}
+
+func (r Route) Matches(event *EventType) bool {
+	if r.Errors != nil && (event.Error || event.Desync) != *r.Errors {
+		return false
+	}
+	if len(r.TriggerTypes) > 0 && !slices.Contains(r.TriggerTypes, int(event.TriggerType)) {
+		return false
+	}
+	if len(r.EventTypes) > 0 {
+		matches := false
+		for _, name := range r.EventTypes {
+			matches = matches || dateEventTypes[name] == event.DateEventType
+		}
+		if !matches {
+			return false
+		}
+	}
+	return true
+}
+
+func (r Route) Filename(fileOut string) string {
+	if r.File != "" {
+		return r.File
+	}
+	extension := filepath.Ext(fileOut)
+	return strings.TrimSuffix(fileOut, extension) + r.Suffix + extension
+}
+
+func (r Route) validate() error {
+	for _, name := range r.EventTypes {
+		if _, found := dateEventTypes[name]; !found {
+			return fmt.Errorf("unknown event type %q, use physics or calibration", name)
+		}
+	}
+	if r.File != "" && r.Suffix != "" {
+		return errors.New("file and suffix cannot be used together")
+	}
+	return nil
+}
+
+// Routing table, the first route that matches an event takes it
+type Routes []Route
+
+// Also reads the table from a JSON string, as given in flags and
+// environment variables
+func (r *Routes) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		if text == "" {
+			*r = nil
+			return nil
+		}
+		data = []byte(text)
+	}
+	var routes []Route
+	if err := json.Unmarshal(data, &routes); err != nil {
+		return err
+	}
+	*r = routes
+	return nil
+}
+
+func (r Routes) String() string {
+	if len(r) == 0 {
+		return "[]"
+	}
+	data, _ := json.Marshal([]Route(r))
+	return string(data)
+}
+
+// Routing table of the configuration. Without routes, split_trg sends the
+// two trigger codes to file_out and file_out2, dropping the rest, and
+// otherwise all the events go to file_out. The events with errors that are
+// not discarded go with the rest.
+func (c Configuration) OutputRoutes() Routes {
+	if len(c.Routes) > 0 {
+		return c.Routes
+	}
+	if c.SplitTrg {
+		return Routes{
+			{TriggerTypes: []int{c.TrgCode1}},
+			{TriggerTypes: []int{c.TrgCode2}, File: c.FileOut2},
+		}
+	}
+	return Routes{{}}
+}
+
+// Events that are kept but no route takes, and are therefore discarded,
+// described for the logs. The events with errors are kept unless discard
+// is set, and the events out of sync unless their FECs fail.
+func (c Configuration) UnroutedEvents() []string {
+	routes := c.OutputRoutes()
+	unrouted := make([]string, 0)
+	if !routes.catchAll(false) {
+		unrouted = append(unrouted, "events without errors")
+	}
+	if !routes.catchAll(true) {
+		if !c.Discard {
+			unrouted = append(unrouted, "events with errors")
+		}
+		if c.CheckFecSync && (!c.DiscardDesync || c.KeepPartial) {
+			unrouted = append(unrouted, "events out of sync")
+		}
+	}
+	return unrouted
+}
+
+// Whether a route takes all the events, with or without errors
+func (r Routes) catchAll(errors bool) bool {
+	for _, route := range r {
+		if (route.Errors != nil && *route.Errors != errors) || len(route.TriggerTypes) > 0 {
+			continue
+		}
+		if len(route.EventTypes) == 0 ||
+			(slices.Contains(route.EventTypes, "physics") && slices.Contains(route.EventTypes, "calibration")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Output files of the routes, without repetitions, for file_out
+func (r Routes) Filenames(fileOut string) []string {
+	filenames := make([]string, 0, len(r))
+	for _, route := range r {
+		filename := route.Filename(fileOut)
+		if !slices.Contains(filenames, filename) {
+			filenames = append(filenames, filename)
+		}
+	}
+	return filenames
+}
+
+// Sends each event to the writer of its route. The routes with the same
+// file share the writer.
+type Router struct {
+	routes  Routes
+	writers []EventWriter
+	closers []EventWriter
+}
+
+// Routes the events to the writers, one per route
+func NewRouter(routes Routes, writers []EventWriter) *Router {
+	router := &Router{routes: routes, writers: writers}
+	for _, writer := range writers {
+		if !slices.Contains(router.closers, writer) {
+			router.closers = append(router.closers, writer)
+		}
+	}
+	return router
+}
+
+// Opens the files of the routes for file_out with NewEventWriter
+func OpenRouter(routes Routes, fileOut string) (*Router, error) {
+	router := &Router{routes: routes}
+	opened := make(map[string]EventWriter)
+	for _, route := range routes {
+		filename := route.Filename(fileOut)
+		writer, found := opened[filename]
+		if !found {
+			var err error
+			writer, err = NewEventWriter(filename)
+			if err != nil {
+				router.Close()
+				return nil, err
+			}
+			opened[filename] = writer
+			router.closers = append(router.closers, writer)
+		}
+		router.writers = append(router.writers, writer)
+	}
+	return router, nil
+}
+
+// Writer of the first route that matches the event, nil if none does
+func (r *Router) Writer(event *EventType) EventWriter {
+	for i, route := range r.routes {
+		if route.Matches(event) {
+			return r.writers[i]
+		}
+	}
+	return nil
+}
+
+func (r *Router) Close() error {
+	errs := make([]error, 0)
+	for _, writer := range r.closers {
+		if err := writer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
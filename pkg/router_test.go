@@ -0,0 +1,165 @@
+package decoder
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	withErrors := true
+	routes := Routes{
+		{Errors: &withErrors, Suffix: "_errors"},
+		{TriggerTypes: []int{1, 2}, Suffix: "_physics"},
+		{EventTypes: []string{"calibration"}, Suffix: "_calib"},
+		{},
+	}
+	if filenames := routes.Filenames("run.h5"); !slices.Equal(filenames,
+		[]string{"run_errors.h5", "run_physics.h5", "run_calib.h5", "run.h5"}) {
+		t.Fatalf("filenames: %v", filenames)
+	}
+
+	writers := []*recordingWriter{{}, {}, {}, {}}
+	router := NewRouter(routes, []EventWriter{writers[0], writers[1], writers[2], writers[3]})
+	for _, event := range []EventType{
+		{EventID: 1, TriggerType: 2, DateEventType: PHYSICS_EVENT},
+		{EventID: 2, TriggerType: 9, DateEventType: CALIBRATION_EVENT},
+		// The first route that matches takes the event
+		{EventID: 3, TriggerType: 1, DateEventType: CALIBRATION_EVENT},
+		{EventID: 4, TriggerType: 1, DateEventType: PHYSICS_EVENT, Error: true},
+		{EventID: 5, TriggerType: 15, DateEventType: PHYSICS_EVENT},
+		// FECs out of sync, but kept
+		{EventID: 6, TriggerType: 1, DateEventType: PHYSICS_EVENT, Desync: true},
+	} {
+		router.Writer(&event).WriteEvent(&event)
+	}
+	for i, expected := range [][]uint32{{4, 6}, {1, 3}, {2}, {5}} {
+		if !slices.Equal(writers[i].events, expected) {
+			t.Fatalf("route %d: got events %v, expected %v", i, writers[i].events, expected)
+		}
+	}
+	if err := router.Close(); err != nil || !writers[3].closed {
+		t.Fatal("writers not closed")
+	}
+
+	// Without the errors condition a route takes the events with errors too
+	withoutErrors := false
+	clean, all := &recordingWriter{}, &recordingWriter{}
+	router = NewRouter(Routes{{Errors: &withoutErrors}, {}}, []EventWriter{clean, all})
+	for _, event := range []EventType{{EventID: 1}, {EventID: 2, Error: true}, {EventID: 3, Desync: true}} {
+		router.Writer(&event).WriteEvent(&event)
+	}
+	if !slices.Equal(clean.events, []uint32{1}) || !slices.Equal(all.events, []uint32{2, 3}) {
+		t.Fatalf("events written: %v %v", clean.events, all.events)
+	}
+}
+
+func TestRouterDiscards(t *testing.T) {
+	setupTestConfiguration()
+	Metrics = NewDecoderMetrics()
+	defer func() { Metrics = NewDecoderMetrics() }()
+
+	// The old split_trg, without catch-all
+	config := testConfiguration()
+	config.SplitTrg = true
+	config.TrgCode1 = 1
+	config.TrgCode2 = 9
+	config.FileOut = "run.h5"
+	config.FileOut2 = "other.h5"
+	routes := config.OutputRoutes()
+	if filenames := routes.Filenames(config.FileOut); !slices.Equal(filenames, []string{"run.h5", "other.h5"}) {
+		t.Fatalf("filenames: %v", filenames)
+	}
+
+	if unrouted := config.UnroutedEvents(); !slices.Equal(unrouted, []string{"events without errors"}) {
+		t.Fatalf("unrouted events: %v", unrouted)
+	}
+
+	writer, writer2 := &recordingWriter{}, &recordingWriter{}
+	router := NewRouter(routes, []EventWriter{writer, writer2})
+	events := []EventType{
+		{EventID: 1, TriggerType: 9},
+		{EventID: 2, TriggerType: 5},
+		{EventID: 3, TriggerType: 1, Error: true},
+	}
+	for _, event := range events {
+		ProcessDecodedEvent(event, config, router)
+	}
+	if len(writer.events) != 0 || !slices.Equal(writer2.events, []uint32{1}) {
+		t.Fatalf("events written: %v %v", writer.events, writer2.events)
+	}
+	if Metrics.EventsDiscarded.Value("no_route") != 1 || Metrics.EventsDiscarded.Value("error") != 1 {
+		t.Fatal("discarded events not counted")
+	}
+
+	// Kept, the events with errors go to the file of their trigger
+	config.Discard = false
+	ProcessDecodedEvent(events[2], config, router)
+	if !slices.Equal(writer.events, []uint32{3}) {
+		t.Fatalf("events written: %v", writer.events)
+	}
+}
+
+func TestUnroutedEvents(t *testing.T) {
+	config := testConfiguration()
+	config.Discard = false
+	if unrouted := config.UnroutedEvents(); len(unrouted) != 0 {
+		t.Fatalf("default table drops %v", unrouted)
+	}
+	withoutErrors, withErrors := false, true
+	config.Routes = Routes{{EventTypes: []string{"physics", "calibration"}, Errors: &withoutErrors}}
+	if unrouted := config.UnroutedEvents(); !slices.Equal(unrouted, []string{"events with errors"}) {
+		t.Fatalf("unrouted events: %v", unrouted)
+	}
+	// Discarded before routing, the events out of sync fail with their FECs
+	config.Discard = true
+	if unrouted := config.UnroutedEvents(); len(unrouted) != 0 {
+		t.Fatalf("unrouted events: %v", unrouted)
+	}
+	// Kept and flagged
+	config.DiscardDesync = false
+	if unrouted := config.UnroutedEvents(); !slices.Equal(unrouted, []string{"events out of sync"}) {
+		t.Fatalf("unrouted events: %v", unrouted)
+	}
+	config.CheckFecSync = false
+	if unrouted := config.UnroutedEvents(); len(unrouted) != 0 {
+		t.Fatalf("unrouted events: %v", unrouted)
+	}
+	config.Routes = Routes{{EventTypes: []string{"calibration"}}, {Errors: &withErrors}}
+	if unrouted := config.UnroutedEvents(); !slices.Equal(unrouted, []string{"events without errors"}) {
+		t.Fatalf("unrouted events: %v", unrouted)
+	}
+}
+
+func TestRoutesFromText(t *testing.T) {
+	config := validConfiguration()
+	err := SetConfigurationValue(&config, "routes", `[{"trigger_types": [9], "suffix": "_calib"}, {}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Routes{{TriggerTypes: []int{9}, Suffix: "_calib"}, {}}
+	if config.Routes.String() != expected.String() {
+		t.Fatalf("got routes %v", config.Routes)
+	}
+	err = SetConfigurationValue(&config, "routes", `[{"errors": false}, {"errors": true, "suffix": "_errors"}, {}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := config.Routes[0].Errors; errs == nil || *errs {
+		t.Fatalf("got routes %v", config.Routes)
+	}
+	if errs := config.Routes[1].Errors; errs == nil || !*errs || config.Routes[2].Errors != nil {
+		t.Fatalf("got routes %v", config.Routes)
+	}
+	if err := SetConfigurationValue(&config, "routes", `[{"trigger_types": 9}]`); err == nil {
+		t.Fatal("invalid routes accepted")
+	}
+
+	// In configuration files the table is not a string
+	data := []byte(`{"routes": [{"event_types": ["calibration"], "file": "calib.h5"}]}`)
+	if err := UnmarshalConfiguration(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Routes) != 1 || config.Routes[0].File != "calib.h5" {
+		t.Fatalf("got routes %v", config.Routes)
+	}
+}
@@ -1,7 +1,7 @@
 package decoder
 
 import (
-	"encoding/binary"
+	"context"
 	"fmt"
 	"sort"
 )
@@ -9,7 +9,7 @@ import (
 const CLOCK_TICK float32 = 0.025
 
 func ReadSipmFEC(data []uint16, evtFormat *EventFormat, dateHeader *EventHeaderStruct,
-	event *EventType, sipmPayloads map[uint16][]uint16) {
+	event *EventType, sipmPayloads map[uint16][]uint16) error {
 	FecID := evtFormat.FecID
 	ZeroSuppression := evtFormat.ZeroSuppression
 	CompressedData := evtFormat.CompressedData
@@ -56,54 +56,67 @@ func ReadSipmFEC(data []uint16, evtFormat *EventFormat, dateHeader *EventHeaderS
 	payloadChanB, chanBFound := sipmPayloads[channelB]
 
 	if chanAFound && chanBFound {
-		if configuration.Verbosity > 1 {
-			message := fmt.Sprintf("A pair of SIPM FECs has been read, decoding... %d %d (0x%02x 0x%02x)",
-				channelA, channelB, channelA, channelB)
-			logger.Info(message, "sipms")
-		}
+		log := ModuleLogger("sipms")
+		trace := logEnabled(log, LevelTrace)
+		log.Debug("A pair of SIPM FECs has been read, decoding...",
+			"run", event.RunNumber, "event", event.EventID, "fecA", channelA, "fecB", channelB)
+		// Remove the payloads from the map, they are decoded now
+		delete(sipmPayloads, channelA)
+		delete(sipmPayloads, channelB)
+
 		// Rebuild payload from the two links
-		payload := buildSipmData(payloadChanA, payloadChanB)
-		position := 0
+		payload, err := buildSipmData(payloadChanA, payloadChanB)
+		if err != nil {
+			return err
+		}
+		cursor := NewCursor(payload)
 
 		// Read data
 		time := -1
 
 		var previousFT uint32 = 0
 		var nextFT uint32 = 0
-		endOfData := false
+		// Without FEBs there is nothing to read
+		endOfData := numberOfFEB == 0
 		for !endOfData {
 			time = time + 1
 			var j uint16
 			for j = 0; j < numberOfFEB; j++ {
 				// Stop condition for while and for
-				// Before FAFAFAFA there is and FFFFFFFF block signaling the end of the data
+				// The payload has been cut using WordCount, so the data ends with it
+				if cursor.Remaining() == 0 {
+					endOfData = true
+					break
+				}
+				// Without WordCount, before FAFAFAFA there is and FFFFFFFF block signaling the end of the data
 				// Sometimes there are some extra words between the end of the data and FAFAFAFA
 				// Like this: 4892 ed51 7fff ffff ffff ffff ffff ffff 09c0 2efc fafa fafa fafa fafa
-				if (payload[position] == 0xFFFF) && (payload[position+1] == 0xFFFF) {
+				if (evtFormat.WordCount == 0 || !configuration.CheckWordCount) &&
+					cursor.Remaining() > 1 && (cursor.Peek(0) == 0xFFFF) && (cursor.Peek(1) == 0xFFFF) {
 					endOfData = true
 					break
 				}
 
-				febID := (payload[position] & 0x0FC00) >> 10
-				febInfo := payload[position] & 0x03FF
+				febWord := cursor.Next()
+				febID := (febWord & 0x0FC00) >> 10
+				febInfo := febWord & 0x03FF
 				emptyFeb := (febInfo & 0x0002) >> 1
 
-				if configuration.Verbosity > 3 {
-					message := fmt.Sprintf("FEB ID: %d (0x%02x). nFEBs: %d", febID, febID, numberOfFEB)
-					logger.Info(message, "sipms")
+				if trace {
+					log.Log(context.Background(), LevelTrace, "FEB", "feb", febID, "nFEBs", numberOfFEB)
 				}
 
 				// If there is no data, stop processing this FEB
 				if emptyFeb != 0 {
-					position++
-					if configuration.Verbosity > 1 {
-						logger.Info("Empty FEB", "sipms")
-					}
+					log.Debug("Empty FEB", "event", event.EventID, "fec", channelA, "feb", febID)
 					continue
 				}
-				position++
 
-				FT := uint32(payload[position]) & 0x0FFFF
+				if int(febID) >= MAX_FEBs {
+					return &ErrOutOfBounds{What: "FEB ID", Index: int(febID), Length: MAX_FEBs}
+				}
+
+				FT := uint32(cursor.Peek(0)) & 0x0FFFF
 				if !ZeroSuppression {
 					if time < 1 {
 						previousFT = FT
@@ -112,6 +125,9 @@ func ReadSipmFEC(data []uint16, evtFormat *EventFormat, dateHeader *EventHeaderS
 						if evtFormat.FWVersion == 10 {
 							BufferSamplesFT = evtFormat.BufferSamples2
 						}
+						if BufferSamplesFT/40 == 0 {
+							return fmt.Errorf("invalid buffer size in header: %d samples", BufferSamplesFT)
+						}
 
 						//New FT only after reading all FEBs in the FEC
 						if j == 0 {
@@ -120,77 +136,75 @@ func ReadSipmFEC(data []uint16, evtFormat *EventFormat, dateHeader *EventHeaderS
 							nextFT = previousFT
 						}
 						if nextFT != FT {
-							evtNumber := EventIdGetNbInRun(dateHeader.EventId)
-							errMessage := fmt.Sprintf("Event %d, FECs (0x%x, 0x%x), FEB ID (0x%x, %d), expected FT was 0x%x, current FT is 0x%x, time %d",
-								evtNumber, channelA, channelB, febID, febID, nextFT, FT, time)
-							logger.Error(errMessage)
+							log.Error("Unexpected FT", "expected", nextFT, "ft", FT,
+								"run", dateHeader.EventRunNb, "event", EventIdGetNbInRun(dateHeader.EventId),
+								"fecA", channelA, "fecB", channelB, "feb", febID, "time", time)
+							Metrics.FtMismatches.Inc(fecLabel(channelA))
 							event.Error = true
 							if configuration.Discard {
-								return
+								return nil
 							}
 						}
 						previousFT = nextFT
 					}
 				}
 
-				var timeinmus uint32
-				timeinmus, position = computeSipmTime(payload, position, evtFormat)
+				timeinmus, err := computeSipmTime(cursor, evtFormat)
+				if err != nil {
+					return err
+				}
 
 				// If RAW mode, channel mask will appear the first time
 				// If ZS mode, channel mask will appear each time
 				if time < 1 || ZeroSuppression {
 					var chMask, chPositions []uint16
-					chMask, chPositions, position = sipmChannelMask(payload, position, febID)
+					chMask, chPositions = sipmChannelMask(cursor, febID)
 					chMasks[febID] = chPositions
 					initializeWaveforms(event.SipmWaveforms, chMask, bufferSamples)
 					computeSipmWaveformPointerArray(wfPointers, event.SipmWaveforms, chMask, chPositions)
 				}
 
-				if ZeroSuppression {
-					if CompressedData {
-						current_bit := 31
-						position = decodeChargeIndiaSipmCompressed(payload, position, wfPointers,
-							&current_bit, huffmanCodesSipms, chMasks[febID], lastValues, timeinmus)
-					} else {
-						position = decodeCharge(payload, position, wfPointers, chMasks[febID], timeinmus)
-					}
+				if !ZeroSuppression {
+					timeinmus = uint32(time)
+				}
+				if CompressedData {
+					current_bit := 31
+					err = decodeChargeIndiaSipmCompressed(cursor, wfPointers,
+						&current_bit, huffmanCodesSipms, chMasks[febID], lastValues, timeinmus)
 				} else {
-					if CompressedData {
-						current_bit := 31
-						position = decodeChargeIndiaSipmCompressed(payload, position, wfPointers,
-							&current_bit, huffmanCodesSipms, chMasks[febID], lastValues, uint32(time))
-					} else {
-						position = decodeCharge(payload, position, wfPointers, chMasks[febID], uint32(time))
-					}
+					err = decodeCharge(cursor, wfPointers, chMasks[febID], timeinmus)
+				}
+				if err == nil {
+					err = cursor.Err()
+				}
+				if err != nil {
+					return err
 				}
 			}
-
-			// Remove the already processed payloads from the map
-			delete(sipmPayloads, channelA)
-			delete(sipmPayloads, channelB)
 		}
+		checkFecWordCount(evtFormat, cursor.Position, len(payload), event)
 	}
+	return nil
 }
 
 // Odd words are in ptrA and even words in ptrB
-func buildSipmData(dataA []uint16, dataB []uint16) []uint16 {
+func buildSipmData(dataA []uint16, dataB []uint16) ([]uint16, error) {
 	size := len(dataA) + len(dataB)
-	data := make([]uint16, size)
 
 	if len(dataA) != len(dataB) {
-		errMessage := fmt.Sprintf("data from both SiPM links must have the same length: %d != %d", len(dataA), len(dataB))
-		panic(errMessage)
+		return nil, &ErrSipmLinks{LengthA: len(dataA), LengthB: len(dataB)}
 	}
 
+	data := make([]uint16, size)
 	for i := 0; i < len(dataA); i++ {
 		data[i*2] = dataA[i]
 		data[i*2+1] = dataB[i]
 	}
-	return data
+	return data, nil
 }
 
-// Returns FT and new position
-func computeSipmTime(data []uint16, position int, evtFormat *EventFormat) (uint32, int) {
+// Returns FT and moves the cursor after it
+func computeSipmTime(cursor *Cursor, evtFormat *EventFormat) (uint32, error) {
 	FTBit := evtFormat.FTBit
 	TriggerFT := int32(evtFormat.TriggerFT)
 	PreTrgSamples := int32(evtFormat.PreTrigger)
@@ -203,11 +217,13 @@ func computeSipmTime(data []uint16, position int, evtFormat *EventFormat) (uint3
 	}
 	ZeroSuppression := evtFormat.ZeroSuppression
 
-	FT := int32(data[position]) & 0x0FFFF
-	position++ // Send this to main function, somehow
+	FT := int32(cursor.Next()) & 0x0FFFF
 
 	if ZeroSuppression {
 		ringBufferSize := int32(float32(BufferSamples) * CLOCK_TICK)
+		if ringBufferSize <= 0 {
+			return 0, fmt.Errorf("invalid buffer size in header: %d samples", BufferSamples)
+		}
 		var startPosition int32 = ((FTBit << 16) + TriggerFT - PreTrgSamples + BufferSamples) / 40 % ringBufferSize
 
 		// Due to FPGA implementation. To be removed in the future
@@ -221,19 +237,18 @@ func computeSipmTime(data []uint16, position int, evtFormat *EventFormat) (uint3
 		}
 	}
 
-	if configuration.Verbosity > 3 {
-		message := fmt.Sprintf("FT: 0x%04x", FT)
-		logger.Info(message, "sipms")
+	if log := ModuleLogger("sipms"); logEnabled(log, LevelTrace) {
+		log.Log(context.Background(), LevelTrace, "FT", "ft", FT)
 	}
 
-	return uint32(FT), position
+	return uint32(FT), cursor.Err()
 }
 
 // There are 4 16-bit words with the channel mask for SiPMs
 // MSB ch63, LSB ch0
 // Data came after chmask, ordered from 0 to 63
-// Returns vector with active ElecIDs and new position
-func sipmChannelMask(data []uint16, position int, febID uint16) ([]uint16, []uint16, int) {
+// Returns vector with active ElecIDs and their positions
+func sipmChannelMask(cursor *Cursor, febID uint16) ([]uint16, []uint16) {
 	var ElecID uint16
 	channelMaskVector := make([]uint16, 0)
 	// To avoid using the map for every waveform sample we are keeping another
@@ -243,15 +258,15 @@ func sipmChannelMask(data []uint16, position int, febID uint16) ([]uint16, []uin
 
 	var l, t uint16
 	for l = 4; l > 0; l-- {
+		mask := cursor.Next()
 		for t = 0; t < 16; t++ {
-			active := CheckBit(data[position], 15-t)
+			active := CheckBit(mask, 15-t)
 			ElecID = (febID+1)*1000 + l*16 - t - 1
 
 			if active {
 				channelMaskVector = append(channelMaskVector, ElecID)
 			}
 		}
-		position++
 	}
 
 	sort.Slice(channelMaskVector, func(i, j int) bool {
@@ -263,7 +278,7 @@ func sipmChannelMask(data []uint16, position int, febID uint16) ([]uint16, []uin
 		positions = append(positions, computeSipmPosition(elecID))
 	}
 
-	return channelMaskVector, positions, position
+	return channelMaskVector, positions
 }
 
 func computeSipmPosition(elecID uint16) uint16 {
@@ -284,44 +299,53 @@ func computeSipmWaveformPointerArray(wfPointers []*[]int16, waveforms map[uint16
 	}
 }
 
-func decodeChargeIndiaSipmCompressed(data []uint16, position int,
+func decodeChargeIndiaSipmCompressed(cursor *Cursor,
 	waveforms []*[]int16, current_bit *int, huffman *HuffmanNode,
-	channelMask []uint16, last_values []int16, time uint32) int {
+	channelMask []uint16, last_values []int16, time uint32) error {
 
 	var dataword uint32 = 0
+	log := ModuleLogger("sipms")
+	trace := logEnabled(log, LevelTrace)
 
 	for _, channelID := range channelMask {
 		if *current_bit < 16 {
-			position++
+			cursor.Skip(1)
 			*current_bit += 16
 		}
 		// Pack two 16-bit words into a 32-bit word in the correct order
-		dataword = (uint32(data[position]) << 16) | uint32(data[position+1])
+		dataword = cursor.Pair()
+		if err := cursor.Err(); err != nil {
+			return err
+		}
 
 		// Get previous value
 		previous := last_values[channelID]
 
-		var control_code int32 = 123456
-		wfvalue := int16(decode_compressed_value(int32(previous), dataword, control_code, current_bit, huffman))
+		var control_code int32 = HUFFMAN_CONTROL_CODE
+		value, err := decode_compressed_value(int32(previous), dataword, control_code, current_bit, huffman)
+		if err != nil {
+			return err
+		}
+		wfvalue := int16(value)
 		last_values[channelID] = wfvalue
 
-		if configuration.Verbosity > 3 {
-			message := fmt.Sprintf("ElecID %d (%d), time %d, charge 0x%04x",
-				computeSipmIDFromPosition(channelID), channelID, time, wfvalue)
-			logger.Info(message, "sipms")
+		if trace {
+			log.Log(context.Background(), LevelTrace, "Sample",
+				"elecID", computeSipmIDFromPosition(channelID), "position", channelID, "time", time, "charge", wfvalue)
 		}
 
 		//Save data in Digits
-		waveform := *waveforms[channelID]
-		waveform[time] = wfvalue
+		if err := setSample(waveforms[channelID], time, wfvalue); err != nil {
+			return err
+		}
 	}
 
 	if *current_bit < 15 {
-		position += 2 // We have consumed part of the second word
+		cursor.Skip(2) // We have consumed part of the second word
 	} else {
-		position++ // We are in the first word
+		cursor.Skip(1) // We are in the first word
 	}
-	return position
+	return cursor.Err()
 }
 
 func initializeWaveforms(waveforms map[uint16][]int16, channelMask []uint16, bufferSamples uint32) {
@@ -332,59 +356,57 @@ func initializeWaveforms(waveforms map[uint16][]int16, channelMask []uint16, buf
 	}
 }
 
-func decodeCharge(data []uint16, position int, waveforms []*[]int16, channelMask []uint16, time uint32) int {
+// Writes a sample checking that the time bin is inside the waveform
+func setSample(waveform *[]int16, time uint32, value int16) error {
+	if waveform == nil {
+		return &ErrOutOfBounds{What: "waveform", Index: int(time), Length: 0}
+	}
+	if int(time) >= len(*waveform) {
+		return &ErrOutOfBounds{What: "waveform sample", Index: int(time), Length: len(*waveform)}
+	}
+	(*waveform)[time] = value
+	return nil
+}
+
+func decodeCharge(cursor *Cursor, waveforms []*[]int16, channelMask []uint16, time uint32) error {
 	//Raw Mode
-	var charge int32 = 0
-	positionCharge := position
+	// Charges are 12 bits packed in 16-bit words
+	// 3 words (0123,4567,89AB) give 4 charges (012,345,678,9AB)
+	// (012)(3 45)(67 8)(9AB)
+	var w0, w1, w2 uint16
+	var charge uint16
+	log := ModuleLogger("sipms")
+	trace := logEnabled(log, LevelTrace)
 
 	//We have 64 SiPM per FEB
 	for snsIndex, channelID := range channelMask {
-		// Pack two 16-bit words into a 32-bit word in the correct order
-		dataU8 := make([]byte, 4)
-		binary.BigEndian.PutUint16(dataU8[0:2], data[positionCharge])
-		binary.BigEndian.PutUint16(dataU8[2:4], data[positionCharge+1])
-		charge = int32(binary.BigEndian.Uint32(dataU8))
-
 		switch snsIndex % 4 {
 		case 0:
-			charge = charge >> 20
-			charge = charge & 0x0fff
-			break
+			w0 = cursor.Next()
+			charge = w0 >> 4
 		case 1:
-			charge = charge >> 8
-			charge = charge & 0x0fff
-			break
+			w1 = cursor.Next()
+			charge = ((w0 & 0x000F) << 8) | (w1 >> 8)
 		case 2:
-			charge = charge >> 12
-			charge = charge & 0x0fff
-			break
+			w2 = cursor.Next()
+			charge = ((w1 & 0x00FF) << 4) | (w2 >> 12)
 		case 3:
-			charge = charge & 0x0fff
-			break
-		}
-		if (snsIndex % 4) == 1 {
-			positionCharge++
+			// Channel 3 does not add new words
+			charge = w2 & 0x0FFF
 		}
-		if (snsIndex % 4) == 3 {
-			positionCharge += 2
+		if err := cursor.Err(); err != nil {
+			return err
 		}
 
-		if configuration.Verbosity > 3 {
-			message := fmt.Sprintf("ElecID %d (%d), time %d, charge 0x%04x",
-				computeSipmIDFromPosition(channelID), channelID, time, charge)
-			logger.Info(message, "sipms")
+		if trace {
+			log.Log(context.Background(), LevelTrace, "Sample",
+				"elecID", computeSipmIDFromPosition(channelID), "position", channelID, "time", time, "charge", charge)
 		}
 
-		waveform := *waveforms[channelID]
-		waveform[time] = int16(charge)
-
-		// Channel 3 does not add new words
-		// 3 words (0123,4567,89AB) give 4 charges (012,345,678,9AB)
-		// (012)(3 45)(67 8)(9AB)
-		if (snsIndex % 4) != 3 {
-			position++
+		if err := setSample(waveforms[channelID], time, int16(charge)); err != nil {
+			return err
 		}
 	}
 
-	return position
+	return nil
 }
@@ -0,0 +1,108 @@
+package decoder
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Network and address of a stream input given as tcp://host:port or
+// unix:///path/to/socket
+func ParseStreamAddress(url string) (string, string, bool) {
+	for _, network := range []string{"tcp", "unix"} {
+		prefix := network + "://"
+		if strings.HasPrefix(url, prefix) {
+			return network, strings.TrimPrefix(url, prefix), true
+		}
+	}
+	return "", "", false
+}
+
+// Reads DATE events from a TCP or Unix socket, framed by the EventSize of
+// their headers. When the connection is lost it is opened again, the event
+// being received is lost. Events are only read when asked for, so a slow
+// consumer slows down the sender through the socket flow control.
+type StreamReader struct {
+	Network string
+	Address string
+	// Time between connection attempts
+	Retry time.Duration
+	// Failed connection attempts in a row before giving up, 0 for no limit
+	MaxRetries int
+	conn       net.Conn
+	reader     *bufio.Reader
+	// Set once a connection has been made, so EOF means the end of the
+	// stream only if the sender cannot be reached again
+	connected bool
+}
+
+func NewStreamReader(network string, address string) *StreamReader {
+	return &StreamReader{
+		Network:    network,
+		Address:    address,
+		Retry:      time.Second,
+		MaxRetries: 10,
+	}
+}
+
+func (r *StreamReader) connect() error {
+	attempts := 0
+	for {
+		conn, err := net.Dial(r.Network, r.Address)
+		if err == nil {
+			r.conn = conn
+			r.reader = bufio.NewReaderSize(conn, 1<<20)
+			r.connected = true
+			ModuleLogger("streamReader").Info("Connected", "network", r.Network, "address", r.Address)
+			return nil
+		}
+		attempts++
+		if r.MaxRetries > 0 && attempts >= r.MaxRetries {
+			return fmt.Errorf("error connecting to %s://%s after %d attempts: %w", r.Network, r.Address, attempts, err)
+		}
+		time.Sleep(r.Retry)
+	}
+}
+
+// Returns io.EOF when the stream ended and the sender cannot be reached
+// again
+func (r *StreamReader) ReadEvent() (EventHeaderStruct, []byte, error) {
+	for {
+		if r.conn == nil {
+			if err := r.connect(); err != nil {
+				if r.connected {
+					return EventHeaderStruct{}, nil, io.EOF
+				}
+				return EventHeaderStruct{}, nil, err
+			}
+		}
+		header, eventData, err := ReadEventFromFile(r.reader)
+		if err == nil {
+			return header, eventData, nil
+		}
+
+		var sizeErr *ErrEventSize
+		if errors.As(err, &sizeErr) {
+			// The framing is lost, the stream has to start again
+			ModuleLogger("streamReader").Error("error reading stream", "error", err)
+		} else if !errors.Is(err, io.EOF) {
+			ModuleLogger("streamReader").Error("connection lost",
+				"network", r.Network, "address", r.Address, "error", err)
+		}
+		r.conn.Close()
+		r.conn = nil
+	}
+}
+
+func (r *StreamReader) Close() error {
+	if r.conn == nil {
+		return nil
+	}
+	err := r.conn.Close()
+	r.conn = nil
+	return err
+}
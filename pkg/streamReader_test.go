@@ -0,0 +1,90 @@
+package decoder
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// The first connection is lost in the middle of an event, which is sent
+// again in the second one
+func TestStreamReaderReconnect(t *testing.T) {
+	setupTestConfiguration()
+	config := DefaultGeneratorConfig()
+	config.BufferSamples = 160
+	config.PreTrigger = 40
+	generator, err := NewGenerator(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make([]GeneratedEvent, 5)
+	for i := range events {
+		events[i] = generator.NextEvent()
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		conn.Write(events[0].Data)
+		conn.Write(events[1].Data)
+		conn.Write(events[2].Data[:100])
+		conn.Close()
+
+		conn, err = listener.Accept()
+		if err != nil {
+			return
+		}
+		for _, event := range events[2:] {
+			conn.Write(event.Data)
+		}
+		conn.Close()
+	}()
+
+	network, address, ok := ParseStreamAddress("tcp://" + listener.Addr().String())
+	if !ok {
+		t.Fatal("stream address not recognized")
+	}
+	reader := NewStreamReader(network, address)
+	reader.Retry = 10 * time.Millisecond
+	reader.MaxRetries = 3
+	defer reader.Close()
+
+	for i, expected := range events {
+		header, eventData, err := reader.ReadEvent()
+		if err != nil {
+			t.Fatalf("event %d: %v", i, err)
+		}
+		if EventIdGetNbInRun(header.EventId) != expected.EventID {
+			t.Fatalf("event %d: got ID %d", i, EventIdGetNbInRun(header.EventId))
+		}
+		if _, err := ReadGDC(eventData, header); err != nil {
+			t.Fatalf("event %d: %v", i, err)
+		}
+	}
+	if _, _, err := reader.ReadEvent(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestParseStreamAddress(t *testing.T) {
+	for url, expected := range map[string][2]string{
+		"tcp://localhost:5000":  {"tcp", "localhost:5000"},
+		"unix:///tmp/date.sock": {"unix", "/tmp/date.sock"},
+	} {
+		network, address, ok := ParseStreamAddress(url)
+		if !ok || network != expected[0] || address != expected[1] {
+			t.Errorf("%s: got %s %s %t", url, network, address, ok)
+		}
+	}
+	if _, _, ok := ParseStreamAddress("run_14711.rd"); ok {
+		t.Errorf("file recognized as a stream")
+	}
+}
@@ -1,7 +1,7 @@
 package decoder
 
 import (
-	"fmt"
+	"context"
 )
 
 type TriggerData struct {
@@ -30,59 +30,59 @@ type TriggerData struct {
 	TrgChannels     []uint16 `hdf5:"trgChannels"`
 }
 
-func ReadTriggerFEC(data []uint16, event *EventType) {
-	position := 0
+func ReadTriggerFEC(data []uint16, event *EventType) error {
+	cursor := NewCursor(data)
 
 	//TRG conf 8
-	triggerMask := uint32(data[position]&0x003FF) << 16
-	position++
+	triggerMask := uint32(cursor.Peek(0)&0x003FF) << 16
+	cursor.Skip(1)
 
 	//TRG conf 7
-	triggerMask = triggerMask | (uint32(data[position]) & 0x0FFFF)
-	position++
+	triggerMask = triggerMask | (uint32(cursor.Peek(0)) & 0x0FFFF)
+	cursor.Skip(1)
 
 	//TRG conf 6
-	triggerDiff1 := data[position] & 0x0FFFF
-	position++
+	triggerDiff1 := cursor.Peek(0) & 0x0FFFF
+	cursor.Skip(1)
 
 	//TRG conf 5
-	triggerDiff2 := data[position] & 0x0FFFF
-	position++
+	triggerDiff2 := cursor.Peek(0) & 0x0FFFF
+	cursor.Skip(1)
 
 	//TRG conf 4
-	triggerWindowA1 := data[position] & 0x003f
-	triggerChanA1 := (data[position] & 0x01FC0) >> 6
-	autoTrigger := (data[position] & 0x02000) >> 13
-	dualTrigger := (data[position] & 0x04000) >> 14
-	externalTrigger := (data[position] & 0x08000) >> 15
-	position++
+	triggerWindowA1 := cursor.Peek(0) & 0x003f
+	triggerChanA1 := (cursor.Peek(0) & 0x01FC0) >> 6
+	autoTrigger := (cursor.Peek(0) & 0x02000) >> 13
+	dualTrigger := (cursor.Peek(0) & 0x04000) >> 14
+	externalTrigger := (cursor.Peek(0) & 0x08000) >> 15
+	cursor.Skip(1)
 
 	//TRG conf 3
-	triggerWindowB1 := data[position] & 0x003f
-	triggerChanB1 := (data[position] & 0x01FC0) >> 6
-	mask := (data[position] & 0x02000) >> 13
-	triggerB2 := (data[position] & 0x04000) >> 14
-	triggerB1 := (data[position] & 0x08000) >> 15
-	position++
+	triggerWindowB1 := cursor.Peek(0) & 0x003f
+	triggerChanB1 := (cursor.Peek(0) & 0x01FC0) >> 6
+	mask := (cursor.Peek(0) & 0x02000) >> 13
+	triggerB2 := (cursor.Peek(0) & 0x04000) >> 14
+	triggerB1 := (cursor.Peek(0) & 0x08000) >> 15
+	cursor.Skip(1)
 
 	//TRG conf 2
-	triggerWindowA2 := data[position] & 0x003f
-	triggerChanA2 := (data[position] & 0x01FC0) >> 6
-	position++
+	triggerWindowA2 := cursor.Peek(0) & 0x003f
+	triggerChanA2 := (cursor.Peek(0) & 0x01FC0) >> 6
+	cursor.Skip(1)
 
 	//TRG conf 1
-	triggerWindowB2 := data[position] & 0x003f
-	triggerChanB2 := (data[position] & 0x01FC0) >> 6
-	position++
+	triggerWindowB2 := cursor.Peek(0) & 0x003f
+	triggerChanB2 := (cursor.Peek(0) & 0x01FC0) >> 6
+	cursor.Skip(1)
 
 	//TRG conf 0
-	triggerExtN := data[position] & 0x000F
-	triggerIntN := (data[position] & 0x0FFF0) >> 4
-	position++
+	triggerExtN := cursor.Peek(0) & 0x000F
+	triggerIntN := (cursor.Peek(0) & 0x0FFF0) >> 4
+	cursor.Skip(1)
 
 	//Trigger type
-	triggerType := (data[position] & 0x0FFFF) >> 15
-	position++
+	triggerType := (cursor.Peek(0) & 0x0FFFF) >> 15
+	cursor.Skip(1)
 
 	//Channels producing trigger
 	// Max 48 channels available, 0-47
@@ -91,7 +91,7 @@ func ReadTriggerFEC(data []uint16, event *EventType) {
 	channelNumber := uint16(47)
 	for chinfo := 0; chinfo < 3; chinfo++ {
 		for j := 15; j >= 0; j-- {
-			activePMT := CheckBit(data[position]&0x0FFFF, uint16(j))
+			activePMT := CheckBit(cursor.Peek(0)&0x0FFFF, uint16(j))
 			if activePMT {
 				// Bit 0-11 -> 100-111
 				// Bit 12-23 -> 200-207
@@ -102,20 +102,24 @@ func ReadTriggerFEC(data []uint16, event *EventType) {
 			}
 			channelNumber--
 		}
-		position++
+		cursor.Skip(1)
 	}
 
 	//Trigger lost type 2
-	triggerLost2 := uint32(data[position]&0x0FFFF) << 16
-	position++
-	triggerLost2 = triggerLost2 | (uint32(data[position]) & 0x0FFFF)
-	position++
+	triggerLost2 := uint32(cursor.Peek(0)&0x0FFFF) << 16
+	cursor.Skip(1)
+	triggerLost2 = triggerLost2 | (uint32(cursor.Peek(0)) & 0x0FFFF)
+	cursor.Skip(1)
 
 	//Trigger lost type 1
-	triggerLost1 := uint32(data[position]&0x0FFFF) << 16
-	position++
-	triggerLost1 = triggerLost1 | (uint32(data[position]) & 0x0FFFF)
-	position++
+	triggerLost1 := uint32(cursor.Peek(0)&0x0FFFF) << 16
+	cursor.Skip(1)
+	triggerLost1 = triggerLost1 | (uint32(cursor.Peek(0)) & 0x0FFFF)
+	cursor.Skip(1)
+
+	if err := cursor.Err(); err != nil {
+		return err
+	}
 
 	trgInfo := &event.TriggerConfig
 	trgInfo.TriggerType = triggerType
@@ -142,55 +146,25 @@ func ReadTriggerFEC(data []uint16, event *EventType) {
 	trgInfo.TriggerExtN = triggerExtN
 	trgInfo.TrgChannels = trgChannels
 
-	if configuration.Verbosity > 2 {
-		message := fmt.Sprintf("TriggerType: %d", trgInfo.TriggerType)
-		logger.Info(message, "trigger")
-		message = fmt.Sprintf("TriggerLost1: %d", trgInfo.TriggerLost1)
-		logger.Info(message, "trigger")
-		message = fmt.Sprintf("TriggerLost2: %d", trgInfo.TriggerLost2)
-		logger.Info(message, "trigger")
-		message = fmt.Sprintf("TriggerMask: %d", trgInfo.TriggerMask)
-		logger.Info(message, "trigger")
-		message = fmt.Sprintf("TriggerDiff1: %d", trgInfo.TriggerDiff1)
-		logger.Info(message, "trigger")
-		message = fmt.Sprintf("TriggerDiff2: %d", trgInfo.TriggerDiff2)
-		logger.Info(message, "trigger")
-		message = fmt.Sprintf("AutoTrigger: %d", trgInfo.AutoTrigger)
-		logger.Info(message, "trigger")
-		message = fmt.Sprintf("DualTrigger: %d", trgInfo.DualTrigger)
-		logger.Info(message, "trigger")
-		message = fmt.Sprintf("ExternalTrigger: %d", trgInfo.ExternalTrigger)
-		logger.Info(message, "trigger")
-		message = fmt.Sprintf("Mask: %d", trgInfo.Mask)
-		logger.Info(message, "trigger")
-		message = fmt.Sprintf("TriggerB2: %d", trgInfo.TriggerB2)
-		logger.Info(message, "trigger")
-		message = fmt.Sprintf("TriggerB1: %d", trgInfo.TriggerB1)
-		logger.Info(message, "trigger")
-		message = fmt.Sprintf("ChanA1: %d", trgInfo.ChanA1)
-		logger.Info(message, "trigger")
-		message = fmt.Sprintf("ChanA2: %d", trgInfo.ChanA2)
-		logger.Info(message, "trigger")
-		message = fmt.Sprintf("ChanB1: %d", trgInfo.ChanB1)
-		logger.Info(message, "trigger")
-		message = fmt.Sprintf("ChanB2: %d", trgInfo.ChanB2)
-		logger.Info(message, "trigger")
-		message = fmt.Sprintf("WindowA1: %d", trgInfo.WindowA1)
-		logger.Info(message, "trigger")
-		message = fmt.Sprintf("WindowB1: %d", trgInfo.WindowB1)
-		logger.Info(message, "trigger")
-		message = fmt.Sprintf("WindowA2: %d", trgInfo.WindowA2)
-		logger.Info(message, "trigger")
-		message = fmt.Sprintf("WindowB2: %d", trgInfo.WindowB2)
-		logger.Info(message, "trigger")
-		message = fmt.Sprintf("TriggerIntN: %d", trgInfo.TriggerIntN)
-		logger.Info(message, "trigger")
-		message = fmt.Sprintf("TriggerExtN: %d", trgInfo.TriggerExtN)
-		logger.Info(message, "trigger")
-		message = fmt.Sprintf("TrgChannel: %v", trgInfo.TrgChannels)
-		logger.Info(message, "trigger")
+	log := ModuleLogger("trigger")
+	if logEnabled(log, LevelTrace) {
+		log.Log(context.Background(), LevelTrace, "Trigger FEC",
+			"run", event.RunNumber, "event", event.EventID,
+			"triggerType", trgInfo.TriggerType, "triggerLost1", trgInfo.TriggerLost1,
+			"triggerLost2", trgInfo.TriggerLost2, "triggerMask", trgInfo.TriggerMask,
+			"triggerDiff1", trgInfo.TriggerDiff1, "triggerDiff2", trgInfo.TriggerDiff2,
+			"autoTrigger", trgInfo.AutoTrigger, "dualTrigger", trgInfo.DualTrigger,
+			"externalTrigger", trgInfo.ExternalTrigger, "mask", trgInfo.Mask,
+			"triggerB2", trgInfo.TriggerB2, "triggerB1", trgInfo.TriggerB1,
+			"chanA1", trgInfo.ChanA1, "chanA2", trgInfo.ChanA2,
+			"chanB1", trgInfo.ChanB1, "chanB2", trgInfo.ChanB2,
+			"windowA1", trgInfo.WindowA1, "windowB1", trgInfo.WindowB1,
+			"windowA2", trgInfo.WindowA2, "windowB2", trgInfo.WindowB2,
+			"triggerIntN", trgInfo.TriggerIntN, "triggerExtN", trgInfo.TriggerExtN,
+			"trgChannels", trgInfo.TrgChannels)
 	}
 
+	return nil
 }
 
 func CheckBit(mask uint16, pos uint16) bool {
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	decoder "github.com/next-exp/decoder_go/pkg"
+)
+
+// Writes synthetic DATE files that can be read by the decoder
+func main() {
+	config := decoder.DefaultGeneratorConfig()
+
+	fileOut := flag.String("out", "", "Output file path")
+	nEvents := flag.Int("events", 10, "Number of events")
+	runNumber := flag.Uint("run", uint(config.RunNumber), "Run number")
+	firstEvent := flag.Uint("first-event", uint(config.FirstEvent), "ID of the first event")
+	seed := flag.Int64("seed", config.Seed, "Seed of the random generator")
+	ldcs := flag.Int("ldcs", config.LDCs, "Number of LDCs")
+	triggerType := flag.Uint("trigger-type", uint(config.TriggerType), "Trigger type")
+	bufferSamples := flag.Uint("buffer", uint(config.BufferSamples), "Buffer samples (40 MHz)")
+	preTrigger := flag.Uint("pretrigger", uint(config.PreTrigger), "Pretrigger samples (40 MHz)")
+	pmtFecs := flag.String("pmt-fecs", joinFecs(config.PmtFecs), "PMT FEC IDs, comma separated")
+	pmtMask := flag.String("pmt-mask", fmt.Sprintf("0x%04x", config.PmtChannelMask), "PMT channel mask")
+	pmtCompressed := flag.Bool("pmt-compressed", config.PmtCompressed, "Compress PMT data")
+	pmtBaselines := flag.Bool("pmt-baselines", config.PmtBaselines, "Send PMT baselines")
+	sipmFecs := flag.String("sipm-fecs", joinFecs(config.SipmFecs), "SiPM FEC IDs (even link), comma separated")
+	sipmFebs := flag.Int("sipm-febs", config.SipmFebsPerFec, "FEBs per SiPM FEC")
+	sipmZS := flag.Bool("sipm-zs", config.SipmZeroSuppression, "Zero suppression for SiPMs")
+	sipmCompressed := flag.Bool("sipm-compressed", config.SipmCompressed, "Compress SiPM data")
+	sipmThreshold := flag.Int("sipm-threshold", int(config.SipmThreshold), "SiPM zero suppression threshold")
+	triggerFecs := flag.String("trigger-fecs", joinFecs(config.TriggerFecs), "Trigger FEC IDs, comma separated")
+	errorBit := flag.Float64("fault-error-bit", 0, "Probability of the error bit in each FEC")
+	ftJump := flag.Float64("fault-ft-jump", 0, "Probability of an FT jump in each FEC")
+	truncate := flag.Float64("fault-truncate", 0, "Probability of a truncated payload in each FEC")
+	codesOut := flag.String("codes-out", "", "Write the huffman codes used (value,code) to this file")
+	eventDelay := flag.Duration("event-delay", 0, "Write the events slowly, as the DAQ does, with this delay between them")
+	flag.Parse()
+
+	if *fileOut == "" {
+		fmt.Fprintln(os.Stderr, "Output file is required (-out)")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	mask, err := strconv.ParseUint(*pmtMask, 0, 16)
+	if err != nil {
+		exitOnError(fmt.Errorf("Error parsing PMT channel mask: %w", err))
+	}
+	config.RunNumber = uint32(*runNumber)
+	config.FirstEvent = uint32(*firstEvent)
+	config.Seed = *seed
+	config.LDCs = *ldcs
+	config.TriggerType = uint16(*triggerType)
+	config.BufferSamples = uint32(*bufferSamples)
+	config.PreTrigger = uint32(*preTrigger)
+	config.PmtChannelMask = uint16(mask)
+	config.PmtCompressed = *pmtCompressed
+	config.PmtBaselines = *pmtBaselines
+	config.SipmFebsPerFec = *sipmFebs
+	config.SipmZeroSuppression = *sipmZS
+	config.SipmCompressed = *sipmCompressed
+	config.SipmThreshold = int16(*sipmThreshold)
+	config.Faults = decoder.Faults{
+		ErrorBit: *errorBit,
+		FTJump:   *ftJump,
+		Truncate: *truncate,
+	}
+	if config.PmtFecs, err = parseFecs(*pmtFecs); err != nil {
+		exitOnError(err)
+	}
+	if config.SipmFecs, err = parseFecs(*sipmFecs); err != nil {
+		exitOnError(err)
+	}
+	if config.TriggerFecs, err = parseFecs(*triggerFecs); err != nil {
+		exitOnError(err)
+	}
+
+	generator, err := decoder.NewGenerator(config)
+	if err != nil {
+		exitOnError(fmt.Errorf("Error in generator configuration: %w", err))
+	}
+
+	file, err := os.Create(*fileOut)
+	if err != nil {
+		exitOnError(fmt.Errorf("Error creating output file: %w", err))
+	}
+	if *eventDelay > 0 {
+		err = writeSlowly(file, generator, *nEvents, *eventDelay)
+	} else {
+		writer := bufio.NewWriter(file)
+		err = generator.WriteEvents(writer, *nEvents)
+		if err == nil {
+			err = writer.Flush()
+		}
+	}
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		exitOnError(fmt.Errorf("Error writing output file: %w", err))
+	}
+
+	if *codesOut != "" {
+		if err := writeHuffmanCodes(*codesOut, decoder.DefaultHuffmanTable()); err != nil {
+			exitOnError(fmt.Errorf("Error writing huffman codes: %w", err))
+		}
+	}
+	fmt.Printf("%d events written to %s\n", *nEvents, *fileOut)
+}
+
+// Each event is written in two halves so readers find partial events
+func writeSlowly(file *os.File, generator *decoder.Generator, nEvents int, delay time.Duration) error {
+	for i := 0; i < nEvents; i++ {
+		data := generator.NextEvent().Data
+		half := len(data) / 2
+		if _, err := file.Write(data[:half]); err != nil {
+			return err
+		}
+		time.Sleep(delay / 2)
+		if _, err := file.Write(data[half:]); err != nil {
+			return err
+		}
+		time.Sleep(delay / 2)
+	}
+	return nil
+}
+
+func exitOnError(err error) {
+	fmt.Fprintln(os.Stderr, err.Error())
+	os.Exit(1)
+}
+
+func parseFecs(list string) ([]uint16, error) {
+	fecs := make([]uint16, 0)
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		fecID, err := strconv.ParseUint(field, 0, 16)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing FEC ID %q: %w", field, err)
+		}
+		fecs = append(fecs, uint16(fecID))
+	}
+	return fecs, nil
+}
+
+func joinFecs(fecs []uint16) string {
+	fields := make([]string, len(fecs))
+	for i, fecID := range fecs {
+		fields[i] = strconv.Itoa(int(fecID))
+	}
+	return strings.Join(fields, ",")
+}
+
+// Same columns as the HuffmanCodes tables in the database
+func writeHuffmanCodes(filename string, table decoder.HuffmanTable) error {
+	values := make([]int32, 0, len(table))
+	for value := range table {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	lines := make([]string, 0, len(values)+1)
+	lines = append(lines, "value,code")
+	for _, value := range values {
+		lines = append(lines, fmt.Sprintf("%d,%s", value, table[value]))
+	}
+	return os.WriteFile(filename, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}